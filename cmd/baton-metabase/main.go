@@ -4,11 +4,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
 	cfg "github.com/conductorone/baton-metabase/pkg/config"
 	"github.com/conductorone/baton-metabase/pkg/connector"
+	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/conductorone/baton-sdk/pkg/config"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/field"
@@ -22,7 +24,7 @@ var version = "dev"
 func main() {
 	ctx := context.Background()
 
-	_, cmd, err := config.DefineConfiguration(
+	v, cmd, err := config.DefineConfiguration(
 		ctx,
 		"baton-metabase",
 		getConnector,
@@ -35,7 +37,27 @@ func main() {
 
 	cmd.Version = version
 
+	_, err = cli.AddCommand(cmd, v, &cfg.Config, newSnapshotCommand(ctx, v))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	cmd.AddCommand(newSnapshotDiffCommand())
+
+	_, err = cli.AddCommand(cmd, v, &cfg.Config, newPolicyCommand(ctx, v))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
 	err = cmd.Execute()
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		if exitErr.err != nil {
+			fmt.Fprintln(os.Stderr, exitErr.err.Error())
+		}
+		os.Exit(exitErr.code)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -0,0 +1,71 @@
+//go:build !generate
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	cfg "github.com/conductorone/baton-metabase/pkg/config"
+	"github.com/conductorone/baton-metabase/pkg/policy"
+	"github.com/conductorone/baton-sdk/pkg/cli"
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newPolicyCommand returns the policy subcommand, which prints the changes that make the instance
+// match a desired-state policy file and makes them only when --apply is set.
+func newPolicyCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy FILE",
+		Short: "Plan, and with --apply make, the membership and permission changes a YAML policy file describes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+
+			config, err := cli.MakeGenericConfiguration[*cfg.Metabase](v)
+			if err != nil {
+				return err
+			}
+			if err := field.Validate(cfg.Config, config); err != nil {
+				return err
+			}
+
+			p, err := policy.Load(args[0])
+			if err != nil {
+				return err
+			}
+
+			c, err := client.New(ctx, config.MetabaseBaseUrl, config.MetabaseApiKey, config.MetabaseWithPaidPlan)
+			if err != nil {
+				return err
+			}
+
+			plan, err := p.Plan(ctx, c)
+			if err != nil {
+				return fmt.Errorf("failed to plan policy: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			if err := plan.WriteText(out); err != nil {
+				return err
+			}
+			if !v.GetBool("apply") || plan.Empty() {
+				return nil
+			}
+
+			if err := plan.Apply(ctx, c); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "applied")
+			return nil
+		},
+	}
+	cmd.Flags().Bool("apply", false, "Make the planned changes instead of only printing them")
+
+	return cmd
+}
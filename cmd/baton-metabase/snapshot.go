@@ -0,0 +1,60 @@
+//go:build !generate
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	cfg "github.com/conductorone/baton-metabase/pkg/config"
+	"github.com/conductorone/baton-metabase/pkg/snapshot"
+	"github.com/conductorone/baton-sdk/pkg/cli"
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newSnapshotCommand returns the snapshot subcommand, which writes the access on the instance to
+// a directory without running a sync, for audits that archive and diff it.
+func newSnapshotCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Write a snapshot of users, groups, memberships and permission graphs as JSON and CSV",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+
+			config, err := cli.MakeGenericConfiguration[*cfg.Metabase](v)
+			if err != nil {
+				return err
+			}
+			if err := field.Validate(cfg.Config, config); err != nil {
+				return err
+			}
+
+			c, err := client.New(ctx, config.MetabaseBaseUrl, config.MetabaseApiKey, config.MetabaseWithPaidPlan)
+			if err != nil {
+				return err
+			}
+
+			s, err := snapshot.Take(ctx, c)
+			if err != nil {
+				return fmt.Errorf("failed to take snapshot: %w", err)
+			}
+
+			dir := v.GetString("output-dir")
+			if err := snapshot.Write(dir, s); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "wrote snapshot of %d users, %d groups and %d memberships to %s\n",
+				len(s.Users), len(s.Groups), len(s.Memberships), dir)
+			return nil
+		},
+	}
+	cmd.Flags().String("output-dir", "snapshot", "Directory to write snapshot.json, users.csv, memberships.csv and grants.csv to")
+
+	return cmd
+}
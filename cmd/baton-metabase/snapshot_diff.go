@@ -0,0 +1,77 @@
+//go:build !generate
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/conductorone/baton-metabase/pkg/snapshot"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of snapshot-diff, as with diff(1).
+const (
+	exitDrift  = 1
+	exitFailed = 2
+)
+
+// exitCodeError ends the process with code instead of the default 1. A nil err exits silently.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// newSnapshotDiffCommand returns the snapshot-diff subcommand, which reports the access drift between
+// two snapshots and exits non-zero when there is any, so it can gate a change-management pipeline.
+func newSnapshotDiffCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "snapshot-diff OLD NEW",
+		Short: "Report the access drift between two snapshots, exiting with 1 on drift",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "text" && output != "json" {
+				return &exitCodeError{code: exitFailed, err: fmt.Errorf("invalid output %q, expected text or json", output)}
+			}
+
+			old, err := snapshot.Read(args[0])
+			if err != nil {
+				return &exitCodeError{code: exitFailed, err: err}
+			}
+			current, err := snapshot.Read(args[1])
+			if err != nil {
+				return &exitCodeError{code: exitFailed, err: err}
+			}
+
+			diff := snapshot.Compare(old, current)
+			if output == "json" {
+				err = diff.WriteJSON(cmd.OutOrStdout())
+			} else {
+				err = diff.WriteText(cmd.OutOrStdout())
+			}
+			if err != nil {
+				return &exitCodeError{code: exitFailed, err: err}
+			}
+
+			if !diff.Empty() {
+				return &exitCodeError{code: exitDrift}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&output, "output", "text", "Output format: text or json")
+
+	return cmd
+}
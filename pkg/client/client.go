@@ -8,11 +8,13 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
 )
 
 const (
@@ -26,6 +28,18 @@ const (
 	// https://www.metabase.com/docs/latest/api#tag/apipermissions/get/api/permissions/group
 	getGroups = "/api/permissions/group"
 
+	// https://www.metabase.com/docs/latest/api#tag/apipermissions/get/api/permissions/group/{id}
+	getGroupByID = "/api/permissions/group"
+
+	// https://www.metabase.com/docs/latest/api#tag/apipermissions/post/api/permissions/group
+	createGroup = "/api/permissions/group"
+
+	// https://www.metabase.com/docs/latest/api#tag/apipermissions/put/api/permissions/group/{group-id}
+	updateGroup = "/api/permissions/group/%s"
+
+	// https://www.metabase.com/docs/latest/api#tag/apipermissions/delete/api/permissions/group/{group-id}
+	deleteGroup = "/api/permissions/group/%s"
+
 	// https://www.metabase.com/docs/latest/api#tag/apiuser/get/api/user/
 	getUsers = "/api/user"
 
@@ -49,6 +63,69 @@ const (
 
 	// https://www.metabase.com/docs/latest/api#tag/apipermissions/delete/api/permissions/membership/{id}
 	removeUserFromGroup = "/api/permissions/membership/%s"
+
+	// https://www.metabase.com/docs/latest/api#tag/apipermissions/put/api/permissions/membership/{id}
+	updateMembership = "/api/permissions/membership/%s"
+
+	// https://www.metabase.com/docs/latest/api#tag/apipermissions/get/api/permissions/graph
+	getPermissionsGraph = "/api/permissions/graph"
+
+	// https://www.metabase.com/docs/latest/api#tag/apicollection/get/api/collection/graph
+	getCollectionGraph = "/api/collection/graph"
+
+	// https://www.metabase.com/docs/latest/api#tag/apicollection/put/api/collection/graph
+	updateCollectionGraph = "/api/collection/graph"
+
+	// https://www.metabase.com/docs/latest/api#tag/apidatabase/get/api/database/
+	getDatabases = "/api/database"
+
+	// https://www.metabase.com/docs/latest/api#tag/apipermissions/put/api/permissions/graph
+	updatePermissionsGraph = "/api/permissions/graph"
+
+	// https://www.metabase.com/docs/latest/api#tag/apimtgtap/get/api/mt/gtap/
+	getSandboxes = "/api/mt/gtap"
+
+	// https://www.metabase.com/docs/latest/api#tag/apimtgtap/post/api/mt/gtap/
+	createSandbox = "/api/mt/gtap"
+
+	// https://www.metabase.com/docs/latest/api#tag/apimtgtap/delete/api/mt/gtap/{id}
+	deleteSandbox = "/api/mt/gtap/%s"
+
+	// https://www.metabase.com/docs/latest/api#tag/apieeadvanced-permissionsimpersonation/get/api/ee/advanced-permissions/impersonation/
+	getImpersonations = "/api/ee/advanced-permissions/impersonation"
+
+	// https://www.metabase.com/docs/latest/api#tag/apieeadvanced-permissionsapplication/get/api/ee/advanced-permissions/application/graph
+	getApplicationGraph = "/api/ee/advanced-permissions/application/graph"
+
+	// https://www.metabase.com/docs/latest/api#tag/apieeadvanced-permissionsapplication/put/api/ee/advanced-permissions/application/graph
+	updateApplicationGraph = "/api/ee/advanced-permissions/application/graph"
+
+	// https://www.metabase.com/docs/latest/api#tag/apitable/get/api/table/{id}/query_metadata
+	getTableMetadata = "/api/table/%s/query_metadata"
+
+	// https://www.metabase.com/docs/latest/api#tag/apidatabase/get/api/database/{id}/metadata
+	getDatabaseMetadata = "/api/database/%d/metadata"
+
+	// https://www.metabase.com/docs/latest/api#tag/apidataset/post/api/dataset/
+	runQuery = "/api/dataset"
+
+	// https://www.metabase.com/docs/latest/api#tag/apisetting/get/api/setting/{key}
+	getSetting = "/api/setting/%s"
+
+	// https://www.metabase.com/docs/latest/api#tag/apisetting/put/api/setting/{key}
+	updateSetting = "/api/setting/%s"
+
+	// https://www.metabase.com/docs/latest/api#tag/apiapi-key/get/api/api-key/
+	getAPIKeys = "/api/api-key"
+
+	// https://www.metabase.com/docs/latest/api#tag/apiapi-key/post/api/api-key/
+	createAPIKey = "/api/api-key"
+
+	// https://www.metabase.com/docs/latest/api#tag/apiapi-key/put/api/api-key/{id}/regenerate
+	regenerateAPIKey = "/api/api-key/%s/regenerate"
+
+	// https://www.metabase.com/docs/latest/api#tag/apiapi-key/delete/api/api-key/{id}
+	deleteAPIKey = "/api/api-key/%s"
 )
 
 type MetabaseClient struct {
@@ -56,23 +133,70 @@ type MetabaseClient struct {
 	baseURL    *url.URL
 	apiKey     string
 	isPaidPlan bool
+	// recorder is set when fixture recording is enabled.
+	recorder *recordingTransport
 }
 
-func New(ctx context.Context, rawBaseURL string, apiKey string, isPaidPlan bool) (*MetabaseClient, error) {
+// Option customizes how a MetabaseClient talks to the network.
+type Option func(o *clientOptions)
+
+type clientOptions struct {
+	fixturePath string
+	transport   http.RoundTripper
+}
+
+// WithFixtureRecording records every request and response to path, with credentials redacted.
+// The resulting file can be served back offline with NewReplayTransport.
+func WithFixtureRecording(path string) Option {
+	return func(o *clientOptions) {
+		o.fixturePath = path
+	}
+}
+
+// WithTransport replaces the underlying HTTP transport, e.g. with a ReplayTransport in tests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) {
+		o.transport = transport
+	}
+}
+
+func New(ctx context.Context, rawBaseURL string, apiKey string, isPaidPlan bool, opts ...Option) (*MetabaseClient, error) {
 	l := ctxzap.Extract(ctx)
 
+	var options clientOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	client, err := uhttp.NewClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	httpClient, err := uhttp.NewBaseHttpClientWithContext(ctx, client)
+	if options.transport != nil {
+		client.Transport = options.transport
+	}
+
+	baseURL, err := url.Parse(rawBaseURL)
 	if err != nil {
 		return nil, err
 	}
 
-	baseURL, err := url.Parse(rawBaseURL)
+	var recorder *recordingTransport
+	if options.fixturePath != "" {
+		l.Warn("recording Metabase API fixtures; do not share the file without reviewing it", zap.String("path", options.fixturePath))
+		recorder, err = newRecordingTransport(client.Transport, options.fixturePath)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = recorder
+	}
+
+	httpClient, err := uhttp.NewBaseHttpClientWithContext(ctx, client)
 	if err != nil {
+		if recorder != nil {
+			_ = recorder.Close()
+		}
 		return nil, err
 	}
 
@@ -85,10 +209,32 @@ func New(ctx context.Context, rawBaseURL string, apiKey string, isPaidPlan bool)
 		baseURL:    baseURL,
 		apiKey:     apiKey,
 		isPaidPlan: isPaidPlan,
+		recorder:   recorder,
 	}, nil
 }
 
+// Close releases what the client holds open, flushing the fixture recording if there is one.
+func (c *MetabaseClient) Close() error {
+	if c.recorder == nil {
+		return nil
+	}
+	return c.recorder.Close()
+}
+
 func (c *MetabaseClient) doRequest(ctx context.Context, method string, url *url.URL, target interface{}, body interface{}, opts ...ReqOpt) (*http.Header, *v2.RateLimitDescription, error) {
+	return c.doRequestWithOptions(ctx, method, url, target, body, nil, opts...)
+}
+
+// doRequestWithOptions is doRequest with extra uhttp request options, such as uhttp.WithNoCache.
+func (c *MetabaseClient) doRequestWithOptions(
+	ctx context.Context,
+	method string,
+	url *url.URL,
+	target interface{},
+	body interface{},
+	extra []uhttp.RequestOption,
+	opts ...ReqOpt,
+) (*http.Header, *v2.RateLimitDescription, error) {
 	for _, opt := range opts {
 		opt(url)
 	}
@@ -97,6 +243,7 @@ func (c *MetabaseClient) doRequest(ctx context.Context, method string, url *url.
 	requestOptions = append(requestOptions,
 		uhttp.WithAcceptJSONHeader(),
 		uhttp.WithHeader(headerAPIKey, c.apiKey))
+	requestOptions = append(requestOptions, extra...)
 	if body != nil {
 		requestOptions = append(requestOptions, uhttp.WithContentTypeJSONHeader(), uhttp.WithJSONBody(body))
 	}
@@ -108,7 +255,9 @@ func (c *MetabaseClient) doRequest(ctx context.Context, method string, url *url.
 
 	var rateLimitData v2.RateLimitDescription
 	response, err := c.client.Do(request, uhttp.WithRatelimitData(&rateLimitData))
-	if err != nil {
+	// uhttp returns an error alongside the response for any non-2xx status.
+	// In that case we keep going so the Metabase error body below can be surfaced.
+	if err != nil && (response == nil || response.StatusCode < 300) {
 		return nil, nil, fmt.Errorf("request failed: %w", err)
 	}
 
@@ -124,14 +273,14 @@ func (c *MetabaseClient) doRequest(ctx context.Context, method string, url *url.
 	// so we first read the raw response and try to parse it as JSON.
 	// If parsing fails or the response is empty, we fall back to using the HTTP status text.
 	if response.StatusCode >= 300 {
-		bodyBytes, err := io.ReadAll(response.Body)
-		if err != nil {
-			return nil, &rateLimitData, fmt.Errorf("failed to read response body: %w", err)
+		bodyBytes, readErr := io.ReadAll(response.Body)
+		if readErr != nil {
+			return nil, &rateLimitData, fmt.Errorf("failed to read response body: %w", readErr)
 		}
 		bodyStr := strings.TrimSpace(string(bodyBytes))
 
 		var errResp ErrorResponse
-		if jsonErr := json.Unmarshal(bodyBytes, &errResp); jsonErr == nil && errResp.MessageText != "" {
+		if jsonErr := json.Unmarshal(bodyBytes, &errResp); jsonErr == nil && (errResp.MessageText != "" || len(errResp.Errors) > 0) {
 			bodyStr = errResp.Message()
 		}
 
@@ -139,8 +288,13 @@ func (c *MetabaseClient) doRequest(ctx context.Context, method string, url *url.
 			bodyStr = http.StatusText(response.StatusCode)
 		}
 
-		return nil, &rateLimitData, fmt.Errorf("metabase API error: status %d %s: %s",
+		apiErr := fmt.Errorf("metabase API error: status %d %s: %s",
 			response.StatusCode, response.Status, bodyStr)
+		if err != nil {
+			// Keep the wrapped gRPC status so the SDK can still classify retryable errors.
+			apiErr = fmt.Errorf("%w: %w", apiErr, err)
+		}
+		return nil, &rateLimitData, apiErr
 	}
 
 	if target != nil {
@@ -153,21 +307,35 @@ func (c *MetabaseClient) doRequest(ctx context.Context, method string, url *url.
 }
 
 func (c *MetabaseClient) ListUsers(ctx context.Context, options PageOptions) ([]*User, string, *v2.RateLimitDescription, error) {
+	res, rateLimitDesc, err := c.ListUsersPage(ctx, options)
+	if err != nil {
+		return nil, "", rateLimitDesc, err
+	}
+
+	nextToken := NextPageToken(res.Offset, res.Limit, res.Total)
+
+	return res.Data, nextToken, rateLimitDesc, nil
+}
+
+// ListUsersPage returns a raw page of users, including the total number of users,
+// so callers can plan the remaining offsets up front.
+func (c *MetabaseClient) ListUsersPage(ctx context.Context, options PageOptions) (*UsersQueryResponse, *v2.RateLimitDescription, error) {
 	var res UsersQueryResponse
 
 	queryUrl := c.baseURL.JoinPath(getUsers)
 
-	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &res, nil,
+	// Pages are fetched in parallel by the users builder. They bypass the HTTP cache: the
+	// SDK's no-op cache is not safe for concurrent use, and a page is read once per sync anyway.
+	_, rateLimitDesc, err := c.doRequestWithOptions(ctx, http.MethodGet, queryUrl, &res, nil,
+		[]uhttp.RequestOption{uhttp.WithNoCache()},
 		withLimitParam(options.Limit),
 		withOffsetParam(options.Offset),
 		withStatusAllParam())
 	if err != nil {
-		return nil, "", rateLimitDesc, fmt.Errorf("failed to fetch users: %w", err)
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch users: %w", err)
 	}
 
-	nextToken := getNextPageToken(res.Offset, res.Limit, res.Total)
-
-	return res.Data, nextToken, rateLimitDesc, nil
+	return &res, rateLimitDesc, nil
 }
 
 func (c *MetabaseClient) CreateUser(ctx context.Context, request *CreateUserRequest) (*User, *v2.RateLimitDescription, error) {
@@ -230,6 +398,109 @@ func (c *MetabaseClient) ListGroups(ctx context.Context) ([]*Group, *v2.RateLimi
 	return resp, rateLimitDesc, nil
 }
 
+// ListGroupsPage returns one page of groups and the token of the next page.
+// Metabase versions without group paging ignore limit and offset and return every group;
+// the page is then cut from the full list so callers see the same pages either way.
+func (c *MetabaseClient) ListGroupsPage(ctx context.Context, options PageOptions) ([]*Group, string, *v2.RateLimitDescription, error) {
+	var resp []*Group
+
+	limit := options.Limit
+	if limit <= 0 {
+		limit = ItemsPerPage
+	}
+
+	queryUrl := c.baseURL.JoinPath(getGroups)
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &resp, nil,
+		withLimitParam(limit),
+		withOffsetParam(options.Offset),
+	)
+	if err != nil {
+		return nil, "", rateLimitDesc, fmt.Errorf("failed to fetch groups: %w", err)
+	}
+
+	pagingIgnored := len(resp) > limit
+	if !pagingIgnored && options.Offset > 0 && len(resp) == limit {
+		// When there are exactly limit groups, a server that ignores paging returns the same
+		// full page for every offset. Only where the page starts tells it from a real page.
+		var first []*Group
+		_, firstRateLimit, err := c.doRequest(ctx, http.MethodGet, c.baseURL.JoinPath(getGroups), &first, nil, withLimitParam(1))
+		if firstRateLimit != nil {
+			rateLimitDesc = firstRateLimit
+		}
+		if err != nil {
+			return nil, "", rateLimitDesc, fmt.Errorf("failed to fetch groups: %w", err)
+		}
+		pagingIgnored = len(first) > 0 && first[0].ID == resp[0].ID
+	}
+
+	if pagingIgnored {
+		ctxzap.Extract(ctx).Debug("metabase ignored group paging, paging client-side", zap.Int("groups", len(resp)))
+		total := len(resp)
+		if options.Offset >= total {
+			return nil, "", rateLimitDesc, nil
+		}
+		end := min(options.Offset+limit, total)
+		return resp[options.Offset:end], NextPageToken(options.Offset, limit, total), rateLimitDesc, nil
+	}
+
+	// A full page may be the last one; the next request then comes back empty.
+	var nextToken string
+	if len(resp) == limit {
+		nextToken = strconv.Itoa(options.Offset + limit)
+	}
+
+	return resp, nextToken, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) GetGroupByID(ctx context.Context, groupID string) (*Group, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(getGroupByID, url.PathEscape(groupID))
+
+	var group Group
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &group, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch group by ID %s: %w", groupID, err)
+	}
+
+	return &group, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) CreateGroup(ctx context.Context, request *GroupRequest) (*Group, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(createGroup)
+
+	var group Group
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPost, queryUrl, &group, request)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to create group %s: %w", request.Name, err)
+	}
+
+	return &group, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) UpdateGroup(ctx context.Context, groupID string, request *GroupRequest) (*Group, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(updateGroup, url.PathEscape(groupID)))
+
+	var group Group
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPut, queryUrl, &group, request)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to update group %s: %w", groupID, err)
+	}
+
+	return &group, rateLimitDesc, nil
+}
+
+// DeleteGroup deletes a group. Metabase also removes its memberships and its permissions.
+func (c *MetabaseClient) DeleteGroup(ctx context.Context, groupID string) (*v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(deleteGroup, url.PathEscape(groupID)))
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodDelete, queryUrl, nil, nil)
+	if err != nil {
+		return rateLimitDesc, fmt.Errorf("failed to delete group %s: %w", groupID, err)
+	}
+
+	return rateLimitDesc, nil
+}
+
 func (c *MetabaseClient) ListMemberships(ctx context.Context) (map[string][]*Membership, *v2.RateLimitDescription, error) {
 	var membershipResponse map[string][]*Membership
 
@@ -265,6 +536,283 @@ func (c *MetabaseClient) RemoveUserFromGroup(ctx context.Context, membershipID s
 	return rateLimitDesc, nil
 }
 
+// UpdateMembership makes the user of a membership a manager of its group or a plain member.
+func (c *MetabaseClient) UpdateMembership(ctx context.Context, membershipID string, isGroupManager bool) (*v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(updateMembership, url.PathEscape(membershipID)))
+
+	body := map[string]bool{"is_group_manager": isGroupManager}
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPut, queryUrl, nil, body)
+	if err != nil {
+		return rateLimitDesc, fmt.Errorf("failed to update membership %s: %w", membershipID, err)
+	}
+
+	return rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) GetPermissionsGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(getPermissionsGraph)
+
+	var graph PermissionsGraph
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &graph, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch permissions graph: %w", err)
+	}
+
+	return &graph, rateLimitDesc, nil
+}
+
+// GetCollectionGraph returns the collection permissions graph. It has the same shape as the data
+// permissions graph, with each group mapping collection IDs to "read", "write" or "none".
+func (c *MetabaseClient) GetCollectionGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(getCollectionGraph)
+
+	var graph PermissionsGraph
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &graph, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch collection graph: %w", err)
+	}
+
+	return &graph, rateLimitDesc, nil
+}
+
+// UpdateCollectionGraph updates the groups in graph and returns the new graph. Metabase rejects the
+// update with a conflict when graph.Revision is not the current revision.
+func (c *MetabaseClient) UpdateCollectionGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(updateCollectionGraph)
+
+	var updated PermissionsGraph
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPut, queryUrl, &updated, graph)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to update collection graph: %w", err)
+	}
+
+	return &updated, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) ListDatabases(ctx context.Context) ([]*Database, *v2.RateLimitDescription, error) {
+	var resp DatabasesResponse
+
+	queryUrl := c.baseURL.JoinPath(getDatabases)
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &resp, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch databases: %w", err)
+	}
+
+	return resp.Data, rateLimitDesc, nil
+}
+
+// ListSandboxes returns every sandbox on the instance. Sandboxes are a paid feature.
+func (c *MetabaseClient) ListSandboxes(ctx context.Context) ([]*Sandbox, *v2.RateLimitDescription, error) {
+	var resp []*Sandbox
+
+	queryUrl := c.baseURL.JoinPath(getSandboxes)
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &resp, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch sandboxes: %w", err)
+	}
+
+	return resp, rateLimitDesc, nil
+}
+
+// ListImpersonations returns every connection impersonation policy on the instance. Impersonation
+// is a paid feature.
+func (c *MetabaseClient) ListImpersonations(ctx context.Context) ([]*Impersonation, *v2.RateLimitDescription, error) {
+	var resp []*Impersonation
+
+	queryUrl := c.baseURL.JoinPath(getImpersonations)
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &resp, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch impersonations: %w", err)
+	}
+
+	return resp, rateLimitDesc, nil
+}
+
+// CreateSandbox creates a sandbox. Metabase only applies it once the permissions graph marks
+// the table as sandboxed for the group.
+func (c *MetabaseClient) CreateSandbox(ctx context.Context, sandbox *Sandbox) (*Sandbox, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(createSandbox)
+
+	var created Sandbox
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPost, queryUrl, &created, sandbox)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to create sandbox of table %d for group %d: %w", sandbox.TableID, sandbox.GroupID, err)
+	}
+
+	return &created, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) DeleteSandbox(ctx context.Context, sandboxID string) (*v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(deleteSandbox, url.PathEscape(sandboxID)))
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodDelete, queryUrl, nil, nil)
+	if err != nil {
+		return rateLimitDesc, fmt.Errorf("failed to delete sandbox %s: %w", sandboxID, err)
+	}
+
+	return rateLimitDesc, nil
+}
+
+// UpdatePermissionsGraph replaces the permissions of the groups in graph. Metabase rejects the
+// update with a conflict when graph.Revision is not the current revision.
+func (c *MetabaseClient) UpdatePermissionsGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(updatePermissionsGraph)
+
+	var updated PermissionsGraph
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPut, queryUrl, &updated, graph)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to update permissions graph: %w", err)
+	}
+
+	return &updated, rateLimitDesc, nil
+}
+
+// GetApplicationGraph returns the application permissions graph, a paid feature. Each group maps
+// "setting", "monitoring" and "subscription" to "yes" or "no".
+func (c *MetabaseClient) GetApplicationGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(getApplicationGraph)
+
+	var graph PermissionsGraph
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &graph, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch application permissions graph: %w", err)
+	}
+
+	return &graph, rateLimitDesc, nil
+}
+
+// UpdateApplicationGraph updates the groups in graph and returns the new graph. Metabase rejects the
+// update with a conflict when graph.Revision is not the current revision.
+func (c *MetabaseClient) UpdateApplicationGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(updateApplicationGraph)
+
+	var updated PermissionsGraph
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPut, queryUrl, &updated, graph)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to update application permissions graph: %w", err)
+	}
+
+	return &updated, rateLimitDesc, nil
+}
+
+// GetTableMetadata returns a table with its fields and the ID of its database.
+func (c *MetabaseClient) GetTableMetadata(ctx context.Context, tableID string) (*Table, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(getTableMetadata, url.PathEscape(tableID)))
+
+	var table Table
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &table, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch metadata of table %s: %w", tableID, err)
+	}
+
+	return &table, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) GetDatabaseMetadata(ctx context.Context, databaseID int) (*DatabaseMetadata, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(getDatabaseMetadata, databaseID))
+
+	var metadata DatabaseMetadata
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &metadata, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch metadata of database %d: %w", databaseID, err)
+	}
+
+	return &metadata, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) RunQuery(ctx context.Context, query *DatasetQuery) (*DatasetResponse, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(runQuery)
+
+	var resp DatasetResponse
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPost, queryUrl, &resp, query)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to run query on database %d: %w", query.Database, err)
+	}
+	if resp.Status == "failed" {
+		return nil, rateLimitDesc, fmt.Errorf("query on database %d failed: %s", query.Database, resp.Error)
+	}
+
+	return &resp, rateLimitDesc, nil
+}
+
+// GetSetting returns the value of an admin setting, decoded from JSON. Unset settings are nil.
+func (c *MetabaseClient) GetSetting(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(getSetting, url.PathEscape(key)))
+
+	var value any
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &value, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch setting %s: %w", key, err)
+	}
+
+	return value, rateLimitDesc, nil
+}
+
+// UpdateSetting replaces the value of an admin setting.
+func (c *MetabaseClient) UpdateSetting(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(updateSetting, url.PathEscape(key)))
+
+	body := map[string]any{"value": value}
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPut, queryUrl, nil, body)
+	if err != nil {
+		return rateLimitDesc, fmt.Errorf("failed to update setting %s: %w", key, err)
+	}
+
+	return rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) ListAPIKeys(ctx context.Context) ([]*APIKey, *v2.RateLimitDescription, error) {
+	var resp []*APIKey
+
+	queryUrl := c.baseURL.JoinPath(getAPIKeys)
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodGet, queryUrl, &resp, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to fetch api keys: %w", err)
+	}
+
+	return resp, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) CreateAPIKey(ctx context.Context, request *CreateAPIKeyRequest) (*APIKey, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(createAPIKey)
+
+	var key APIKey
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPost, queryUrl, &key, request)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return &key, rateLimitDesc, nil
+}
+
+// RegenerateAPIKey replaces the secret of an API key. Only the ID and the key fields are returned.
+func (c *MetabaseClient) RegenerateAPIKey(ctx context.Context, keyID string) (*APIKey, *v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(regenerateAPIKey, url.PathEscape(keyID)))
+
+	var key APIKey
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodPut, queryUrl, &key, nil)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to regenerate api key %s: %w", keyID, err)
+	}
+
+	return &key, rateLimitDesc, nil
+}
+
+func (c *MetabaseClient) DeleteAPIKey(ctx context.Context, keyID string) (*v2.RateLimitDescription, error) {
+	queryUrl := c.baseURL.JoinPath(fmt.Sprintf(deleteAPIKey, url.PathEscape(keyID)))
+
+	_, rateLimitDesc, err := c.doRequest(ctx, http.MethodDelete, queryUrl, nil, nil)
+	if err != nil {
+		return rateLimitDesc, fmt.Errorf("failed to delete api key %s: %w", keyID, err)
+	}
+
+	return rateLimitDesc, nil
+}
+
 func (c *MetabaseClient) IsPaidPlan() bool {
 	return c.isPaidPlan
 }
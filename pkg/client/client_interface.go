@@ -8,12 +8,39 @@ import (
 
 type ClientService interface {
 	ListUsers(ctx context.Context, options PageOptions) ([]*User, string, *v2.RateLimitDescription, error)
+	ListUsersPage(ctx context.Context, options PageOptions) (*UsersQueryResponse, *v2.RateLimitDescription, error)
 	ListGroups(ctx context.Context) ([]*Group, *v2.RateLimitDescription, error)
+	ListGroupsPage(ctx context.Context, options PageOptions) ([]*Group, string, *v2.RateLimitDescription, error)
 	ListMemberships(ctx context.Context) (map[string][]*Membership, *v2.RateLimitDescription, error)
 	IsPaidPlan() bool
 	CreateUser(ctx context.Context, payload *CreateUserRequest) (*User, *v2.RateLimitDescription, error)
 	UpdateUserActiveStatus(ctx context.Context, userId string, active bool) (*User, *v2.RateLimitDescription, error)
 	AddUserToGroup(ctx context.Context, request *Membership) (*v2.RateLimitDescription, error)
 	RemoveUserFromGroup(ctx context.Context, membershipID string) (*v2.RateLimitDescription, error)
+	UpdateMembership(ctx context.Context, membershipID string, isGroupManager bool) (*v2.RateLimitDescription, error)
 	GetUserByID(ctx context.Context, userID string) (*User, *v2.RateLimitDescription, error)
+	GetGroupByID(ctx context.Context, groupID string) (*Group, *v2.RateLimitDescription, error)
+	CreateGroup(ctx context.Context, request *GroupRequest) (*Group, *v2.RateLimitDescription, error)
+	UpdateGroup(ctx context.Context, groupID string, request *GroupRequest) (*Group, *v2.RateLimitDescription, error)
+	DeleteGroup(ctx context.Context, groupID string) (*v2.RateLimitDescription, error)
+	GetPermissionsGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	GetCollectionGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	UpdateCollectionGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	ListDatabases(ctx context.Context) ([]*Database, *v2.RateLimitDescription, error)
+	ListSandboxes(ctx context.Context) ([]*Sandbox, *v2.RateLimitDescription, error)
+	CreateSandbox(ctx context.Context, sandbox *Sandbox) (*Sandbox, *v2.RateLimitDescription, error)
+	DeleteSandbox(ctx context.Context, sandboxID string) (*v2.RateLimitDescription, error)
+	ListImpersonations(ctx context.Context) ([]*Impersonation, *v2.RateLimitDescription, error)
+	GetApplicationGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	UpdateApplicationGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	UpdatePermissionsGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	GetTableMetadata(ctx context.Context, tableID string) (*Table, *v2.RateLimitDescription, error)
+	GetDatabaseMetadata(ctx context.Context, databaseID int) (*DatabaseMetadata, *v2.RateLimitDescription, error)
+	RunQuery(ctx context.Context, query *DatasetQuery) (*DatasetResponse, *v2.RateLimitDescription, error)
+	GetSetting(ctx context.Context, key string) (any, *v2.RateLimitDescription, error)
+	UpdateSetting(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error)
+	ListAPIKeys(ctx context.Context) ([]*APIKey, *v2.RateLimitDescription, error)
+	CreateAPIKey(ctx context.Context, request *CreateAPIKeyRequest) (*APIKey, *v2.RateLimitDescription, error)
+	RegenerateAPIKey(ctx context.Context, keyID string) (*APIKey, *v2.RateLimitDescription, error)
+	DeleteAPIKey(ctx context.Context, keyID string) (*v2.RateLimitDescription, error)
 }
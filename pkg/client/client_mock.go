@@ -8,7 +8,9 @@ import (
 
 type MockService struct {
 	ListUsersFunc              func(ctx context.Context, options PageOptions) ([]*User, string, *v2.RateLimitDescription, error)
+	ListUsersPageFunc          func(ctx context.Context, options PageOptions) (*UsersQueryResponse, *v2.RateLimitDescription, error)
 	ListGroupsFunc             func(ctx context.Context) ([]*Group, *v2.RateLimitDescription, error)
+	ListGroupsPageFunc         func(ctx context.Context, options PageOptions) ([]*Group, string, *v2.RateLimitDescription, error)
 	ListMembershipsFunc        func(ctx context.Context) (map[string][]*Membership, *v2.RateLimitDescription, error)
 	IsPaidPlanFunc             func() bool
 	CreateUserFunc             func(ctx context.Context, request *CreateUserRequest) (*User, *v2.RateLimitDescription, error)
@@ -16,16 +18,54 @@ type MockService struct {
 	AddUserToGroupFunc         func(ctx context.Context, request *Membership) (*v2.RateLimitDescription, error)
 	RemoveUserFromGroupFunc    func(ctx context.Context, membershipID string) (*v2.RateLimitDescription, error)
 	GetUserByIDFunc            func(ctx context.Context, userID string) (*User, *v2.RateLimitDescription, error)
+	GetGroupByIDFunc           func(ctx context.Context, groupID string) (*Group, *v2.RateLimitDescription, error)
+	CreateGroupFunc            func(ctx context.Context, request *GroupRequest) (*Group, *v2.RateLimitDescription, error)
+	UpdateGroupFunc            func(ctx context.Context, groupID string, request *GroupRequest) (*Group, *v2.RateLimitDescription, error)
+	DeleteGroupFunc            func(ctx context.Context, groupID string) (*v2.RateLimitDescription, error)
+	GetPermissionsGraphFunc    func(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	GetCollectionGraphFunc     func(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	ListDatabasesFunc          func(ctx context.Context) ([]*Database, *v2.RateLimitDescription, error)
+	ListSandboxesFunc          func(ctx context.Context) ([]*Sandbox, *v2.RateLimitDescription, error)
+	CreateSandboxFunc          func(ctx context.Context, sandbox *Sandbox) (*Sandbox, *v2.RateLimitDescription, error)
+	DeleteSandboxFunc          func(ctx context.Context, sandboxID string) (*v2.RateLimitDescription, error)
+	ListImpersonationsFunc     func(ctx context.Context) ([]*Impersonation, *v2.RateLimitDescription, error)
+	GetApplicationGraphFunc    func(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	UpdateApplicationGraphFunc func(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	UpdatePermissionsGraphFunc func(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	GetTableMetadataFunc       func(ctx context.Context, tableID string) (*Table, *v2.RateLimitDescription, error)
+	GetDatabaseMetadataFunc    func(ctx context.Context, databaseID int) (*DatabaseMetadata, *v2.RateLimitDescription, error)
+	RunQueryFunc               func(ctx context.Context, query *DatasetQuery) (*DatasetResponse, *v2.RateLimitDescription, error)
+	GetSettingFunc             func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error)
+	UpdateSettingFunc          func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error)
+	ListAPIKeysFunc            func(ctx context.Context) ([]*APIKey, *v2.RateLimitDescription, error)
+	CreateAPIKeyFunc           func(ctx context.Context, request *CreateAPIKeyRequest) (*APIKey, *v2.RateLimitDescription, error)
+	RegenerateAPIKeyFunc       func(ctx context.Context, keyID string) (*APIKey, *v2.RateLimitDescription, error)
+	DeleteAPIKeyFunc           func(ctx context.Context, keyID string) (*v2.RateLimitDescription, error)
+	UpdateCollectionGraphFunc  func(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error)
+	UpdateMembershipFunc       func(ctx context.Context, membershipID string, isGroupManager bool) (*v2.RateLimitDescription, error)
 }
 
 func (m *MockService) ListUsers(ctx context.Context, options PageOptions) ([]*User, string, *v2.RateLimitDescription, error) {
 	return m.ListUsersFunc(ctx, options)
 }
 
+func (m *MockService) ListUsersPage(ctx context.Context, options PageOptions) (*UsersQueryResponse, *v2.RateLimitDescription, error) {
+	return m.ListUsersPageFunc(ctx, options)
+}
+
 func (m *MockService) ListGroups(ctx context.Context) ([]*Group, *v2.RateLimitDescription, error) {
 	return m.ListGroupsFunc(ctx)
 }
 
+// ListGroupsPage serves every group from ListGroupsFunc as a single page when ListGroupsPageFunc is not set.
+func (m *MockService) ListGroupsPage(ctx context.Context, options PageOptions) ([]*Group, string, *v2.RateLimitDescription, error) {
+	if m.ListGroupsPageFunc != nil {
+		return m.ListGroupsPageFunc(ctx, options)
+	}
+	groups, rateLimitDesc, err := m.ListGroupsFunc(ctx)
+	return groups, "", rateLimitDesc, err
+}
+
 func (m *MockService) ListMemberships(ctx context.Context) (map[string][]*Membership, *v2.RateLimitDescription, error) {
 	return m.ListMembershipsFunc(ctx)
 }
@@ -56,3 +96,106 @@ func (m *MockService) RemoveUserFromGroup(ctx context.Context, membershipID stri
 func (m *MockService) GetUserByID(ctx context.Context, userID string) (*User, *v2.RateLimitDescription, error) {
 	return m.GetUserByIDFunc(ctx, userID)
 }
+
+func (m *MockService) GetGroupByID(ctx context.Context, groupID string) (*Group, *v2.RateLimitDescription, error) {
+	return m.GetGroupByIDFunc(ctx, groupID)
+}
+
+func (m *MockService) GetPermissionsGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	return m.GetPermissionsGraphFunc(ctx)
+}
+
+func (m *MockService) GetDatabaseMetadata(ctx context.Context, databaseID int) (*DatabaseMetadata, *v2.RateLimitDescription, error) {
+	return m.GetDatabaseMetadataFunc(ctx, databaseID)
+}
+
+func (m *MockService) RunQuery(ctx context.Context, query *DatasetQuery) (*DatasetResponse, *v2.RateLimitDescription, error) {
+	return m.RunQueryFunc(ctx, query)
+}
+
+func (m *MockService) GetSetting(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+	if m.GetSettingFunc != nil {
+		return m.GetSettingFunc(ctx, key)
+	}
+	return nil, nil, nil
+}
+
+func (m *MockService) UpdateSetting(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+	return m.UpdateSettingFunc(ctx, key, value)
+}
+
+func (m *MockService) ListAPIKeys(ctx context.Context) ([]*APIKey, *v2.RateLimitDescription, error) {
+	return m.ListAPIKeysFunc(ctx)
+}
+
+func (m *MockService) CreateAPIKey(ctx context.Context, request *CreateAPIKeyRequest) (*APIKey, *v2.RateLimitDescription, error) {
+	return m.CreateAPIKeyFunc(ctx, request)
+}
+
+func (m *MockService) RegenerateAPIKey(ctx context.Context, keyID string) (*APIKey, *v2.RateLimitDescription, error) {
+	return m.RegenerateAPIKeyFunc(ctx, keyID)
+}
+
+func (m *MockService) DeleteAPIKey(ctx context.Context, keyID string) (*v2.RateLimitDescription, error) {
+	return m.DeleteAPIKeyFunc(ctx, keyID)
+}
+
+func (m *MockService) CreateGroup(ctx context.Context, request *GroupRequest) (*Group, *v2.RateLimitDescription, error) {
+	return m.CreateGroupFunc(ctx, request)
+}
+
+func (m *MockService) UpdateGroup(ctx context.Context, groupID string, request *GroupRequest) (*Group, *v2.RateLimitDescription, error) {
+	return m.UpdateGroupFunc(ctx, groupID, request)
+}
+
+func (m *MockService) DeleteGroup(ctx context.Context, groupID string) (*v2.RateLimitDescription, error) {
+	return m.DeleteGroupFunc(ctx, groupID)
+}
+
+func (m *MockService) GetCollectionGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	return m.GetCollectionGraphFunc(ctx)
+}
+
+func (m *MockService) ListDatabases(ctx context.Context) ([]*Database, *v2.RateLimitDescription, error) {
+	return m.ListDatabasesFunc(ctx)
+}
+
+func (m *MockService) ListSandboxes(ctx context.Context) ([]*Sandbox, *v2.RateLimitDescription, error) {
+	return m.ListSandboxesFunc(ctx)
+}
+
+func (m *MockService) CreateSandbox(ctx context.Context, sandbox *Sandbox) (*Sandbox, *v2.RateLimitDescription, error) {
+	return m.CreateSandboxFunc(ctx, sandbox)
+}
+
+func (m *MockService) DeleteSandbox(ctx context.Context, sandboxID string) (*v2.RateLimitDescription, error) {
+	return m.DeleteSandboxFunc(ctx, sandboxID)
+}
+
+func (m *MockService) UpdatePermissionsGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	return m.UpdatePermissionsGraphFunc(ctx, graph)
+}
+
+func (m *MockService) GetTableMetadata(ctx context.Context, tableID string) (*Table, *v2.RateLimitDescription, error) {
+	return m.GetTableMetadataFunc(ctx, tableID)
+}
+
+func (m *MockService) ListImpersonations(ctx context.Context) ([]*Impersonation, *v2.RateLimitDescription, error) {
+	return m.ListImpersonationsFunc(ctx)
+}
+
+func (m *MockService) GetApplicationGraph(ctx context.Context) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	return m.GetApplicationGraphFunc(ctx)
+}
+
+func (m *MockService) UpdateApplicationGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	return m.UpdateApplicationGraphFunc(ctx, graph)
+}
+
+func (m *MockService) UpdateCollectionGraph(ctx context.Context, graph *PermissionsGraph) (*PermissionsGraph, *v2.RateLimitDescription, error) {
+	return m.UpdateCollectionGraphFunc(ctx, graph)
+}
+
+func (m *MockService) UpdateMembership(ctx context.Context, membershipID string, isGroupManager bool) (*v2.RateLimitDescription, error) {
+	return m.UpdateMembershipFunc(ctx, membershipID, isGroupManager)
+}
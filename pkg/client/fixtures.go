@@ -0,0 +1,287 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+const redactedValue = "REDACTED"
+
+// sensitiveFieldMarkers are matched against lower-cased JSON keys of recorded bodies.
+// Any key containing one of them has its value replaced before it is written to disk.
+var sensitiveFieldMarkers = []string{
+	"password",
+	"secret",
+	"token",
+	"unmasked_key",
+	"api_key",
+	"api-key",
+	"keystore",
+}
+
+// Fixture is a single recorded HTTP exchange between MetabaseClient and Metabase.
+// Fixtures are stored one per line (JSON Lines) so a recording survives a crashed sync.
+type Fixture struct {
+	Method         string              `json:"method"`
+	Path           string              `json:"path"`
+	Query          string              `json:"query,omitempty"`
+	RequestHeader  map[string][]string `json:"request_header,omitempty"`
+	RequestBody    json.RawMessage     `json:"request_body,omitempty"`
+	Status         int                 `json:"status"`
+	ResponseHeader map[string][]string `json:"response_header,omitempty"`
+	ResponseBody   json.RawMessage     `json:"response_body,omitempty"`
+	// ResponseText holds bodies that are not JSON, such as Metabase's plain text "Not found.".
+	ResponseText string `json:"response_text,omitempty"`
+}
+
+// recordingTransport tees every exchange into a fixture file before handing the response back.
+type recordingTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	// file is nil once the recording is closed; later exchanges are passed through unrecorded.
+	file *os.File
+}
+
+func newRecordingTransport(next http.RoundTripper, path string) (*recordingTransport, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture file %s: %w", path, err)
+	}
+
+	return &recordingTransport{
+		next: next,
+		file: file,
+	}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture := Fixture{
+		Method:         req.Method,
+		Path:           req.URL.Path,
+		Query:          req.URL.RawQuery,
+		RequestHeader:  uhttp.RedactSensitiveHeaders(req.Header),
+		Status:         resp.StatusCode,
+		ResponseHeader: uhttp.RedactSensitiveHeaders(resp.Header),
+	}
+	fixture.RequestBody, _ = redactBody(reqBody)
+	fixture.ResponseBody, fixture.ResponseText = redactBody(respBody)
+	if err := t.write(fixture); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (t *recordingTransport) write(fixture Fixture) error {
+	line, err := json.Marshal(fixture)
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	if _, err := t.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the recording to disk and closes the fixture file.
+func (t *recordingTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	file := t.file
+	t.file = nil
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to sync fixture file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close fixture file: %w", err)
+	}
+	return nil
+}
+
+// ReplayTransport serves previously recorded fixtures instead of talking to Metabase.
+// Exchanges are matched on method, path and query. Repeated requests are answered in
+// recording order, and the last recorded answer is reused once a request's queue runs out.
+type ReplayTransport struct {
+	mu       sync.Mutex
+	fixtures map[string][]Fixture
+	served   map[string]int
+}
+
+// NewReplayTransport loads a fixture file written by a recording client.
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	t := &ReplayTransport{
+		fixtures: make(map[string][]Fixture),
+		served:   make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var fixture Fixture
+		if err := json.Unmarshal(line, &fixture); err != nil {
+			return nil, fmt.Errorf("failed to decode fixture: %w", err)
+		}
+		key := fixtureKey(fixture.Method, fixture.Path, fixture.Query)
+		t.fixtures[key] = append(t.fixtures[key], fixture)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fixture file %s: %w", path, err)
+	}
+
+	return t, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	key := fixtureKey(req.Method, req.URL.Path, req.URL.RawQuery)
+
+	t.mu.Lock()
+	recorded := t.fixtures[key]
+	idx := t.served[key]
+	if idx < len(recorded)-1 {
+		t.served[key] = idx + 1
+	}
+	t.mu.Unlock()
+
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("no recorded fixture for %s", key)
+	}
+	fixture := recorded[idx]
+
+	header := make(http.Header, len(fixture.ResponseHeader))
+	for k, v := range fixture.ResponseHeader {
+		header[k] = append([]string(nil), v...)
+	}
+
+	body := []byte(fixture.ResponseBody)
+	if fixture.ResponseText != "" {
+		body = []byte(fixture.ResponseText)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func fixtureKey(method, path, query string) string {
+	if query == "" {
+		return method + " " + path
+	}
+	return method + " " + path + "?" + query
+}
+
+// redactBody masks sensitive JSON fields. Bodies that are not JSON are returned as text instead,
+// since they cannot carry structured secrets.
+func redactBody(body []byte) (json.RawMessage, string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, ""
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, string(body)
+	}
+
+	redacted, err := json.Marshal(redactValue(decoded))
+	if err != nil {
+		return nil, ""
+	}
+	return redacted, ""
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if isSensitiveField(key) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redactValue(inner)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactValue(inner)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isSensitiveField(key string) bool {
+	lower := strings.ToLower(key)
+	for _, marker := range sensitiveFieldMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
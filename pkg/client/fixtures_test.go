@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/metabasetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixtureRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("BATON_HTTP_CACHE_TTL", "0")
+	fixturePath := filepath.Join(t.TempDir(), "fixtures.jsonl")
+
+	srv := metabasetest.NewServer()
+	srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	srv.AddUser("bob.smith@example.com", "Bob", "Smith")
+	baseURL := srv.URL
+
+	recorder, err := New(ctx, baseURL, srv.APIKey, false, WithFixtureRecording(fixturePath))
+	require.NoError(t, err)
+
+	recordedUsers, _, _, err := recorder.ListUsers(ctx, PageOptions{})
+	require.NoError(t, err)
+	require.Len(t, recordedUsers, 2)
+
+	_, _, err = recorder.CreateUser(ctx, &CreateUserRequest{
+		Email:     "carl.jones@example.com",
+		FirstName: "Carl",
+		LastName:  "Jones",
+		Password:  "super-secret-password",
+	})
+	require.NoError(t, err)
+
+	_, _, err = recorder.GetUserByID(ctx, "999")
+	require.Error(t, err)
+	require.NoError(t, recorder.Close())
+	require.NoError(t, recorder.Close(), "closing twice is harmless")
+	srv.Close()
+
+	t.Run("recording redacts credentials", func(t *testing.T) {
+		raw, err := os.ReadFile(fixturePath)
+		require.NoError(t, err)
+		require.NotContains(t, string(raw), metabasetest.DefaultAPIKey)
+		require.NotContains(t, string(raw), "super-secret-password")
+		require.Contains(t, string(raw), redactedValue)
+	})
+
+	t.Run("replay serves the recording offline", func(t *testing.T) {
+		replay, err := NewReplayTransport(fixturePath)
+		require.NoError(t, err)
+
+		offline, err := New(ctx, baseURL, "", false, WithTransport(replay))
+		require.NoError(t, err)
+
+		users, _, _, err := offline.ListUsers(ctx, PageOptions{})
+		require.NoError(t, err)
+		require.Equal(t, recordedUsers, users)
+
+		_, _, err = offline.GetUserByID(ctx, "999")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status 404")
+		require.Contains(t, err.Error(), "Not found.")
+
+		_, _, err = offline.GetUserByID(ctx, "1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no recorded fixture for GET /api/user/1")
+	})
+}
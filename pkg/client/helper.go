@@ -42,7 +42,8 @@ func withQueryParam(key string, value string) ReqOpt {
 	}
 }
 
-func getNextPageToken(offset, limit, total int) string {
+// NextPageToken returns the offset of the next page as a page token while pages remain, otherwise "".
+func NextPageToken(offset, limit, total int) string {
 	if offset+limit < total {
 		return strconv.Itoa(offset + limit)
 	}
@@ -1,18 +1,30 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
 // User represents a Metabase user entity returned by the API.
 type User struct {
-	ID        int        `json:"id"`
-	Email     string     `json:"email"`
-	FirstName string     `json:"first_name"`
-	LastName  string     `json:"last_name"`
-	IsActive  bool       `json:"is_active"`
-	LastLogin *time.Time `json:"last_login"`
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	FirstName  string     `json:"first_name"`
+	LastName   string     `json:"last_name"`
+	IsActive   bool       `json:"is_active"`
+	LastLogin  *time.Time `json:"last_login"`
+	DateJoined *time.Time `json:"date_joined"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+	// UserType is "personal" for people and "api-key" for the users Metabase creates for API keys.
+	// Versions before 49 do not return it.
+	UserType string `json:"user_type"`
+	// SSOSource is the SSO method that created the user ("google", "ldap", "saml" or "jwt"), if any.
+	SSOSource  *string `json:"sso_source"`
+	GoogleAuth bool    `json:"google_auth"`
+	LDAPAuth   bool    `json:"ldap_auth"`
 }
 
 // UsersQueryResponse models the paginated response for user listings in Metabase.
@@ -40,21 +52,177 @@ type Membership struct {
 }
 
 // Group represents a group entity in Metabase.
+// Members is only populated when a single group is fetched by ID.
 type Group struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	MemberCount int    `json:"member_count"`
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	MemberCount int           `json:"member_count"`
+	Members     []*Membership `json:"members,omitempty"`
+}
+
+// GroupRequest is the body used to create or rename a group.
+type GroupRequest struct {
+	Name string `json:"name"`
+}
+
+// APIKey represents a Metabase API key. Each key acts as a user that belongs to exactly one group.
+// UnmaskedKey is only returned when a key is created or regenerated.
+type APIKey struct {
+	ID          int         `json:"id"`
+	Name        string      `json:"name"`
+	MaskedKey   string      `json:"masked_key"`
+	UnmaskedKey string      `json:"unmasked_key,omitempty"`
+	Group       APIKeyGroup `json:"group"`
+	CreatorID   int         `json:"creator_id"`
+	UpdatedBy   *APIKeyUser `json:"updated_by"`
+	CreatedAt   *time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time  `json:"updated_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name    string `json:"name"`
+	GroupID int    `json:"group_id"`
+}
+
+type APIKeyGroup struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type APIKeyUser struct {
+	ID         int    `json:"id"`
+	CommonName string `json:"common_name"`
+}
+
+// PermissionsGraph is the revisioned data permissions graph returned by /api/permissions/graph.
+// Groups maps a group ID to that group's permissions document, keyed by database ID.
+type PermissionsGraph struct {
+	Revision int                       `json:"revision"`
+	Groups   map[string]map[string]any `json:"groups"`
+}
+
+// GroupCopy returns a deep copy of the permissions document of groupID, empty when the graph has
+// none, so it can be edited without touching the graph.
+func (g *PermissionsGraph) GroupCopy(groupID string) (map[string]any, error) {
+	out := make(map[string]any)
+	doc := g.Groups[groupID]
+	if doc == nil {
+		return out, nil
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy permissions of group %s: %w", groupID, err)
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("failed to copy permissions of group %s: %w", groupID, err)
+	}
+	return out, nil
+}
+
+// Database is a database connected to Metabase, as listed by /api/database.
+type Database struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Engine string `json:"engine"`
+}
+
+// DatabasesResponse is the envelope /api/database wraps the database list in.
+type DatabasesResponse struct {
+	Data  []*Database `json:"data"`
+	Total int         `json:"total"`
+}
+
+// Sandbox is a group table access policy (GTAP): the rows of a table a group is limited to.
+// CardID is the saved question that replaces the table, if any, and AttributeRemappings maps
+// user attributes to the table columns or question parameters they filter on.
+type Sandbox struct {
+	ID                  int            `json:"id,omitempty"`
+	GroupID             int            `json:"group_id"`
+	TableID             int            `json:"table_id"`
+	CardID              *int           `json:"card_id"`
+	AttributeRemappings map[string]any `json:"attribute_remappings"`
+}
+
+// Impersonation is a connection impersonation policy: members of the group query the database
+// as the database role named by the value of their Attribute user attribute.
+type Impersonation struct {
+	ID        int    `json:"id"`
+	GroupID   int    `json:"group_id"`
+	DBID      int    `json:"db_id"`
+	Attribute string `json:"attribute"`
+}
+
+// DatabaseMetadata is the subset of /api/database/{id}/metadata needed to build queries.
+type DatabaseMetadata struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Tables []*Table `json:"tables"`
+}
+
+type Table struct {
+	ID          int      `json:"id"`
+	DBID        int      `json:"db_id"`
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Schema      string   `json:"schema"`
+	Fields      []*Field `json:"fields"`
+}
+
+type Field struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// DatasetQuery is the body of POST /api/dataset. Query holds an MBQL query.
+type DatasetQuery struct {
+	Database int            `json:"database"`
+	Type     string         `json:"type"`
+	Query    map[string]any `json:"query"`
+}
+
+// DatasetResponse is the result of POST /api/dataset. Metabase reports query failures
+// with a 202 and Status "failed" rather than an HTTP error.
+type DatasetResponse struct {
+	Status string      `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Data   DatasetData `json:"data"`
+}
+
+type DatasetData struct {
+	Cols []*DatasetColumn `json:"cols"`
+	Rows [][]any          `json:"rows"`
+	// RowsTruncated is set to the row limit when Metabase cut the result short.
+	RowsTruncated int `json:"rows_truncated,omitempty"`
+}
+
+type DatasetColumn struct {
+	Name string `json:"name"`
 }
 
 type ErrorResponse struct {
-	MessageText string `json:"message,omitempty"`
-	Status      int    `json:"status,omitempty"`
+	MessageText string            `json:"message,omitempty"`
+	Status      int               `json:"status,omitempty"`
+	Errors      map[string]string `json:"errors,omitempty"`
 }
 
 func (e *ErrorResponse) Message() string {
 	if e.MessageText != "" {
 		return e.MessageText
 	}
+	// Validation failures come back as a map of field name to message instead of a single message.
+	if len(e.Errors) > 0 {
+		fields := make([]string, 0, len(e.Errors))
+		for field := range e.Errors {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		parts := make([]string, 0, len(fields))
+		for _, field := range fields {
+			parts = append(parts, fmt.Sprintf("%s: %s", field, e.Errors[field]))
+		}
+		return strings.Join(parts, "; ")
+	}
 	return fmt.Sprintf("status code: %d", e.Status)
 }
 
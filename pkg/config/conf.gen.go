@@ -4,9 +4,19 @@ package config
 import "reflect"
 
 type Metabase struct {
-	MetabaseBaseUrl      string `mapstructure:"metabase-base-url"`
-	MetabaseApiKey       string `mapstructure:"metabase-api-key"`
-	MetabaseWithPaidPlan bool   `mapstructure:"metabase-with-paid-plan"`
+	MetabaseBaseUrl                    string   `mapstructure:"metabase-base-url"`
+	MetabaseApiKey                     string   `mapstructure:"metabase-api-key"`
+	MetabaseWithPaidPlan               bool     `mapstructure:"metabase-with-paid-plan"`
+	MetabaseRecordFixtures             string   `mapstructure:"metabase-record-fixtures"`
+	MetabaseUserPageConcurrency        int      `mapstructure:"metabase-user-page-concurrency"`
+	MetabaseQueryActivity              bool     `mapstructure:"metabase-query-activity"`
+	MetabaseApiKeyUsers                string   `mapstructure:"metabase-api-key-users"`
+	MetabaseProtectSsoMappedGroups     bool     `mapstructure:"metabase-protect-sso-mapped-groups"`
+	MetabaseGroupIncludeRegex          string   `mapstructure:"metabase-group-include-regex"`
+	MetabaseGroupExcludeRegex          string   `mapstructure:"metabase-group-exclude-regex"`
+	MetabaseGroupIncludeIds            []string `mapstructure:"metabase-group-include-ids"`
+	MetabaseGroupExcludeIds            []string `mapstructure:"metabase-group-exclude-ids"`
+	MetabaseSandboxAttributeRemappings []string `mapstructure:"metabase-sandbox-attribute-remappings"`
 }
 
 func (c *Metabase) findFieldByTag(tagValue string) (any, bool) {
@@ -41,11 +51,13 @@ func (c *Metabase) GetString(fieldName string) string {
 	if !ok {
 		return ""
 	}
-	t, ok := v.(string)
-	if !ok {
-		panic("wrong type")
+	if t, ok := v.(string); ok {
+		return t
 	}
-	return t
+	if t, ok := v.([]byte); ok {
+		return string(t)
+	}
+	panic("wrong type")
 }
 
 func (c *Metabase) GetInt(fieldName string) int {
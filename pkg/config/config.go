@@ -4,6 +4,12 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/field"
 )
 
+// Values of MetabaseApiKeyUsers.
+const (
+	APIKeyUsersService = "service"
+	APIKeyUsersSkip    = "skip"
+)
+
 var (
 	MetabaseBaseUrl = field.StringField(
 		"metabase-base-url",
@@ -27,11 +33,87 @@ var (
 		field.WithDefaultValue(false),
 	)
 
+	MetabaseRecordFixtures = field.StringField(
+		"metabase-record-fixtures",
+		field.WithDescription("Debug only: path of a file to record every Metabase API request and response to, with credentials redacted"),
+		field.WithDisplayName("Record API fixtures"),
+		field.WithExportTarget(field.ExportTargetCLIOnly),
+	)
+
+	MetabaseUserPageConcurrency = field.IntField(
+		"metabase-user-page-concurrency",
+		field.WithDescription("Number of user pages to fetch in parallel during sync. 1 fetches pages one at a time"),
+		field.WithDisplayName("User page concurrency"),
+		field.WithDefaultValue(1),
+	)
+
+	MetabaseQueryActivity = field.BoolField(
+		"metabase-query-activity",
+		field.WithDescription("Paid plans only: add last_query_at and query_count_90d to user profiles from the usage analytics query log"),
+		field.WithDisplayName("Query activity"),
+		field.WithDefaultValue(false),
+	)
+
+	MetabaseApiKeyUsers = field.SelectField(
+		"metabase-api-key-users",
+		[]string{APIKeyUsersService, APIKeyUsersSkip},
+		field.WithDescription("How to sync the internal users Metabase creates for API keys: \"service\" syncs them as service accounts, \"skip\" leaves them out of the user list"),
+		field.WithDisplayName("API key users"),
+		field.WithDefaultValue(APIKeyUsersService),
+	)
+
+	MetabaseProtectSsoMappedGroups = field.BoolField(
+		"metabase-protect-sso-mapped-groups",
+		field.WithDescription("Mark groups filled from IdP groups through SAML, JWT or LDAP group mappings as not directly provisionable, since Metabase overwrites their membership at the next login"),
+		field.WithDisplayName("Protect SSO mapped groups"),
+		field.WithDefaultValue(false),
+	)
+
+	MetabaseGroupIncludeRegex = field.StringField(
+		"metabase-group-include-regex",
+		field.WithDescription("Only sync groups whose name matches this regular expression, in addition to any listed in metabase-group-include-ids"),
+		field.WithDisplayName("Include groups matching"),
+	)
+
+	MetabaseGroupExcludeRegex = field.StringField(
+		"metabase-group-exclude-regex",
+		field.WithDescription("Leave out groups whose name matches this regular expression, along with their memberships"),
+		field.WithDisplayName("Exclude groups matching"),
+	)
+
+	MetabaseGroupIncludeIds = field.StringSliceField(
+		"metabase-group-include-ids",
+		field.WithDescription("Only sync the groups with these IDs, in addition to any matching metabase-group-include-regex"),
+		field.WithDisplayName("Include group IDs"),
+	)
+
+	MetabaseGroupExcludeIds = field.StringSliceField(
+		"metabase-group-exclude-ids",
+		field.WithDescription("Leave out the groups with these IDs, along with their memberships"),
+		field.WithDisplayName("Exclude group IDs"),
+	)
+
+	MetabaseSandboxAttributeRemappings = field.StringSliceField(
+		"metabase-sandbox-attribute-remappings",
+		field.WithDescription("Paid plans only: user attribute to column remappings for sandboxes created through the connector, as attribute=table.column, e.g. region=orders.region. The table may be schema qualified"),
+		field.WithDisplayName("Sandbox attribute remappings"),
+	)
+
 	// ConfigurationFields defines the external configuration required for the connector to run.
 	ConfigurationFields = []field.SchemaField{
 		MetabaseBaseUrl,
 		MetabaseApiKey,
 		MetabaseWithPaidPlan,
+		MetabaseRecordFixtures,
+		MetabaseUserPageConcurrency,
+		MetabaseQueryActivity,
+		MetabaseApiKeyUsers,
+		MetabaseProtectSsoMappedGroups,
+		MetabaseGroupIncludeRegex,
+		MetabaseGroupExcludeRegex,
+		MetabaseGroupIncludeIds,
+		MetabaseGroupExcludeIds,
+		MetabaseSandboxAttributeRemappings,
 	}
 
 	// FieldRelationships defines relationships between the fields listed in
@@ -43,6 +125,7 @@ var (
 
 //go:generate go run ./gen
 var Config = field.NewConfiguration(ConfigurationFields,
+	field.WithConstraints(FieldRelationships...),
 	field.WithConnectorDisplayName("Metabase"),
 	field.WithHelpUrl("/docs/baton/metabase"),
 	field.WithIconUrl("/static/app-icons/metabase.svg"),
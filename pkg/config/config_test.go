@@ -21,6 +21,46 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid config - skip api key users",
+			config: &Metabase{
+				MetabaseApiKey:      "some-api-key",
+				MetabaseBaseUrl:     "https://metabase-example",
+				MetabaseApiKeyUsers: APIKeyUsersSkip,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid config - unknown api key users mode",
+			config: &Metabase{
+				MetabaseApiKey:      "some-api-key",
+				MetabaseBaseUrl:     "https://metabase-example",
+				MetabaseApiKeyUsers: "hide",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config - group filters",
+			config: &Metabase{
+				MetabaseApiKey:            "some-api-key",
+				MetabaseBaseUrl:           "https://metabase-example",
+				MetabaseGroupIncludeRegex: "^team-",
+				MetabaseGroupExcludeRegex: "^tenant-",
+				MetabaseGroupIncludeIds:   []string{"2"},
+				MetabaseGroupExcludeIds:   []string{"7", "8"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid config - sandbox attribute remappings",
+			config: &Metabase{
+				MetabaseApiKey:                     "some-api-key",
+				MetabaseBaseUrl:                    "https://metabase-example",
+				MetabaseWithPaidPlan:               true,
+				MetabaseSandboxAttributeRemappings: []string{"tenant=public.orders.tenant_id"},
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid config - missing required fields",
 			config: &Metabase{
@@ -16,10 +16,229 @@ import (
 )
 
 const (
-	ActionEnableUser  = "enable_user"
-	ActionDisableUser = "disable_user"
+	ActionEnableUser             = "enable_user"
+	ActionDisableUser            = "disable_user"
+	ActionAddSSOGroupMapping     = "add_sso_group_mapping"
+	ActionRemoveSSOGroupMapping  = "remove_sso_group_mapping"
+	ActionRenameGroup            = "rename_group"
+	ActionDeleteGroup            = "delete_group"
+	ActionEffectivePermissions   = "effective_permissions"
+	ActionBulkUpdateGroupMembers = "bulk_update_group_members"
+	ActionCreateAPIKey           = "create_api_key"
 )
 
+// administratorsGroupID is the built-in Administrators group every Metabase instance has.
+const administratorsGroupID = 2
+
+var ssoGroupMappingArguments = []*config.Field{
+	{
+		Name:        "source",
+		DisplayName: "SSO source",
+		Description: "The SSO method whose mappings to change: saml, jwt or ldap",
+		Field:       &config.Field_StringField{},
+		IsRequired:  true,
+	},
+	{
+		Name:        "idpGroup",
+		DisplayName: "IdP group",
+		Description: "The group name as sent by the identity provider, or the group DN for LDAP",
+		Field:       &config.Field_StringField{},
+		IsRequired:  true,
+	},
+	{
+		Name:        "groupId",
+		DisplayName: "Group ID",
+		Description: "The ID of the Metabase group",
+		Field:       &config.Field_StringField{},
+		IsRequired:  true,
+	},
+}
+
+var AddSSOGroupMappingAction = &v2.BatonActionSchema{
+	Name:      ActionAddSSOGroupMapping,
+	Arguments: ssoGroupMappingArguments,
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+	},
+}
+
+var RemoveSSOGroupMappingAction = &v2.BatonActionSchema{
+	Name:      ActionRemoveSSOGroupMapping,
+	Arguments: ssoGroupMappingArguments,
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+	},
+}
+
+var RenameGroupAction = &v2.BatonActionSchema{
+	Name: ActionRenameGroup,
+	Arguments: []*config.Field{
+		{
+			Name:        "groupId",
+			DisplayName: "Group ID",
+			Field:       &config.Field_StringField{},
+			IsRequired:  true,
+		},
+		{
+			Name:        "name",
+			DisplayName: "New name",
+			Field:       &config.Field_StringField{},
+			IsRequired:  true,
+		},
+	},
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+	},
+	ActionType: []v2.ActionType{
+		v2.ActionType_ACTION_TYPE_DYNAMIC,
+	},
+}
+
+var DeleteGroupAction = &v2.BatonActionSchema{
+	Name: ActionDeleteGroup,
+	Arguments: []*config.Field{
+		{
+			Name:        "groupId",
+			DisplayName: "Group ID",
+			Field:       &config.Field_StringField{},
+			IsRequired:  true,
+		},
+		{
+			Name:        "force",
+			DisplayName: "Force",
+			Description: "Delete the group even if it still has data or collection permissions",
+			Field:       &config.Field_BoolField{},
+		},
+	},
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+	},
+	ActionType: []v2.ActionType{
+		v2.ActionType_ACTION_TYPE_RESOURCE_DELETE,
+	},
+}
+
+var EffectivePermissionsAction = &v2.BatonActionSchema{
+	Name: ActionEffectivePermissions,
+	Arguments: []*config.Field{
+		{
+			Name:        "userId",
+			DisplayName: "User ID",
+			Field:       &config.Field_StringField{},
+			IsRequired:  true,
+		},
+	},
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "groups",
+			DisplayName: "Groups",
+			Description: "The groups of the user",
+			Field:       &config.Field_StringSliceField{},
+		},
+		{
+			Name:        "permissions",
+			DisplayName: "Permissions",
+			Description: "The most permissive level the user holds per database, schema, collection and application permission, with the groups that supply it",
+			Field:       &config.Field_StringSliceField{},
+		},
+	},
+}
+
+var BulkUpdateGroupMembersAction = &v2.BatonActionSchema{
+	Name: ActionBulkUpdateGroupMembers,
+	Arguments: []*config.Field{
+		{
+			Name:        "groupId",
+			DisplayName: "Group ID",
+			Field:       &config.Field_StringField{},
+			IsRequired:  true,
+		},
+		{
+			Name:        "add",
+			DisplayName: "Add",
+			Description: "The IDs or emails of the users to add to the group",
+			Field:       &config.Field_StringSliceField{},
+		},
+		{
+			Name:        "remove",
+			DisplayName: "Remove",
+			Description: "The IDs or emails of the users to remove from the group",
+			Field:       &config.Field_StringSliceField{},
+		},
+	},
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Description: "Whether every user was added or removed, or already had the requested membership",
+			Field:       &config.Field_BoolField{},
+		},
+		{
+			Name:        "results",
+			DisplayName: "Results",
+			Description: "The outcome for each user, in the order given",
+			Field:       &config.Field_StringSliceField{},
+		},
+	},
+}
+
+var CreateAPIKeyAction = &v2.BatonActionSchema{
+	Name: ActionCreateAPIKey,
+	Arguments: []*config.Field{
+		{
+			Name:        "name",
+			DisplayName: "Name",
+			Field:       &config.Field_StringField{},
+			IsRequired:  true,
+		},
+		{
+			Name:        "groupId",
+			DisplayName: "Group ID",
+			Description: "The ID of the group the key belongs to",
+			Field:       &config.Field_StringField{},
+			IsRequired:  true,
+		},
+	},
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+		{
+			Name:        "apiKeyId",
+			DisplayName: "API key ID",
+			Field:       &config.Field_StringField{},
+		},
+		{
+			Name:        "apiKey",
+			DisplayName: "API key",
+			Description: "The full key, which Metabase never shows again",
+			Field:       &config.Field_StringField{},
+			IsSecret:    true,
+		},
+	},
+	ActionType: []v2.ActionType{
+		v2.ActionType_ACTION_TYPE_RESOURCE_CREATE,
+	},
+}
+
 var EnableUserAction = &v2.BatonActionSchema{
 	Name: ActionEnableUser,
 	Arguments: []*config.Field{
@@ -79,6 +298,41 @@ func (c *Connector) RegisterActionManager(ctx context.Context) (connectorbuilder
 		return nil, err
 	}
 
+	err = actionManager.RegisterAction(ctx, AddSSOGroupMappingAction.Name, AddSSOGroupMappingAction, c.AddSSOGroupMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	err = actionManager.RegisterAction(ctx, RemoveSSOGroupMappingAction.Name, RemoveSSOGroupMappingAction, c.RemoveSSOGroupMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	err = actionManager.RegisterAction(ctx, RenameGroupAction.Name, RenameGroupAction, c.RenameGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	err = actionManager.RegisterAction(ctx, DeleteGroupAction.Name, DeleteGroupAction, c.DeleteGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	err = actionManager.RegisterAction(ctx, EffectivePermissionsAction.Name, EffectivePermissionsAction, c.EffectivePermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = actionManager.RegisterAction(ctx, BulkUpdateGroupMembersAction.Name, BulkUpdateGroupMembersAction, c.BulkUpdateGroupMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = actionManager.RegisterAction(ctx, CreateAPIKeyAction.Name, CreateAPIKeyAction, c.CreateAPIKey)
+	if err != nil {
+		return nil, err
+	}
+
 	return actionManager, nil
 }
 
@@ -0,0 +1,68 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// CreateAPIKey creates an API key in a group. API keys are not created through account provisioning:
+// the SDK publishes a single account creation schema and credential options for the whole connector,
+// and those describe users. Metabase only shows the full key in this response, so it is returned as a
+// secret field for storage.
+func (c *Connector) CreateAPIKey(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+
+	groupID, err := groupIDArg(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	group, err := strconv.Atoi(groupID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid groupId %q: %w", groupID, err)
+	}
+
+	name := strings.TrimSpace(args.Fields["name"].GetStringValue())
+	if name == "" {
+		return nil, nil, fmt.Errorf("name cannot be empty")
+	}
+
+	l.Info("creating api key", zap.String("name", name), zap.String("groupId", groupID))
+
+	key, rateLimitDesc, err := c.client.CreateAPIKey(ctx, &client.CreateAPIKeyRequest{
+		Name:    name,
+		GroupID: group,
+	})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ann, fmt.Errorf("group %s does not exist", groupID)
+		}
+		return nil, ann, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	if key.UnmaskedKey == "" {
+		return nil, ann, fmt.Errorf("metabase did not return the unmasked key for api key %d", key.ID)
+	}
+
+	response := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"success":  structpb.NewBoolValue(true),
+			"apiKeyId": structpb.NewStringValue(strconv.Itoa(key.ID)),
+			"apiKey":   structpb.NewStringValue(key.UnmaskedKey),
+		},
+	}
+	return response, ann, nil
+}
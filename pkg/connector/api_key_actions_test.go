@@ -0,0 +1,78 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestCreateAPIKeyAction(t *testing.T) {
+	ctx := context.Background()
+	connector, mockClient := newTestConnector()
+
+	t.Run("creates the key and returns it once", func(t *testing.T) {
+		mockClient.CreateAPIKeyFunc = func(ctx context.Context, request *client.CreateAPIKeyRequest) (*client.APIKey, *v2.RateLimitDescription, error) {
+			require.Equal(t, &client.CreateAPIKeyRequest{Name: "dbt exporter", GroupID: 3}, request)
+			return &client.APIKey{
+				ID:          4,
+				Name:        request.Name,
+				MaskedKey:   "mb_AbCd********",
+				UnmaskedKey: "mb_AbCdEfGh",
+				Group:       client.APIKeyGroup{ID: 3, Name: "Analysts"},
+			}, nil, nil
+		}
+
+		args, err := structpb.NewStruct(map[string]interface{}{"name": "dbt exporter", "groupId": "3"})
+		require.NoError(t, err)
+
+		resp, _, err := connector.CreateAPIKey(ctx, args)
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, "4", resp.Fields["apiKeyId"].GetStringValue())
+		require.Equal(t, "mb_AbCdEfGh", resp.Fields["apiKey"].GetStringValue())
+	})
+
+	t.Run("requires a name and a group", func(t *testing.T) {
+		mockClient.CreateAPIKeyFunc = func(ctx context.Context, request *client.CreateAPIKeyRequest) (*client.APIKey, *v2.RateLimitDescription, error) {
+			t.Fatal("no key should be created")
+			return nil, nil, nil
+		}
+
+		for _, fields := range []map[string]interface{}{
+			{"groupId": "3"},
+			{"name": "dbt exporter"},
+			{"name": "dbt exporter", "groupId": "analysts"},
+		} {
+			args, err := structpb.NewStruct(fields)
+			require.NoError(t, err)
+
+			_, _, err = connector.CreateAPIKey(ctx, args)
+			require.Error(t, err)
+		}
+	})
+
+	t.Run("fails for a missing group", func(t *testing.T) {
+		mockClient.CreateAPIKeyFunc = func(ctx context.Context, request *client.CreateAPIKeyRequest) (*client.APIKey, *v2.RateLimitDescription, error) {
+			return nil, nil, status.Error(codes.NotFound, "group not found")
+		}
+
+		args, err := structpb.NewStruct(map[string]interface{}{"name": "dbt exporter", "groupId": "99"})
+		require.NoError(t, err)
+
+		_, _, err = connector.CreateAPIKey(ctx, args)
+		require.ErrorContains(t, err, "group 99 does not exist")
+	})
+}
+
+func TestAPIKeysAreNotAccountProvisioned(t *testing.T) {
+	var builder interface{} = newAPIKeyBuilder(&client.MockService{})
+	_, ok := builder.(connectorbuilder.AccountManagerLimited)
+	require.False(t, ok)
+}
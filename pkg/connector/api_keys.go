@@ -0,0 +1,187 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type apiKeyBuilder struct {
+	client client.ClientService
+}
+
+func (a *apiKeyBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return APIKeyResourceType
+}
+
+// List returns every API key. Instances older than Metabase 49 have no API keys endpoint,
+// in which case there is nothing to sync.
+func (a *apiKeyBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	keys, rateLimitDesc, err := a.client.ListAPIKeys(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			ctxzap.Extract(ctx).Info("api keys are not supported by this Metabase instance", zap.Error(err))
+			return nil, "", ann, nil
+		}
+		return nil, "", ann, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	outResources := make([]*v2.Resource, 0, len(keys))
+	for _, key := range keys {
+		res, err := a.parseIntoAPIKeyResource(key)
+		if err != nil {
+			return nil, "", ann, err
+		}
+		outResources = append(outResources, res)
+	}
+
+	return outResources, "", ann, nil
+}
+
+// Entitlements always returns an empty slice for API keys.
+func (a *apiKeyBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants returns the membership of the key in its group. A key belongs to exactly one group,
+// which is kept in the resource profile so no extra request is needed.
+func (a *apiKeyBuilder) Grants(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	userTrait, err := resourceSdk.GetUserTrait(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	groupID, ok := resourceSdk.GetProfileInt64Value(userTrait.GetProfile(), "group_id")
+	if !ok {
+		return nil, "", nil, nil
+	}
+
+	groupResource := &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: GroupResourceType.Id,
+			Resource:     strconv.FormatInt(groupID, 10),
+		},
+	}
+
+	return []*v2.Grant{grant.NewGrant(groupResource, MemberPermission, resource.Id)}, "", nil, nil
+}
+
+func (a *apiKeyBuilder) RotateCapabilityDetails(_ context.Context) (*v2.CredentialDetailsCredentialRotation, annotations.Annotations, error) {
+	return &v2.CredentialDetailsCredentialRotation{
+		SupportedCredentialOptions: []v2.CapabilityDetailCredentialOption{
+			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_API_KEY,
+		},
+		PreferredCredentialOption: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_API_KEY,
+	}, nil, nil
+}
+
+// Rotate regenerates the key. The previous key stops working immediately.
+func (a *apiKeyBuilder) Rotate(ctx context.Context, resourceId *v2.ResourceId, _ *v2.LocalCredentialOptions) ([]*v2.PlaintextData, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	key, rateLimitDesc, err := a.client.RegenerateAPIKey(ctx, resourceId.Resource)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	plaintexts, err := apiKeyPlaintexts(key)
+	if err != nil {
+		return nil, ann, err
+	}
+
+	return plaintexts, ann, nil
+}
+
+// Delete removes the key. A key that no longer exists is treated as deleted.
+func (a *apiKeyBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	ann := annotations.New()
+
+	rateLimitDesc, err := a.client.DeleteAPIKey(ctx, resourceId.Resource)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			ctxzap.Extract(ctx).Info("api key is already deleted", zap.String("api_key_id", resourceId.Resource))
+			return ann, nil
+		}
+		return ann, err
+	}
+
+	return ann, nil
+}
+
+// apiKeyPlaintexts returns the unmasked key of a key that was just created or regenerated.
+func apiKeyPlaintexts(key *client.APIKey) ([]*v2.PlaintextData, error) {
+	if key.UnmaskedKey == "" {
+		return nil, fmt.Errorf("metabase did not return the unmasked key for api key %d", key.ID)
+	}
+
+	return []*v2.PlaintextData{
+		{
+			Name:  "api_key",
+			Bytes: []byte(key.UnmaskedKey),
+		},
+	}, nil
+}
+
+func (a *apiKeyBuilder) parseIntoAPIKeyResource(key *client.APIKey) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":       key.Name,
+		"masked_key": key.MaskedKey,
+		"group_id":   key.Group.ID,
+		"group_name": key.Group.Name,
+		"creator_id": key.CreatorID,
+	}
+	if key.UpdatedBy != nil {
+		profile["updated_by"] = key.UpdatedBy.CommonName
+	}
+	if key.CreatedAt != nil {
+		profile["created_at"] = key.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if key.UpdatedAt != nil {
+		profile["updated_at"] = key.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	traitOptions := []resourceSdk.UserTraitOption{
+		resourceSdk.WithUserProfile(profile),
+		resourceSdk.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE),
+		resourceSdk.WithStatus(v2.UserTrait_Status_STATUS_ENABLED),
+	}
+	if key.CreatedAt != nil {
+		traitOptions = append(traitOptions, resourceSdk.WithCreatedAt(*key.CreatedAt))
+	}
+
+	return resourceSdk.NewUserResource(
+		key.Name,
+		APIKeyResourceType,
+		key.ID,
+		traitOptions,
+	)
+}
+
+func newAPIKeyBuilder(client client.ClientService) *apiKeyBuilder {
+	return &apiKeyBuilder{
+		client: client,
+	}
+}
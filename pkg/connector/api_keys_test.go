@@ -0,0 +1,127 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKeysList(t *testing.T) {
+	ctx := context.Background()
+	createdAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("should list api keys as service accounts", func(t *testing.T) {
+		mockClient := &client.MockService{
+			ListAPIKeysFunc: func(ctx context.Context) ([]*client.APIKey, *v2.RateLimitDescription, error) {
+				return []*client.APIKey{{
+					ID:        4,
+					Name:      "dbt exporter",
+					MaskedKey: "mb_AbCd********",
+					Group:     client.APIKeyGroup{ID: 2, Name: "Administrators"},
+					CreatorID: 1,
+					UpdatedBy: &client.APIKeyUser{ID: 1, CommonName: "Ana Gomez"},
+					CreatedAt: &createdAt,
+					UpdatedAt: &createdAt,
+				}}, nil, nil
+			},
+		}
+		builder := newAPIKeyBuilder(mockClient)
+
+		resources, next, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Empty(t, next)
+		require.Len(t, resources, 1)
+		require.Equal(t, "dbt exporter", resources[0].DisplayName)
+		require.Equal(t, &v2.ResourceId{ResourceType: APIKeyResourceType.Id, Resource: "4"}, resources[0].Id)
+
+		trait, err := resourceSdk.GetUserTrait(resources[0])
+		require.NoError(t, err)
+		require.Equal(t, v2.UserTrait_ACCOUNT_TYPE_SERVICE, trait.GetAccountType())
+
+		profile := trait.GetProfile().AsMap()
+		require.Equal(t, "mb_AbCd********", profile["masked_key"])
+		require.Equal(t, "Administrators", profile["group_name"])
+		require.Equal(t, "Ana Gomez", profile["updated_by"])
+		require.Equal(t, "2025-06-01T09:00:00Z", profile["created_at"])
+
+		grants, _, _, err := builder.Grants(ctx, resources[0], &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		require.Equal(t, "group:2:member", grants[0].Entitlement.Id)
+		require.Equal(t, resources[0].Id, grants[0].Principal.Id)
+	})
+
+	t.Run("should return nothing when api keys are not supported", func(t *testing.T) {
+		mockClient := &client.MockService{
+			ListAPIKeysFunc: func(ctx context.Context) ([]*client.APIKey, *v2.RateLimitDescription, error) {
+				return nil, nil, fmt.Errorf("failed to fetch api keys: %w", status.Error(codes.NotFound, "not found"))
+			},
+		}
+
+		resources, _, _, err := newAPIKeyBuilder(mockClient).List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Empty(t, resources)
+	})
+
+	t.Run("should return error if API fails", func(t *testing.T) {
+		mockClient := &client.MockService{
+			ListAPIKeysFunc: func(ctx context.Context) ([]*client.APIKey, *v2.RateLimitDescription, error) {
+				return nil, &v2.RateLimitDescription{Limit: 10}, fmt.Errorf("API error")
+			},
+		}
+
+		_, _, ann, err := newAPIKeyBuilder(mockClient).List(ctx, nil, &pagination.Token{})
+		require.ErrorContains(t, err, "failed to list api keys: API error")
+		require.NotNil(t, ann)
+	})
+}
+
+func TestAPIKeysProvisioning(t *testing.T) {
+	ctx := context.Background()
+	keyID := &v2.ResourceId{ResourceType: APIKeyResourceType.Id, Resource: "4"}
+
+	t.Run("should rotate by regenerating the key", func(t *testing.T) {
+		mockClient := &client.MockService{
+			RegenerateAPIKeyFunc: func(ctx context.Context, id string) (*client.APIKey, *v2.RateLimitDescription, error) {
+				require.Equal(t, "4", id)
+				return &client.APIKey{ID: 4, UnmaskedKey: "mb_NewKey"}, &v2.RateLimitDescription{Limit: 10}, nil
+			},
+		}
+
+		plaintexts, ann, err := newAPIKeyBuilder(mockClient).Rotate(ctx, keyID, nil)
+		require.NoError(t, err)
+		require.NotNil(t, ann)
+		require.Equal(t, "mb_NewKey", string(plaintexts[0].Bytes))
+	})
+
+	t.Run("should fail rotation when no key is returned", func(t *testing.T) {
+		mockClient := &client.MockService{
+			RegenerateAPIKeyFunc: func(ctx context.Context, id string) (*client.APIKey, *v2.RateLimitDescription, error) {
+				return &client.APIKey{ID: 4}, nil, nil
+			},
+		}
+
+		_, _, err := newAPIKeyBuilder(mockClient).Rotate(ctx, keyID, nil)
+		require.ErrorContains(t, err, "did not return the unmasked key")
+	})
+
+	t.Run("should treat a missing key as deleted", func(t *testing.T) {
+		mockClient := &client.MockService{
+			DeleteAPIKeyFunc: func(ctx context.Context, id string) (*v2.RateLimitDescription, error) {
+				return nil, fmt.Errorf("failed to delete api key 4: %w", status.Error(codes.NotFound, "not found"))
+			},
+		}
+
+		_, err := newAPIKeyBuilder(mockClient).Delete(ctx, keyID)
+		require.NoError(t, err)
+	})
+}
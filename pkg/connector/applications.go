@@ -0,0 +1,220 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// Application permissions, named as in the application permissions graph.
+const (
+	SettingPermission      = "setting"
+	MonitoringPermission   = "monitoring"
+	SubscriptionPermission = "subscription"
+)
+
+// applicationResourceID is the ID of the single application resource.
+const applicationResourceID = "metabase"
+
+// Values of an application permission in the graph.
+const (
+	applicationPermissionYes = "yes"
+	applicationPermissionNo  = "no"
+)
+
+var applicationPermissions = []struct {
+	name        string
+	displayName string
+	description string
+}{
+	{SettingPermission, "Settings", "Manages the admin settings of Metabase"},
+	{MonitoringPermission, "Monitoring", "Uses the monitoring tools of Metabase: tools, audit, troubleshooting and database routing"},
+	{SubscriptionPermission, "Subscriptions", "Creates dashboard subscriptions and alerts in Metabase"},
+}
+
+// applicationBuilder syncs the application permissions of groups on the Metabase instance.
+type applicationBuilder struct {
+	client client.ClientService
+	// groupFilter is nil unless groups are filtered; permissions of filtered out groups are not granted.
+	groupFilter *groupFilter
+}
+
+func (a *applicationBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return ApplicationResourceType
+}
+
+func (a *applicationBuilder) List(_ context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	res, err := resourceSdk.NewResource("Metabase", ApplicationResourceType, applicationResourceID)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return []*v2.Resource{res}, "", nil, nil
+}
+
+func (a *applicationBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	entitlements := make([]*v2.Entitlement, 0, len(applicationPermissions))
+	for _, permission := range applicationPermissions {
+		entitlements = append(entitlements, entitlement.NewPermissionEntitlement(resource, permission.name,
+			entitlement.WithGrantableTo(GroupResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, permission.displayName)),
+			entitlement.WithDescription(permission.description),
+		))
+	}
+
+	return entitlements, "", nil, nil
+}
+
+// Grants reports a grant for every application permission set to yes for a group in the application
+// permissions graph. Members of the group inherit it.
+func (a *applicationBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	graph, rateLimitDesc, err := a.client.GetApplicationGraph(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+
+	groupAllowed, rateLimitDesc, err := a.groupFilter.allowedGroups(ctx, a.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+
+	groupIDs := make([]int, 0, len(graph.Groups))
+	for key := range graph.Groups {
+		groupID, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, "", ann, fmt.Errorf("invalid group id %q in application permissions graph: %w", key, err)
+		}
+		if groupAllowed(groupID) {
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+	sort.Ints(groupIDs)
+
+	var grants []*v2.Grant
+	for _, groupID := range groupIDs {
+		groupResource := &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: GroupResourceType.Id,
+				Resource:     strconv.Itoa(groupID),
+			},
+		}
+		perms := graph.Groups[groupResource.Id.Resource]
+		for _, permission := range applicationPermissions {
+			if perms[permission.name] != applicationPermissionYes {
+				continue
+			}
+			grants = append(grants, grant.NewGrant(
+				resource,
+				permission.name,
+				groupResource.Id,
+				grant.WithAnnotation(&v2.GrantExpandable{
+					EntitlementIds: []string{entitlement.NewEntitlementID(groupResource, MemberPermission)},
+				}),
+			))
+		}
+	}
+
+	return grants, "", ann, nil
+}
+
+func (a *applicationBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	return a.setPermission(ctx, principal, entitlement, applicationPermissionYes)
+}
+
+func (a *applicationBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	return a.setPermission(ctx, grant.Principal, grant.Entitlement, applicationPermissionNo)
+}
+
+// setPermission sets an application permission of a group through a revisioned update of the
+// application permissions graph, so a concurrent change made in Metabase is never overwritten.
+func (a *applicationBuilder) setPermission(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement, value string) (annotations.Annotations, error) {
+	ann := annotations.New()
+
+	if principal.Id.ResourceType != GroupResourceType.Id {
+		return nil, fmt.Errorf("application permissions can only be granted to groups, got %s", principal.Id.ResourceType)
+	}
+	groupID := principal.Id.Resource
+	if groupID == strconv.Itoa(administratorsGroupID) {
+		return nil, fmt.Errorf("the application permissions of the Administrators group cannot be changed")
+	}
+
+	permission, err := applicationPermission(entitlement.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, rateLimitDesc, err := a.client.GetApplicationGraph(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	granted := graph.Groups[groupID][permission] == applicationPermissionYes
+	switch {
+	case granted && value == applicationPermissionYes:
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
+	case !granted && value == applicationPermissionNo:
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	}
+
+	// The whole group document is sent, as Metabase replaces the permissions of every group in the update.
+	perms := make(map[string]any, len(graph.Groups[groupID])+1)
+	for name, v := range graph.Groups[groupID] {
+		perms[name] = v
+	}
+	perms[permission] = value
+
+	updated, rateLimitDesc, err := a.client.UpdateApplicationGraph(ctx, &client.PermissionsGraph{
+		Revision: graph.Revision,
+		Groups:   map[string]map[string]any{groupID: perms},
+	})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	if got := updated.Groups[groupID][permission]; got != value {
+		return ann, fmt.Errorf("application permissions graph shows %s %v instead of %q for group %s", permission, got, value, groupID)
+	}
+
+	return ann, nil
+}
+
+// applicationPermission returns the application permission an entitlement ID refers to.
+func applicationPermission(entitlementID string) (string, error) {
+	for _, permission := range applicationPermissions {
+		if strings.HasSuffix(entitlementID, ":"+permission.name) || entitlementID == permission.name {
+			return permission.name, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported entitlement id %q", entitlementID)
+}
+
+func newApplicationBuilder(client client.ClientService, groupFilter *groupFilter) *applicationBuilder {
+	return &applicationBuilder{
+		client:      client,
+		groupFilter: groupFilter,
+	}
+}
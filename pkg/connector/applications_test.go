@@ -0,0 +1,137 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplicationEntitlementsAndGrants(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &client.MockService{
+		GetApplicationGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Revision: 3, Groups: map[string]map[string]any{
+				"4": {"setting": "no", "monitoring": "yes", "subscription": "yes"},
+				"3": {"setting": "yes", "monitoring": "no", "subscription": "no"},
+			}}, nil, nil
+		},
+	}
+
+	resources, _, _, err := newApplicationBuilder(mockClient, nil).List(ctx, nil, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	application := resources[0]
+	require.Equal(t, "metabase", application.Id.Resource)
+
+	t.Run("one entitlement per application permission", func(t *testing.T) {
+		entitlements, _, _, err := newApplicationBuilder(mockClient, nil).Entitlements(ctx, application, &pagination.Token{})
+		require.NoError(t, err)
+		ids := make([]string, 0, len(entitlements))
+		for _, e := range entitlements {
+			ids = append(ids, e.Id)
+		}
+		require.Equal(t, []string{"application:metabase:setting", "application:metabase:monitoring", "application:metabase:subscription"}, ids)
+	})
+
+	t.Run("grants for permissions set to yes", func(t *testing.T) {
+		grants, _, _, err := newApplicationBuilder(mockClient, nil).Grants(ctx, application, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 3)
+
+		require.Equal(t, "application:metabase:setting", grants[0].Entitlement.Id)
+		require.Equal(t, "3", grants[0].Principal.Id.Resource)
+		require.Equal(t, "application:metabase:monitoring", grants[1].Entitlement.Id)
+		require.Equal(t, "4", grants[1].Principal.Id.Resource)
+
+		annos := annotations.Annotations(grants[0].Annotations)
+		expandable := &v2.GrantExpandable{}
+		ok, err := annos.Pick(expandable)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []string{"group:3:member"}, expandable.EntitlementIds)
+	})
+
+	t.Run("permissions of filtered out groups are left out", func(t *testing.T) {
+		filter, err := newGroupFilter("", "", nil, []string{"4"})
+		require.NoError(t, err)
+
+		grants, _, _, err := newApplicationBuilder(mockClient, filter).Grants(ctx, application, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+	})
+
+	t.Run("rate limit returned", func(t *testing.T) {
+		failing := &client.MockService{
+			GetApplicationGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				return nil, &v2.RateLimitDescription{Limit: 10}, fmt.Errorf("rate limit error")
+			},
+		}
+
+		_, _, ann, err := newApplicationBuilder(failing, nil).Grants(ctx, application, &pagination.Token{})
+		require.Error(t, err)
+		require.NotEmpty(t, ann)
+	})
+}
+
+func TestApplicationGrantRevoke(t *testing.T) {
+	ctx := context.Background()
+	application := &v2.Resource{Id: &v2.ResourceId{ResourceType: ApplicationResourceType.Id, Resource: "metabase"}}
+	group := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "3"}}
+	setting := &v2.Entitlement{Id: "application:metabase:setting", Resource: application}
+
+	newMock := func(updated *client.PermissionsGraph) *client.MockService {
+		return &client.MockService{
+			GetApplicationGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				return &client.PermissionsGraph{Revision: 3, Groups: map[string]map[string]any{
+					"3": {"setting": "no", "monitoring": "yes", "subscription": "no"},
+				}}, nil, nil
+			},
+			UpdateApplicationGraphFunc: func(ctx context.Context, graph *client.PermissionsGraph) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				require.Equal(t, 3, graph.Revision)
+				require.Equal(t, map[string]any{"setting": "yes", "monitoring": "yes", "subscription": "no"}, graph.Groups["3"])
+				return updated, nil, nil
+			},
+		}
+	}
+
+	t.Run("grant sends the group document with the current revision", func(t *testing.T) {
+		mockClient := newMock(&client.PermissionsGraph{Revision: 4, Groups: map[string]map[string]any{"3": {"setting": "yes"}}})
+		ann, err := newApplicationBuilder(mockClient, nil).Grant(ctx, group, setting)
+		require.NoError(t, err)
+		require.False(t, ann.Contains(&v2.GrantAlreadyExists{}))
+	})
+
+	t.Run("grant fails when the graph does not show the permission", func(t *testing.T) {
+		mockClient := newMock(&client.PermissionsGraph{Revision: 4, Groups: map[string]map[string]any{"3": {"setting": "no"}}})
+		_, err := newApplicationBuilder(mockClient, nil).Grant(ctx, group, setting)
+		require.ErrorContains(t, err, "instead of")
+	})
+
+	t.Run("already granted and already revoked", func(t *testing.T) {
+		mockClient := newMock(nil)
+		ann, err := newApplicationBuilder(mockClient, nil).Grant(ctx, group, &v2.Entitlement{Id: "application:metabase:monitoring", Resource: application})
+		require.NoError(t, err)
+		require.True(t, ann.Contains(&v2.GrantAlreadyExists{}))
+
+		ann, err = newApplicationBuilder(mockClient, nil).Revoke(ctx, &v2.Grant{Principal: group, Entitlement: setting})
+		require.NoError(t, err)
+		require.True(t, ann.Contains(&v2.GrantAlreadyRevoked{}))
+	})
+
+	t.Run("administrators and users are refused", func(t *testing.T) {
+		mockClient := newMock(nil)
+		admins := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "2"}}
+		_, err := newApplicationBuilder(mockClient, nil).Grant(ctx, admins, setting)
+		require.Error(t, err)
+
+		user := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: "3"}}
+		_, err = newApplicationBuilder(mockClient, nil).Grant(ctx, user, setting)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,81 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// auditDatabaseID is the fixed ID of the internal audit database that paid plans expose.
+	auditDatabaseID = 13371337
+
+	auditLogTable = "v_audit_log"
+	queryLogTable = "v_query_log"
+)
+
+// auditTable is a view of the internal audit database, with its field IDs keyed by lower-cased name.
+type auditTable struct {
+	id     int
+	fields map[string]int
+}
+
+// field returns an MBQL reference to one of the view's fields.
+func (t *auditTable) field(name string) []any {
+	return []any{"field", t.fields[name], nil}
+}
+
+// findAuditTable looks up a view of the internal audit database. It returns nil without an error
+// when the audit database or the view is not available, which is the case on free plans.
+func findAuditTable(ctx context.Context, c client.ClientService, name string) (*auditTable, *v2.RateLimitDescription, error) {
+	if !c.IsPaidPlan() {
+		return nil, nil, nil
+	}
+
+	metadata, rateLimitDesc, err := c.GetDatabaseMetadata(ctx, auditDatabaseID)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound, codes.PermissionDenied:
+			ctxzap.Extract(ctx).Info("audit database is not available", zap.String("table", name), zap.Error(err))
+			return nil, rateLimitDesc, nil
+		default:
+			return nil, rateLimitDesc, fmt.Errorf("failed to look up audit table %s: %w", name, err)
+		}
+	}
+
+	for _, table := range metadata.Tables {
+		if !strings.EqualFold(table.Name, name) {
+			continue
+		}
+		fields := make(map[string]int, len(table.Fields))
+		for _, field := range table.Fields {
+			fields[strings.ToLower(field.Name)] = field.ID
+		}
+		return &auditTable{id: table.ID, fields: fields}, rateLimitDesc, nil
+	}
+
+	ctxzap.Extract(ctx).Info("audit database has no such table", zap.String("table", name))
+	return nil, rateLimitDesc, nil
+}
+
+// datasetRows returns the rows of a query result as maps keyed by lower-cased column name.
+func datasetRows(resp *client.DatasetResponse) []map[string]any {
+	rows := make([]map[string]any, 0, len(resp.Data.Rows))
+	for _, row := range resp.Data.Rows {
+		out := make(map[string]any, len(resp.Data.Cols))
+		for i, col := range resp.Data.Cols {
+			if i < len(row) {
+				out[strings.ToLower(col.Name)] = row[i]
+			}
+		}
+		rows = append(rows, out)
+	}
+	return rows
+}
@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Normalized values of the auth_source profile key.
+const (
+	authSourcePassword = "password"
+	authSourceGoogle   = "google"
+	authSourceLDAP     = "ldap"
+	authSourceSAML     = "saml"
+	authSourceJWT      = "jwt"
+	authSourceAPIKey   = "api_key"
+)
+
+// ssoSettingKeys maps the admin setting that enables each SSO method to its auth source.
+var ssoSettingKeys = []struct {
+	setting string
+	source  string
+}{
+	{"google-auth-enabled", authSourceGoogle},
+	{"ldap-enabled", authSourceLDAP},
+	{"saml-enabled", authSourceSAML},
+	{"jwt-enabled", authSourceJWT},
+}
+
+const passwordLoginSetting = "enable-password-login"
+
+// ssoSettings describes how people can sign in to the instance.
+type ssoSettings struct {
+	// enabled lists the SSO methods turned on, as auth sources.
+	enabled []string
+	// passwordLogin is false when Metabase only allows SSO logins.
+	passwordLogin bool
+}
+
+// localPasswordRisk returns the annotation for a user that signs in with a local password,
+// or nil when the instance has no SSO, in which case passwords are expected.
+func (s *ssoSettings) localPasswordRisk() *v2.RiskFactor {
+	if s == nil || len(s.enabled) == 0 {
+		return nil
+	}
+
+	if !s.passwordLogin {
+		return &v2.RiskFactor{
+			Description: fmt.Sprintf("Local password account on an instance with SSO (%s) enforced; password login is currently disabled", strings.Join(s.enabled, ", ")),
+			Severity:    v2.RiskFactor_SEVERITY_LOW,
+		}
+	}
+	return &v2.RiskFactor{
+		Description: fmt.Sprintf("Local password account can bypass SSO (%s)", strings.Join(s.enabled, ", ")),
+		Severity:    v2.RiskFactor_SEVERITY_HIGH,
+	}
+}
+
+// instanceAuth caches the instance's SSO settings for the duration of a sync.
+type instanceAuth struct {
+	mu       sync.Mutex
+	loaded   bool
+	settings *ssoSettings
+}
+
+func newInstanceAuth() *instanceAuth {
+	return &instanceAuth{}
+}
+
+func (a *instanceAuth) load(ctx context.Context, c client.ClientService) (*v2.RateLimitDescription, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.loaded {
+		return nil, nil
+	}
+
+	settings, rateLimitDesc, err := fetchSSOSettings(ctx, c)
+	if err != nil {
+		return rateLimitDesc, err
+	}
+	a.loaded = true
+	a.settings = settings
+
+	return rateLimitDesc, nil
+}
+
+func (a *instanceAuth) current() *ssoSettings {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.settings
+}
+
+func (a *instanceAuth) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.loaded = false
+	a.settings = nil
+}
+
+// fetchSSOSettings reads the settings that enable each SSO method and password login.
+// Settings that an edition does not know about are treated as disabled.
+func fetchSSOSettings(ctx context.Context, c client.ClientService) (*ssoSettings, *v2.RateLimitDescription, error) {
+	var rateLimitDesc *v2.RateLimitDescription
+
+	read := func(key string, fallback bool) (bool, error) {
+		value, rl, err := c.GetSetting(ctx, key)
+		rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return fallback, nil
+			}
+			return false, err
+		}
+		return settingBool(value, fallback), nil
+	}
+
+	settings := &ssoSettings{}
+	for _, sso := range ssoSettingKeys {
+		enabled, err := read(sso.setting, false)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("failed to read sso settings: %w", err)
+		}
+		if enabled {
+			settings.enabled = append(settings.enabled, sso.source)
+		}
+	}
+
+	passwordLogin, err := read(passwordLoginSetting, true)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to read sso settings: %w", err)
+	}
+	settings.passwordLogin = passwordLogin
+
+	return settings, rateLimitDesc, nil
+}
+
+// settingBool interprets a boolean setting, which may come back as a JSON boolean or string.
+func settingBool(value any, fallback bool) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	default:
+		return fallback
+	}
+}
+
+// authSource normalizes how a user signs in.
+func authSource(user *client.User) string {
+	switch {
+	case user.SSOSource != nil && *user.SSOSource != "":
+		return strings.ToLower(*user.SSOSource)
+	case user.GoogleAuth:
+		return authSourceGoogle
+	case user.LDAPAuth:
+		return authSourceLDAP
+	case isAPIKeyUser(user):
+		return authSourceAPIKey
+	default:
+		return authSourcePassword
+	}
+}
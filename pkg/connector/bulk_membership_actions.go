@@ -0,0 +1,257 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// bulkMembershipConcurrency is the number of membership changes made in parallel by
+// bulk_update_group_members.
+const bulkMembershipConcurrency = 4
+
+// bulkMembershipUsersPageSize is the page size used to resolve IDs and emails to users.
+const bulkMembershipUsersPageSize = 100
+
+// membershipUpdate is one user to add to or remove from the group, as given in the arguments.
+type membershipUpdate struct {
+	input  string
+	add    bool
+	userID int
+	// membershipID is the user's current membership of the group, 0 when there is none.
+	membershipID int
+	result       string
+	failed       bool
+}
+
+// BulkUpdateGroupMembers adds users to and removes users from a group in one call. Users are given
+// by ID or email. Users and memberships are fetched once, the changes are made in parallel, and the
+// outcome is reported per user: a user that cannot be found or changed does not stop the others.
+func (c *Connector) BulkUpdateGroupMembers(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+
+	groupIDStr, err := groupIDArg(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid group id %q: %w", groupIDStr, err)
+	}
+	if groupID == allUsersGroupID {
+		return nil, nil, fmt.Errorf("group %s is All Users, which every user belongs to", groupIDStr)
+	}
+
+	updates, err := parseMembershipUpdates(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, rateLimitDesc, err := c.client.GetGroupByID(ctx, groupIDStr)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ann, fmt.Errorf("group %s does not exist", groupIDStr)
+		}
+		return nil, ann, fmt.Errorf("failed to get group %s: %w", groupIDStr, err)
+	}
+
+	rateLimitDesc, err = newGroupBuilder(c.client, c.groupOptions).checkNotSSOMapped(ctx, groupIDStr)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	rateLimitDesc, err = c.resolveMembershipUpdates(ctx, groupID, updates)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	l.Info("bulk updating group members", zap.String("groupId", groupIDStr), zap.Int("users", len(updates)))
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		rateLimit *v2.RateLimitDescription
+		throttled atomic.Bool
+		slots     = make(chan struct{}, bulkMembershipConcurrency)
+	)
+	for _, update := range updates {
+		if update.result != "" {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if throttled.Load() {
+				update.result, update.failed = "skipped: over the rate limit", true
+				return
+			}
+
+			var rateLimitDesc *v2.RateLimitDescription
+			var err error
+			result := "added"
+			if update.add {
+				rateLimitDesc, err = c.client.AddUserToGroup(ctx, &client.Membership{GroupID: groupID, UserID: update.userID})
+			} else {
+				rateLimitDesc, err = c.client.RemoveUserFromGroup(ctx, strconv.Itoa(update.membershipID))
+				result = "removed"
+			}
+			if isOverRateLimit(rateLimitDesc) {
+				throttled.Store(true)
+			}
+			if err != nil {
+				l.Error("failed to update group membership", zap.String("groupId", groupIDStr), zap.Int("userId", update.userID), zap.Error(err))
+				update.result, update.failed = "failed: "+err.Error(), true
+			} else {
+				update.result = result
+			}
+
+			mu.Lock()
+			rateLimit = mostRestrictiveRateLimit(rateLimit, rateLimitDesc)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if rateLimit != nil {
+		ann.WithRateLimiting(rateLimit)
+	}
+
+	results := make([]*structpb.Value, 0, len(updates))
+	success := true
+	for _, update := range updates {
+		success = success && !update.failed
+		results = append(results, structpb.NewStringValue(update.input+": "+update.result))
+	}
+
+	response := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"success": structpb.NewBoolValue(success),
+			"results": structpb.NewListValue(&structpb.ListValue{Values: results}),
+		},
+	}
+	return response, ann, nil
+}
+
+// parseMembershipUpdates reads the add and remove arguments. A user may appear in only one of them.
+func parseMembershipUpdates(args *structpb.Struct) ([]*membershipUpdate, error) {
+	var updates []*membershipUpdate
+	seen := make(map[string]string)
+	for _, argument := range []string{"add", "remove"} {
+		for _, value := range args.Fields[argument].GetListValue().GetValues() {
+			input := strings.TrimSpace(value.GetStringValue())
+			if input == "" {
+				return nil, fmt.Errorf("%s cannot contain empty user IDs or emails", argument)
+			}
+			key := strings.ToLower(input)
+			if previous, ok := seen[key]; ok {
+				if previous != argument {
+					return nil, fmt.Errorf("user %s is listed in both add and remove", input)
+				}
+				continue
+			}
+			seen[key] = argument
+			updates = append(updates, &membershipUpdate{input: input, add: argument == "add"})
+		}
+	}
+
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("add or remove must list at least one user")
+	}
+	return updates, nil
+}
+
+// resolveMembershipUpdates finds the user of each update and the user's current membership of the
+// group. Updates that need no change, whose user cannot be found or belongs to an API key, or whose
+// user was already given by another ID or email, get their result here.
+func (c *Connector) resolveMembershipUpdates(ctx context.Context, groupID int, updates []*membershipUpdate) (*v2.RateLimitDescription, error) {
+	var rateLimit *v2.RateLimitDescription
+
+	users := make(map[int]*client.User)
+	emails := make(map[string]*client.User)
+	for offset := 0; ; offset += bulkMembershipUsersPageSize {
+		page, rateLimitDesc, err := c.client.ListUsersPage(ctx, client.PageOptions{Limit: bulkMembershipUsersPageSize, Offset: offset})
+		rateLimit = mostRestrictiveRateLimit(rateLimit, rateLimitDesc)
+		if err != nil {
+			return rateLimit, fmt.Errorf("failed to list users: %w", err)
+		}
+		for _, user := range page.Data {
+			users[user.ID] = user
+			emails[strings.ToLower(user.Email)] = user
+		}
+		if len(page.Data) == 0 || offset+len(page.Data) >= page.Total {
+			break
+		}
+	}
+
+	memberships, rateLimitDesc, err := c.client.ListMemberships(ctx)
+	rateLimit = mostRestrictiveRateLimit(rateLimit, rateLimitDesc)
+	if err != nil {
+		return rateLimit, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	resolved := make(map[int]*membershipUpdate)
+	for _, update := range updates {
+		var user *client.User
+		if userID, err := strconv.Atoi(update.input); err == nil {
+			if user = users[userID]; user == nil {
+				update.result, update.failed = "failed: no user has this ID", true
+				continue
+			}
+		} else if user = emails[strings.ToLower(update.input)]; user == nil {
+			update.result, update.failed = "failed: no user has this email", true
+			continue
+		}
+		if isAPIKeyUser(user) {
+			update.result, update.failed = "failed: the user belongs to an api key, whose group can only be changed in Metabase", true
+			continue
+		}
+		update.userID = user.ID
+
+		if first, ok := resolved[update.userID]; ok {
+			if first.add != update.add {
+				return rateLimit, fmt.Errorf("user %d is listed in both add and remove, as %s and %s", update.userID, first.input, update.input)
+			}
+			update.result = "same user as " + first.input
+			continue
+		}
+		resolved[update.userID] = update
+
+		for _, m := range memberships[strconv.Itoa(update.userID)] {
+			if m.GroupID == groupID {
+				update.membershipID = m.MembershipID
+				break
+			}
+		}
+		switch {
+		case update.add && update.membershipID != 0:
+			update.result = "already a member"
+		case !update.add && update.membershipID == 0:
+			update.result = "not a member"
+		}
+	}
+
+	return rateLimit, nil
+}
@@ -0,0 +1,275 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func bulkUpdateArgs(groupID string, add, remove []any) *structpb.Struct {
+	args, _ := structpb.NewStruct(map[string]interface{}{"groupId": groupID, "add": add, "remove": remove})
+	return args
+}
+
+func resultStrings(resp *structpb.Struct) []string {
+	var out []string
+	for _, v := range resp.Fields["results"].GetListValue().GetValues() {
+		out = append(out, v.GetStringValue())
+	}
+	return out
+}
+
+func TestBulkUpdateGroupMembersAction(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func() (*Connector, *client.MockService, *atomic.Int32) {
+		connector, mockClient := newTestConnector()
+		var membershipLists atomic.Int32
+
+		mockClient.GetGroupByIDFunc = func(ctx context.Context, groupID string) (*client.Group, *v2.RateLimitDescription, error) {
+			if groupID == "99" {
+				return nil, nil, status.Error(codes.NotFound, "group not found")
+			}
+			return &client.Group{ID: 3, Name: "Analysts"}, nil, nil
+		}
+		users := []*client.User{
+			{ID: 4, Email: "ada@example.com"},
+			{ID: 5, Email: "grace@example.com"},
+			{ID: 6, Email: "linus@example.com"},
+			{ID: 7, Email: "alan@example.com"},
+			{ID: 8, Email: "edsger@example.com"},
+			{ID: 9, Email: "api-key-user-1@api-key.invalid", UserType: apiKeyUserType},
+		}
+		for i := 10; i < 30; i++ {
+			users = append(users, &client.User{ID: i, Email: fmt.Sprintf("user%d@example.com", i)})
+		}
+		mockClient.ListUsersPageFunc = func(ctx context.Context, options client.PageOptions) (*client.UsersQueryResponse, *v2.RateLimitDescription, error) {
+			return &client.UsersQueryResponse{Data: users, Total: len(users)}, nil, nil
+		}
+		mockClient.ListMembershipsFunc = func(ctx context.Context) (map[string][]*client.Membership, *v2.RateLimitDescription, error) {
+			membershipLists.Add(1)
+			return map[string][]*client.Membership{
+				"5": {{MembershipID: 50, GroupID: 3, UserID: 5}},
+				"6": {{MembershipID: 60, GroupID: 3, UserID: 6}, {MembershipID: 61, GroupID: 7, UserID: 6}},
+			}, nil, nil
+		}
+		return connector, mockClient, &membershipLists
+	}
+
+	t.Run("adds and removes users by id or email", func(t *testing.T) {
+		connector, mockClient, membershipLists := setup()
+
+		var mu sync.Mutex
+		var added []int
+		var removed []string
+		mockClient.AddUserToGroupFunc = func(ctx context.Context, request *client.Membership) (*v2.RateLimitDescription, error) {
+			require.Equal(t, 3, request.GroupID)
+			require.False(t, request.IsGroupManager)
+			mu.Lock()
+			defer mu.Unlock()
+			added = append(added, request.UserID)
+			return nil, nil
+		}
+		mockClient.RemoveUserFromGroupFunc = func(ctx context.Context, membershipID string) (*v2.RateLimitDescription, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			removed = append(removed, membershipID)
+			return nil, nil
+		}
+
+		resp, _, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3",
+			[]any{"ADA@example.com", "5", "nobody@example.com"},
+			[]any{"linus@example.com", "8"},
+		))
+		require.NoError(t, err)
+		require.False(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, []string{
+			"ADA@example.com: added",
+			"5: already a member",
+			"nobody@example.com: failed: no user has this email",
+			"linus@example.com: removed",
+			"8: not a member",
+		}, resultStrings(resp))
+		require.Equal(t, []int{4}, added)
+		require.Equal(t, []string{"60"}, removed)
+		require.Equal(t, int32(1), membershipLists.Load())
+	})
+
+	t.Run("a user given by id and email is changed once", func(t *testing.T) {
+		connector, mockClient, _ := setup()
+		var adds atomic.Int32
+		mockClient.AddUserToGroupFunc = func(ctx context.Context, request *client.Membership) (*v2.RateLimitDescription, error) {
+			require.Equal(t, 4, request.UserID)
+			adds.Add(1)
+			return nil, nil
+		}
+
+		resp, _, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", []any{"4", "ada@example.com"}, nil))
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, []string{"4: added", "ada@example.com: same user as 4"}, resultStrings(resp))
+		require.Equal(t, int32(1), adds.Load())
+
+		_, _, err = connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", []any{"4"}, []any{"ada@example.com"}))
+		require.ErrorContains(t, err, "user 4 is listed in both add and remove, as 4 and ada@example.com")
+	})
+
+	t.Run("unknown users and api key users are not changed", func(t *testing.T) {
+		connector, mockClient, _ := setup()
+		mockClient.AddUserToGroupFunc = func(ctx context.Context, request *client.Membership) (*v2.RateLimitDescription, error) {
+			t.Fatalf("user %d should not be added", request.UserID)
+			return nil, nil
+		}
+
+		resp, _, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", []any{"99", "9", "api-key-user-1@api-key.invalid"}, nil))
+		require.NoError(t, err)
+		require.False(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, []string{
+			"99: failed: no user has this ID",
+			"9: failed: the user belongs to an api key, whose group can only be changed in Metabase",
+			"api-key-user-1@api-key.invalid: failed: the user belongs to an api key, whose group can only be changed in Metabase",
+		}, resultStrings(resp))
+	})
+
+	t.Run("a failed change is not reported as made", func(t *testing.T) {
+		connector, mockClient, _ := setup()
+		mockClient.RemoveUserFromGroupFunc = func(ctx context.Context, membershipID string) (*v2.RateLimitDescription, error) {
+			return nil, fmt.Errorf("internal server error")
+		}
+
+		resp, _, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", nil, []any{"5"}))
+		require.NoError(t, err)
+		require.False(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, []string{"5: failed: internal server error"}, resultStrings(resp))
+	})
+
+	t.Run("changes run with bounded concurrency", func(t *testing.T) {
+		connector, mockClient, _ := setup()
+		mockClient.ListMembershipsFunc = func(ctx context.Context) (map[string][]*client.Membership, *v2.RateLimitDescription, error) {
+			return nil, nil, nil
+		}
+
+		var inFlight, maxInFlight atomic.Int32
+		mockClient.AddUserToGroupFunc = func(ctx context.Context, request *client.Membership) (*v2.RateLimitDescription, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			if request.UserID == 13 {
+				return nil, fmt.Errorf("user not found")
+			}
+			return nil, nil
+		}
+
+		var add []any
+		for i := 10; i < 30; i++ {
+			add = append(add, strconv.Itoa(i))
+		}
+		resp, _, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", add, nil))
+		require.NoError(t, err)
+		require.False(t, resp.Fields["success"].GetBoolValue())
+		results := resultStrings(resp)
+		require.Len(t, results, 20)
+		require.Equal(t, "13: failed: user not found", results[3])
+		require.Equal(t, "14: added", results[4])
+		require.LessOrEqual(t, maxInFlight.Load(), int32(bulkMembershipConcurrency))
+	})
+
+	t.Run("over the rate limit skips the remaining users", func(t *testing.T) {
+		connector, mockClient, _ := setup()
+		mockClient.ListMembershipsFunc = func(ctx context.Context) (map[string][]*client.Membership, *v2.RateLimitDescription, error) {
+			return nil, nil, nil
+		}
+		overLimit := &v2.RateLimitDescription{Status: v2.RateLimitDescription_STATUS_OVERLIMIT}
+		mockClient.AddUserToGroupFunc = func(ctx context.Context, request *client.Membership) (*v2.RateLimitDescription, error) {
+			return overLimit, fmt.Errorf("too many requests")
+		}
+
+		var add []any
+		for i := 10; i < 30; i++ {
+			add = append(add, strconv.Itoa(i))
+		}
+		resp, ann, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", add, nil))
+		require.NoError(t, err)
+		require.False(t, resp.Fields["success"].GetBoolValue())
+		require.Contains(t, resultStrings(resp), "29: skipped: over the rate limit")
+		require.True(t, ann.Contains(&v2.RateLimitDescription{}))
+	})
+
+	t.Run("success when nothing fails", func(t *testing.T) {
+		connector, mockClient, _ := setup()
+		mockClient.AddUserToGroupFunc = func(ctx context.Context, request *client.Membership) (*v2.RateLimitDescription, error) {
+			return nil, nil
+		}
+
+		resp, _, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", []any{"4", "5"}, nil))
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+	})
+
+	t.Run("sso mapped group is refused", func(t *testing.T) {
+		connector, mockClient, _ := setup()
+		connector.groupOptions.protectSSOMapped = true
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			switch key {
+			case "saml-group-sync":
+				return true, nil, nil
+			case "saml-group-mappings":
+				return map[string]any{"analysts": []any{float64(3)}}, nil, nil
+			}
+			return nil, nil, nil
+		}
+
+		_, _, err := connector.BulkUpdateGroupMembers(ctx, bulkUpdateArgs("3", []any{"4"}, nil))
+		require.ErrorContains(t, err, "managed through saml group mappings")
+	})
+
+	for name, tc := range map[string]struct {
+		args *structpb.Struct
+		err  string
+	}{
+		"nil arguments":        {nil, "arguments cannot be nil"},
+		"missing group":        {bulkUpdateArgs("", []any{"4"}, nil), "groupId cannot be empty"},
+		"invalid group id":     {bulkUpdateArgs("abc", []any{"4"}, nil), `invalid group id "abc"`},
+		"unknown group":        {bulkUpdateArgs("99", []any{"4"}, nil), "group 99 does not exist"},
+		"all users":            {bulkUpdateArgs("1", []any{"4"}, nil), "All Users"},
+		"no users":             {bulkUpdateArgs("3", nil, nil), "add or remove must list at least one user"},
+		"empty user":           {bulkUpdateArgs("3", []any{" "}, nil), "add cannot contain empty user IDs or emails"},
+		"added and removed":    {bulkUpdateArgs("3", []any{"ada@example.com"}, []any{"Ada@example.com"}), "listed in both add and remove"},
+		"duplicate is ignored": {bulkUpdateArgs("3", []any{"4", "4"}, []any{"5", "alan@example.com"}), ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			connector, mockClient, _ := setup()
+			mockClient.AddUserToGroupFunc = func(ctx context.Context, request *client.Membership) (*v2.RateLimitDescription, error) {
+				return nil, nil
+			}
+			mockClient.RemoveUserFromGroupFunc = func(ctx context.Context, membershipID string) (*v2.RateLimitDescription, error) {
+				return nil, nil
+			}
+
+			resp, _, err := connector.BulkUpdateGroupMembers(ctx, tc.args)
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.Equal(t, []string{"4: added", "5: removed", "alan@example.com: not a member"}, resultStrings(resp))
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
@@ -14,14 +14,34 @@ import (
 )
 
 type Connector struct {
-	client client.ClientService
+	client       client.ClientService
+	userOptions  userSyncOptions
+	groupOptions groupSyncOptions
+	tableOptions tableSyncOptions
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
+// Databases, tables and the application are only synced on paid plans, since the permissions they carry are paid features.
 func (c *Connector) ResourceSyncers(_ context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
-		newUserBuilder(c.client),
-		newGroupBuilder(c.client),
+	syncers := []connectorbuilder.ResourceSyncer{
+		newUserBuilder(c.client, c.userOptions),
+		newGroupBuilder(c.client, c.groupOptions),
+		newAPIKeyBuilder(c.client),
+	}
+	if c.client.IsPaidPlan() {
+		syncers = append(syncers,
+			newDatabaseBuilder(c.client, c.groupOptions.filter),
+			newTableBuilder(c.client, c.tableOptions),
+			newApplicationBuilder(c.client, c.groupOptions.filter),
+		)
+	}
+	return syncers
+}
+
+// EventFeeds returns the feeds the connector exposes for near real-time access changes.
+func (c *Connector) EventFeeds(_ context.Context) []connectorbuilder.EventFeed {
+	return []connectorbuilder.EventFeed{
+		newAccessChangesFeed(c.client),
 	}
 }
 
@@ -39,7 +59,7 @@ func (c *Connector) Asset(_ context.Context, _ *v2.AssetRef) (string, io.ReadClo
 func (c *Connector) Metadata(_ context.Context) (*v2.ConnectorMetadata, error) {
 	return &v2.ConnectorMetadata{
 		DisplayName: "Metabase",
-		Description: "Metabase connector to sync users and groups",
+		Description: "Metabase connector to sync users, groups and API keys",
 		AccountCreationSchema: &v2.ConnectorAccountCreationSchema{
 			FieldMap: map[string]*v2.ConnectorAccountCreationSchema_Field{
 				"email": {
@@ -83,17 +103,67 @@ func (c *Connector) Validate(_ context.Context) (annotations.Annotations, error)
 	return nil, nil
 }
 
+// Close is called by the SDK when the connector shuts down. It flushes the fixture recording, if any.
+func (c *Connector) Close(_ context.Context) error {
+	if closer, ok := c.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 // New returns a new instance of the connector.
 func New(ctx context.Context, config *cfg.Metabase) (*Connector, error) {
 	l := ctxzap.Extract(ctx)
 
-	metabaseClient, err := client.New(ctx, config.MetabaseBaseUrl, config.MetabaseApiKey, config.MetabaseWithPaidPlan)
+	var clientOpts []client.Option
+	if config.MetabaseRecordFixtures != "" {
+		clientOpts = append(clientOpts, client.WithFixtureRecording(config.MetabaseRecordFixtures))
+	}
+
+	metabaseClient, err := client.New(ctx, config.MetabaseBaseUrl, config.MetabaseApiKey, config.MetabaseWithPaidPlan, clientOpts...)
 	if err != nil {
 		l.Error("error creating metabase client", zap.Error(err))
 		return nil, err
 	}
 
+	groupFilter, err := newGroupFilter(
+		config.MetabaseGroupIncludeRegex,
+		config.MetabaseGroupExcludeRegex,
+		config.MetabaseGroupIncludeIds,
+		config.MetabaseGroupExcludeIds,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	userOptions := userSyncOptions{
+		pageConcurrency: config.MetabaseUserPageConcurrency,
+		skipAPIKeyUsers: config.MetabaseApiKeyUsers == cfg.APIKeyUsersSkip,
+		groupFilter:     groupFilter,
+	}
+	if config.MetabaseQueryActivity {
+		userOptions.queryActivity = newQueryActivity()
+	}
+
+	groupOptions := groupSyncOptions{
+		protectSSOMapped: config.MetabaseProtectSsoMappedGroups,
+		filter:           groupFilter,
+	}
+
+	sandboxRemappings, err := parseSandboxRemappings(config.MetabaseSandboxAttributeRemappings)
+	if err != nil {
+		return nil, err
+	}
+
+	tableOptions := tableSyncOptions{
+		groupFilter:       groupFilter,
+		sandboxRemappings: sandboxRemappings,
+	}
+
 	return &Connector{
-		client: metabaseClient,
+		client:       metabaseClient,
+		userOptions:  userOptions,
+		groupOptions: groupOptions,
+		tableOptions: tableOptions,
 	}, nil
 }
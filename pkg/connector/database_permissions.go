@@ -0,0 +1,274 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+)
+
+// Database permissions modeled as entitlements, one per level that grants something.
+const (
+	DownloadFullPermission    = "download_full"
+	DownloadLimitedPermission = "download_limited"
+	DataModelPermission       = "data_model"
+	DetailsPermission         = "details"
+)
+
+// databasePermission is one level of a per-database permission in the data permissions graph.
+type databasePermission struct {
+	// name is the entitlement slug.
+	name string
+	// key is the permission in the group's document for the database.
+	key string
+	// level is the value that grants the entitlement, and off the value revoking it sets.
+	level string
+	off   string
+	// higher are the levels of the same key that include this one. Granting this level over them
+	// would downgrade the group, so it is refused.
+	higher []string
+	// schemas is set for permissions whose value sits under "schemas", where it can be a single
+	// value for the database or set per schema and table.
+	schemas     bool
+	displayName string
+	description string
+}
+
+var databasePermissions = []databasePermission{
+	{
+		name: DownloadFullPermission, key: "download", level: "full", off: "none", schemas: true,
+		displayName: "Download Full Results",
+		description: "Downloads up to a million rows of query results from %s",
+	},
+	{
+		name: DownloadLimitedPermission, key: "download", level: "limited", off: "none", higher: []string{"full"}, schemas: true,
+		displayName: "Download Limited Results",
+		description: "Downloads up to 10,000 rows of query results from %s",
+	},
+	{
+		name: DataModelPermission, key: "data-model", level: "all", off: "none", schemas: true,
+		displayName: "Data Model",
+		description: "Edits the table metadata of %s in the data model",
+	},
+	{
+		name: DetailsPermission, key: "details", level: "yes", off: "no",
+		displayName: "Database Details",
+		description: "Edits the connection details of %s and syncs or removes it",
+	},
+}
+
+// findDatabasePermission returns the database permission an entitlement ID refers to.
+func findDatabasePermission(entitlementID string) (databasePermission, bool) {
+	for _, permission := range databasePermissions {
+		if strings.HasSuffix(entitlementID, ":"+permission.name) || entitlementID == permission.name {
+			return permission, true
+		}
+	}
+	return databasePermission{}, false
+}
+
+// value returns the permission's value in a group's document for the database, nil when unset.
+func (p databasePermission) value(databasePerms map[string]any) any {
+	value := databasePerms[p.key]
+	if p.schemas {
+		nested, _ := value.(map[string]any)
+		return nested["schemas"]
+	}
+	return value
+}
+
+// setValue sets the permission's value in a group's document for the database.
+func (p databasePermission) setValue(databasePerms map[string]any, value any) {
+	if p.schemas {
+		nested, _ := databasePerms[p.key].(map[string]any)
+		if nested == nil {
+			nested = make(map[string]any)
+		}
+		nested["schemas"] = value
+		value = nested
+	}
+	databasePerms[p.key] = value
+}
+
+// levelsOf collects the levels a permission value holds, walking values set per schema and table.
+func levelsOf(value any, levels map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		levels[v] = true
+	case map[string]any:
+		for _, nested := range v {
+			levelsOf(nested, levels)
+		}
+	}
+}
+
+// replaceLevel returns value with every occurrence of level replaced by off, leaving the levels set
+// on other schemas and tables alone.
+func replaceLevel(value any, level, off string) any {
+	switch v := value.(type) {
+	case string:
+		if v == level {
+			return off
+		}
+		return v
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, nested := range v {
+			out[key] = replaceLevel(nested, level, off)
+		}
+		return out
+	}
+	return value
+}
+
+// databasePermissionEntitlements returns the entitlements of the per-database permissions.
+func databasePermissionEntitlements(resource *v2.Resource) []*v2.Entitlement {
+	entitlements := make([]*v2.Entitlement, 0, len(databasePermissions))
+	for _, permission := range databasePermissions {
+		entitlements = append(entitlements, entitlement.NewPermissionEntitlement(resource, permission.name,
+			entitlement.WithGrantableTo(GroupResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, permission.displayName)),
+			entitlement.WithDescription(fmt.Sprintf(permission.description, resource.DisplayName)),
+		))
+	}
+	return entitlements
+}
+
+// databasePermissionGrants reports a grant for each permission level a group holds on the database,
+// from the data permissions graph. A level set only on some schemas or tables is still granted,
+// with granular set in the grant metadata.
+func databasePermissionGrants(graph *client.PermissionsGraph, resource *v2.Resource, groupAllowed func(int) bool) ([]*v2.Grant, error) {
+	groupIDs := make([]int, 0, len(graph.Groups))
+	for key := range graph.Groups {
+		groupID, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group id %q in permissions graph: %w", key, err)
+		}
+		if groupAllowed(groupID) {
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+	sort.Ints(groupIDs)
+
+	var grants []*v2.Grant
+	for _, groupID := range groupIDs {
+		groupResource := &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: GroupResourceType.Id,
+				Resource:     strconv.Itoa(groupID),
+			},
+		}
+		databasePerms, _ := graph.Groups[groupResource.Id.Resource][resource.Id.Resource].(map[string]any)
+
+		for _, permission := range databasePermissions {
+			value := permission.value(databasePerms)
+			levels := make(map[string]bool)
+			levelsOf(value, levels)
+			if !levels[permission.level] {
+				continue
+			}
+
+			_, granular := value.(map[string]any)
+			grants = append(grants, grant.NewGrant(
+				resource,
+				permission.name,
+				groupResource.Id,
+				grant.WithGrantMetadata(map[string]interface{}{
+					"permission":  permission.key,
+					"level":       permission.level,
+					"granular":    granular,
+					"group_id":    groupResource.Id.Resource,
+					"database_id": resource.Id.Resource,
+				}),
+				grant.WithAnnotation(&v2.GrantExpandable{
+					EntitlementIds: []string{entitlement.NewEntitlementID(groupResource, MemberPermission)},
+				}),
+			))
+		}
+	}
+
+	return grants, nil
+}
+
+// setDatabasePermission grants or revokes a per-database permission level for a group through a
+// revisioned update of the data permissions graph. Granting sets the level for the whole database;
+// revoking only turns off that level, wherever it is set. Granting a level the group already holds
+// through a higher one for the whole database is a no-op, and is refused when the higher level is
+// only set on some schemas or tables, since granting would downgrade them.
+func setDatabasePermission(ctx context.Context, c client.ClientService, groupID, databaseID string, permission databasePermission, grantLevel bool) (annotations.Annotations, error) {
+	ann := annotations.New()
+
+	graph, rateLimitDesc, err := c.GetPermissionsGraph(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	groupPerms, err := graph.GroupCopy(groupID)
+	if err != nil {
+		return ann, err
+	}
+	databasePerms, _ := groupPerms[databaseID].(map[string]any)
+	if databasePerms == nil {
+		databasePerms = make(map[string]any)
+	}
+
+	current := permission.value(databasePerms)
+	levels := make(map[string]bool)
+	levelsOf(current, levels)
+	switch {
+	case grantLevel && current == permission.level:
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
+	case !grantLevel && !levels[permission.level]:
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	}
+
+	if grantLevel {
+		for _, higher := range permission.higher {
+			if current == higher {
+				return annotations.New(&v2.GrantAlreadyExists{}), nil
+			}
+			if levels[higher] {
+				return ann, fmt.Errorf("group %s holds %s %s on part of database %s; granting %s would downgrade it", groupID, permission.key, higher, databaseID, permission.level)
+			}
+		}
+	}
+
+	if grantLevel {
+		permission.setValue(databasePerms, permission.level)
+	} else {
+		permission.setValue(databasePerms, replaceLevel(current, permission.level, permission.off))
+	}
+	groupPerms[databaseID] = databasePerms
+
+	// The whole group document is sent so other databases of the group are left as they are.
+	updated, rateLimitDesc, err := c.UpdatePermissionsGraph(ctx, &client.PermissionsGraph{
+		Revision: graph.Revision,
+		Groups:   map[string]map[string]any{groupID: groupPerms},
+	})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	updatedPerms, _ := updated.Groups[groupID][databaseID].(map[string]any)
+	got := permission.value(updatedPerms)
+	levels = make(map[string]bool)
+	levelsOf(got, levels)
+	if (grantLevel && got != permission.level) || (!grantLevel && levels[permission.level]) {
+		return ann, fmt.Errorf("permissions graph shows %s %v on database %s for group %s", permission.key, got, databaseID, groupID)
+	}
+
+	return ann, nil
+}
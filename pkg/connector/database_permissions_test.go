@@ -0,0 +1,155 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabasePermissionGrants(t *testing.T) {
+	database := &v2.Resource{
+		Id:          &v2.ResourceId{ResourceType: DatabaseResourceType.Id, Resource: "1"},
+		DisplayName: "Warehouse",
+	}
+	graph := &client.PermissionsGraph{Groups: map[string]map[string]any{
+		"3": {"1": map[string]any{
+			"view-data":  "unrestricted",
+			"download":   map[string]any{"schemas": "full"},
+			"data-model": map[string]any{"schemas": "all"},
+			"details":    "yes",
+		}},
+		"4": {"1": map[string]any{
+			"download":   map[string]any{"schemas": map[string]any{"public": map[string]any{"10": "limited", "11": "full"}, "sales": "none"}},
+			"data-model": map[string]any{"schemas": "none"},
+			"details":    "no",
+		}},
+		"5": {"2": map[string]any{"details": "yes"}},
+	}}
+
+	t.Run("one grant per level held", func(t *testing.T) {
+		grants, err := databasePermissionGrants(graph, database, func(int) bool { return true })
+		require.NoError(t, err)
+
+		var got []string
+		for _, g := range grants {
+			got = append(got, g.Principal.Id.Resource+" "+g.Entitlement.Id)
+		}
+		require.Equal(t, []string{
+			"3 database:1:download_full",
+			"3 database:1:data_model",
+			"3 database:1:details",
+			"4 database:1:download_full",
+			"4 database:1:download_limited",
+		}, got)
+
+		metadata := grantMetadata(t, grants[0])
+		require.Equal(t, "download", metadata["permission"])
+		require.Equal(t, "full", metadata["level"])
+		require.Equal(t, false, metadata["granular"])
+		require.Equal(t, true, grantMetadata(t, grants[3])["granular"])
+	})
+
+	t.Run("filtered out groups are left out", func(t *testing.T) {
+		grants, err := databasePermissionGrants(graph, database, func(id int) bool { return id != 3 })
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+	})
+}
+
+func TestSetDatabasePermission(t *testing.T) {
+	ctx := context.Background()
+
+	newMock := func(current map[string]any, check func(map[string]any)) *client.MockService {
+		return &client.MockService{
+			GetPermissionsGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				return &client.PermissionsGraph{Revision: 5, Groups: map[string]map[string]any{
+					"3": {"1": current, "2": map[string]any{"details": "yes"}},
+				}}, nil, nil
+			},
+			UpdatePermissionsGraphFunc: func(ctx context.Context, graph *client.PermissionsGraph) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				require.Equal(t, 5, graph.Revision)
+				require.Equal(t, map[string]any{"details": "yes"}, graph.Groups["3"]["2"])
+				check(graph.Groups["3"]["1"].(map[string]any))
+				graph.Revision++
+				return graph, nil, nil
+			},
+		}
+	}
+
+	t.Run("grant sets the level for the database", func(t *testing.T) {
+		mockClient := newMock(map[string]any{"view-data": "unrestricted", "download": map[string]any{"schemas": "limited"}}, func(perms map[string]any) {
+			require.Equal(t, map[string]any{"view-data": "unrestricted", "download": map[string]any{"schemas": "full"}}, perms)
+		})
+		permission, _ := findDatabasePermission("database:1:download_full")
+		ann, err := setDatabasePermission(ctx, mockClient, "3", "1", permission, true)
+		require.NoError(t, err)
+		require.False(t, ann.Contains(&v2.GrantAlreadyExists{}))
+	})
+
+	t.Run("revoke only turns off the revoked level", func(t *testing.T) {
+		granular := map[string]any{"schemas": map[string]any{"public": map[string]any{"10": "limited", "11": "full"}}}
+		mockClient := newMock(map[string]any{"download": granular}, func(perms map[string]any) {
+			require.Equal(t, map[string]any{"schemas": map[string]any{"public": map[string]any{"10": "limited", "11": "none"}}}, perms["download"])
+		})
+		permission, _ := findDatabasePermission("database:1:download_full")
+		_, err := setDatabasePermission(ctx, mockClient, "3", "1", permission, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("details are set directly", func(t *testing.T) {
+		mockClient := newMock(map[string]any{"details": "yes"}, func(perms map[string]any) {
+			require.Equal(t, "no", perms["details"])
+		})
+		permission, _ := findDatabasePermission("database:1:details")
+		_, err := setDatabasePermission(ctx, mockClient, "3", "1", permission, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("already granted and already revoked", func(t *testing.T) {
+		mockClient := newMock(map[string]any{"data-model": map[string]any{"schemas": "all"}}, func(map[string]any) {
+			t.Fatal("graph must not be updated")
+		})
+		permission, _ := findDatabasePermission("database:1:data_model")
+		ann, err := setDatabasePermission(ctx, mockClient, "3", "1", permission, true)
+		require.NoError(t, err)
+		require.True(t, ann.Contains(&v2.GrantAlreadyExists{}))
+
+		permission, _ = findDatabasePermission("database:1:download_limited")
+		ann, err = setDatabasePermission(ctx, mockClient, "3", "1", permission, false)
+		require.NoError(t, err)
+		require.True(t, ann.Contains(&v2.GrantAlreadyRevoked{}))
+	})
+
+	t.Run("limited never downgrades full", func(t *testing.T) {
+		permission, _ := findDatabasePermission("database:1:download_limited")
+
+		mockClient := newMock(map[string]any{"download": map[string]any{"schemas": "full"}}, func(map[string]any) {
+			t.Fatal("graph must not be updated")
+		})
+		ann, err := setDatabasePermission(ctx, mockClient, "3", "1", permission, true)
+		require.NoError(t, err)
+		require.True(t, ann.Contains(&v2.GrantAlreadyExists{}))
+
+		granular := map[string]any{"schemas": map[string]any{"public": map[string]any{"10": "none", "11": "full"}}}
+		mockClient = newMock(map[string]any{"download": granular}, func(map[string]any) {
+			t.Fatal("graph must not be updated")
+		})
+		_, err = setDatabasePermission(ctx, mockClient, "3", "1", permission, true)
+		require.ErrorContains(t, err, "would downgrade it")
+	})
+
+	t.Run("impersonation and administrators are refused", func(t *testing.T) {
+		builder := newDatabaseBuilder(&client.MockService{}, nil)
+		database := &v2.Resource{Id: &v2.ResourceId{ResourceType: DatabaseResourceType.Id, Resource: "1"}}
+		group := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "3"}}
+		admins := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "2"}}
+
+		_, err := builder.Grant(ctx, group, &v2.Entitlement{Id: "database:1:impersonated", Resource: database})
+		require.ErrorContains(t, err, "only be changed in Metabase")
+		_, err = builder.Grant(ctx, admins, &v2.Entitlement{Id: "database:1:details", Resource: database})
+		require.Error(t, err)
+	})
+}
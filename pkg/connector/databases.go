@@ -0,0 +1,209 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// ImpersonatedPermission is held by a group whose members query a database as the database role
+// named by one of their user attributes.
+const ImpersonatedPermission = "impersonated"
+
+// databaseBuilder syncs the databases connected to Metabase along with the connection impersonation
+// policies and the download, data model and details permissions set on them. They also group the
+// tables that carry the other data permissions.
+type databaseBuilder struct {
+	client client.ClientService
+	// groupFilter is nil unless groups are filtered; policies of filtered out groups are not granted.
+	groupFilter *groupFilter
+	// graph and impersonations are instance-wide, so they are read once per sync rather than once
+	// per database. Impersonations are keyed by database ID.
+	graph          syncCache[*client.PermissionsGraph]
+	impersonations syncCache[map[int][]*client.Impersonation]
+}
+
+func (d *databaseBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return DatabaseResourceType
+}
+
+func (d *databaseBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	// Databases are listed before any grants, so every sync reads the graph and policies again.
+	d.graph.reset()
+	d.impersonations.reset()
+
+	databases, rateLimitDesc, err := d.client.ListDatabases(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	outResources := make([]*v2.Resource, 0, len(databases))
+	for _, database := range databases {
+		res, err := parseIntoDatabaseResource(database)
+		if err != nil {
+			return nil, "", ann, err
+		}
+		outResources = append(outResources, res)
+	}
+
+	return outResources, "", ann, nil
+}
+
+func (d *databaseBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	entitlements := []*v2.Entitlement{
+		entitlement.NewPermissionEntitlement(resource, ImpersonatedPermission,
+			entitlement.WithGrantableTo(GroupResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("%s Impersonated", resource.DisplayName)),
+			entitlement.WithDescription(fmt.Sprintf("Queries %s as the database role named by a user attribute", resource.DisplayName)),
+		),
+	}
+
+	return append(entitlements, databasePermissionEntitlements(resource)...), "", nil, nil
+}
+
+// Grants reports the download, data model and details permissions of groups on the database, and
+// one grant per impersonation policy of the database to the impersonated group. Members of the
+// group inherit them, and the grant metadata of a policy names the user attribute holding the role.
+func (d *databaseBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	groupAllowed, rateLimitDesc, err := d.groupFilter.allowedGroups(ctx, d.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+
+	graph, rateLimitDesc, err := d.graph.load(func() (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+		return d.client.GetPermissionsGraph(ctx)
+	})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+
+	grants, err := databasePermissionGrants(graph, resource, groupAllowed)
+	if err != nil {
+		return nil, "", ann, err
+	}
+
+	impersonations, rateLimitDesc, err := d.impersonations.load(func() (map[int][]*client.Impersonation, *v2.RateLimitDescription, error) {
+		impersonations, rateLimitDesc, err := d.client.ListImpersonations(ctx)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("failed to list impersonations: %w", err)
+		}
+		byDatabase := make(map[int][]*client.Impersonation)
+		for _, impersonation := range impersonations {
+			byDatabase[impersonation.DBID] = append(byDatabase[impersonation.DBID], impersonation)
+		}
+		return byDatabase, rateLimitDesc, nil
+	})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+	databaseID, err := strconv.Atoi(resource.Id.Resource)
+	if err != nil {
+		return nil, "", ann, fmt.Errorf("invalid database id %q: %w", resource.Id.Resource, err)
+	}
+
+	for _, impersonation := range impersonations[databaseID] {
+		if !groupAllowed(impersonation.GroupID) {
+			continue
+		}
+
+		groupResource := &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: GroupResourceType.Id,
+				Resource:     strconv.Itoa(impersonation.GroupID),
+			},
+		}
+		grants = append(grants, grant.NewGrant(
+			resource,
+			ImpersonatedPermission,
+			groupResource.Id,
+			grant.WithGrantMetadata(map[string]interface{}{
+				"impersonation_id": impersonation.ID,
+				"group_id":         strconv.Itoa(impersonation.GroupID),
+				"database_id":      resource.Id.Resource,
+				"attribute":        impersonation.Attribute,
+			}),
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{entitlement.NewEntitlementID(groupResource, MemberPermission)},
+			}),
+		))
+	}
+
+	return grants, "", ann, nil
+}
+
+func (d *databaseBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	return d.setPermission(ctx, principal, entitlement, true)
+}
+
+func (d *databaseBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	return d.setPermission(ctx, grant.Principal, grant.Entitlement, false)
+}
+
+func (d *databaseBuilder) setPermission(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement, grantLevel bool) (annotations.Annotations, error) {
+	if principal.Id.ResourceType != GroupResourceType.Id {
+		return nil, fmt.Errorf("database permissions can only be granted to groups, got %s", principal.Id.ResourceType)
+	}
+	if principal.Id.Resource == strconv.Itoa(administratorsGroupID) {
+		return nil, fmt.Errorf("the database permissions of the Administrators group cannot be changed")
+	}
+	if strings.HasSuffix(entitlement.Id, ":"+ImpersonatedPermission) {
+		return nil, fmt.Errorf("database %s: impersonation policies can only be changed in Metabase", entitlement.Resource.Id.Resource)
+	}
+
+	permission, ok := findDatabasePermission(entitlement.Id)
+	if !ok {
+		return nil, fmt.Errorf("unsupported entitlement id %q", entitlement.Id)
+	}
+
+	// Grants must not report the graph read before this change.
+	defer d.graph.reset()
+
+	return setDatabasePermission(ctx, d.client, principal.Id.Resource, entitlement.Resource.Id.Resource, permission, grantLevel)
+}
+
+func parseIntoDatabaseResource(database *client.Database) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":   database.Name,
+		"engine": database.Engine,
+	}
+
+	return resourceSdk.NewResource(
+		database.Name,
+		DatabaseResourceType,
+		database.ID,
+		resourceSdk.WithResourceProfile(profile),
+		resourceSdk.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: TableResourceType.Id}),
+	)
+}
+
+func newDatabaseBuilder(client client.ClientService, groupFilter *groupFilter) *databaseBuilder {
+	return &databaseBuilder{
+		client:      client,
+		groupFilter: groupFilter,
+	}
+}
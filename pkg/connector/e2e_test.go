@@ -0,0 +1,989 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	"github.com/conductorone/baton-metabase/pkg/metabasetest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newE2EConnector wires a real MetabaseClient to a fake Metabase server.
+// The SDK HTTP cache is disabled so reads observe writes made earlier in the same test.
+func newE2EConnector(t *testing.T, srv *metabasetest.Server) *Connector {
+	t.Helper()
+	t.Setenv("BATON_HTTP_CACHE_TTL", "0")
+
+	c, err := client.New(context.Background(), srv.URL, srv.APIKey, srv.PaidPlan)
+	require.NoError(t, err)
+	return &Connector{client: c}
+}
+
+func listAllUsers(ctx context.Context, t *testing.T, builder *userBuilder, pageSize int) []*v2.Resource {
+	t.Helper()
+
+	var out []*v2.Resource
+	token := &pagination.Token{Size: pageSize}
+	for {
+		resources, next, _, err := builder.List(ctx, nil, token)
+		require.NoError(t, err)
+		out = append(out, resources...)
+		if next == "" {
+			return out
+		}
+		token = &pagination.Token{Size: pageSize, Token: next}
+	}
+}
+
+func TestE2EFullSync(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	analysts := srv.AddGroup("Analysts")
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	bob := srv.AddUser("bob.smith@example.com", "Bob", "Smith")
+	carl := srv.AddUser("carl.jones@example.com", "Carl", "Jones")
+	srv.AddMembership(ana.ID, metabasetest.AdministratorsGroupID, false)
+	srv.AddMembership(bob.ID, analysts.ID, true)
+	srv.SetUserActive(carl.ID, false)
+
+	conn := newE2EConnector(t, srv)
+	users := newUserBuilder(conn.client, userSyncOptions{})
+	groups := newGroupBuilder(conn.client, groupSyncOptions{})
+
+	t.Run("lists every user across pages including inactive ones", func(t *testing.T) {
+		resources := listAllUsers(ctx, t, users, 2)
+		require.Len(t, resources, 3)
+		require.Equal(t, "Ana Gomez", resources[0].DisplayName)
+		require.Equal(t, "Carl Jones", resources[2].DisplayName)
+	})
+
+	t.Run("lists groups with entitlements", func(t *testing.T) {
+		resources, next, _, err := groups.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Empty(t, next)
+		require.Len(t, resources, 3)
+
+		entitlements, _, _, err := groups.Entitlements(ctx, resources[2], &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, entitlements, 2)
+	})
+
+	t.Run("emits membership grants from users", func(t *testing.T) {
+		bobResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: strconv.Itoa(bob.ID)}}
+		grants, _, _, err := users.Grants(ctx, bobResource, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+
+		ids := make([]string, 0, len(grants))
+		for _, g := range grants {
+			ids = append(ids, g.Entitlement.Id)
+		}
+		require.Contains(t, ids, "group:1:member")
+		require.Contains(t, ids, "group:"+strconv.Itoa(analysts.ID)+":manager")
+	})
+
+	t.Run("lists api keys with their group grant", func(t *testing.T) {
+		key := srv.AddAPIKey("dbt exporter", metabasetest.AdministratorsGroupID, ana.ID)
+		apiKeys := newAPIKeyBuilder(conn.client)
+
+		resources, _, _, err := apiKeys.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, resources, 1)
+		require.Equal(t, strconv.Itoa(key.ID), resources[0].Id.Resource)
+
+		trait, err := resourceSdk.GetUserTrait(resources[0])
+		require.NoError(t, err)
+		require.Equal(t, key.MaskedKey, trait.GetProfile().AsMap()["masked_key"])
+		require.NotContains(t, trait.GetProfile().String(), key.Key)
+
+		grants, _, _, err := apiKeys.Grants(ctx, resources[0], &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		require.Equal(t, "group:2:member", grants[0].Entitlement.Id)
+	})
+}
+
+func TestE2EConcurrentUserPages(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	for i := 1; i <= 11; i++ {
+		srv.AddUser(fmt.Sprintf("user%02d@example.com", i), "User", fmt.Sprintf("%02d", i))
+	}
+
+	conn := newE2EConnector(t, srv)
+	sequential := listAllUsers(ctx, t, newUserBuilder(conn.client, userSyncOptions{}), 2)
+	concurrent := listAllUsers(ctx, t, newUserBuilder(conn.client, userSyncOptions{pageConcurrency: 4}), 2)
+
+	require.Len(t, concurrent, 11)
+	require.Equal(t, len(sequential), len(concurrent))
+	for i := range sequential {
+		require.Equal(t, sequential[i].Id.Resource, concurrent[i].Id.Resource)
+	}
+}
+
+func TestE2ETargetedSync(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	analysts := srv.AddGroup("Analysts")
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	srv.AddMembership(ana.ID, analysts.ID, false)
+
+	conn := newE2EConnector(t, srv)
+	users := newUserBuilder(conn.client, userSyncOptions{})
+	groups := newGroupBuilder(conn.client, groupSyncOptions{})
+
+	t.Run("fetches one user with its grants", func(t *testing.T) {
+		res, _, err := users.Get(ctx, &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: strconv.Itoa(ana.ID)}, nil)
+		require.NoError(t, err)
+		require.Equal(t, "Ana Gomez", res.DisplayName)
+
+		grants, _, _, err := users.Grants(ctx, res, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+	})
+
+	t.Run("fetches one group with its grants", func(t *testing.T) {
+		res, _, err := groups.Get(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: strconv.Itoa(analysts.ID)}, nil)
+		require.NoError(t, err)
+		require.Equal(t, "Analysts", res.DisplayName)
+
+		grants, _, _, err := groups.Grants(ctx, res, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		require.Equal(t, strconv.Itoa(ana.ID), grants[0].Principal.Id.Resource)
+	})
+
+	t.Run("unknown group returns not found", func(t *testing.T) {
+		_, _, err := groups.Get(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "999"}, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status 404")
+		// The SDK treats NotFound from Get as a deleted resource rather than a failed sync.
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestE2EMembershipListing(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	analysts := srv.AddGroup("Analysts")
+	finance := srv.AddGroup("Finance")
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	bob := srv.AddUser("bob.smith@example.com", "Bob", "Smith")
+	carl := srv.AddUser("carl.jones@example.com", "Carl", "Jones")
+	srv.AddMembership(ana.ID, analysts.ID, true)
+
+	conn := newE2EConnector(t, srv)
+	users := newUserBuilder(conn.client, conn.userOptions)
+
+	// runSync lists every user and returns the grants of each, keyed by user ID.
+	runSync := func() map[string][]string {
+		resources := listAllUsers(ctx, t, users, 2)
+		require.Len(t, resources, len(srv.Users()))
+
+		grants := make(map[string][]string)
+		for _, res := range resources {
+			userGrants, _, _, err := users.Grants(ctx, res, &pagination.Token{})
+			require.NoError(t, err)
+			for _, g := range userGrants {
+				grants[res.Id.Resource] = append(grants[res.Id.Resource], g.Entitlement.Id)
+			}
+		}
+		return grants
+	}
+
+	allUsers := fmt.Sprintf("group:%d:%s", metabasetest.AllUsersGroupID, MemberPermission)
+	anaManager := fmt.Sprintf("group:%d:%s", analysts.ID, ManagerPermission)
+	before := countRequests(srv, "GET /api/permissions/membership")
+	require.Equal(t, map[string][]string{
+		strconv.Itoa(ana.ID):  {allUsers, anaManager},
+		strconv.Itoa(bob.ID):  {allUsers},
+		strconv.Itoa(carl.ID): {allUsers},
+	}, runSync())
+	require.Equal(t, 1, countRequests(srv, "GET /api/permissions/membership")-before, "memberships are listed once per sync")
+
+	// The next sync lists memberships again and sees the changes made in between.
+	srv.AddMembership(bob.ID, finance.ID, false)
+	before = countRequests(srv, "GET /api/permissions/membership")
+	require.Equal(t, map[string][]string{
+		strconv.Itoa(ana.ID):  {allUsers, anaManager},
+		strconv.Itoa(bob.ID):  {allUsers, fmt.Sprintf("group:%d:%s", finance.ID, MemberPermission)},
+		strconv.Itoa(carl.ID): {allUsers},
+	}, runSync())
+	require.Equal(t, 1, countRequests(srv, "GET /api/permissions/membership")-before)
+}
+
+func countRequests(srv *metabasetest.Server, request string) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+func TestE2EQueryActivity(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	bob := srv.AddUser("bob.smith@example.com", "Bob", "Smith")
+	lastQuery := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	srv.AddQueryExecution(ana.ID, time.Now().Add(-200*24*time.Hour))
+	srv.AddQueryExecution(ana.ID, lastQuery.Add(-time.Hour))
+	srv.AddQueryExecution(ana.ID, lastQuery)
+	srv.AddQueryExecution(bob.ID, lastQuery)
+	carl := srv.AddUser("carl.jones@example.com", "Carl", "Jones")
+	// One user per result, so the stats of every user but the first need another page.
+	srv.DatasetRowLimit = 1
+
+	conn := newE2EConnector(t, srv)
+	users := newUserBuilder(conn.client, userSyncOptions{queryActivity: newQueryActivity()})
+
+	resources := listAllUsers(ctx, t, users, 10)
+	require.Len(t, resources, 3)
+
+	profileOf := func(res *v2.Resource) map[string]any {
+		trait, err := resourceSdk.GetUserTrait(res)
+		require.NoError(t, err)
+		return trait.GetProfile().AsMap()
+	}
+	anaProfile := profileOf(resources[0])
+	require.Equal(t, lastQuery.Format(time.RFC3339), anaProfile["last_query_at"])
+	require.EqualValues(t, 2, anaProfile["query_count_90d"])
+	require.EqualValues(t, 1, profileOf(resources[1])["query_count_90d"])
+
+	carlResource, _, err := users.Get(ctx, &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: strconv.Itoa(carl.ID)}, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, profileOf(carlResource)["query_count_90d"])
+}
+
+func TestE2EAccessChangesFeed(t *testing.T) {
+	ctx := context.Background()
+
+	eventKinds := func(events []*v2.Event) []string {
+		kinds := make([]string, 0, len(events))
+		for _, event := range events {
+			switch {
+			case event.GetResourceChangeEvent() != nil:
+				id := event.GetResourceChangeEvent().GetResourceId()
+				kinds = append(kinds, "change "+id.GetResourceType()+":"+id.GetResource())
+			case event.GetCreateGrantEvent() != nil:
+				kinds = append(kinds, "grant "+event.GetCreateGrantEvent().GetEntitlement().GetId())
+			case event.GetCreateRevokeEvent() != nil:
+				kinds = append(kinds, "revoke "+event.GetCreateRevokeEvent().GetEntitlement().GetId())
+			}
+		}
+		return kinds
+	}
+
+	t.Run("reads the audit log on paid plans", func(t *testing.T) {
+		srv := metabasetest.NewServer()
+		defer srv.Close()
+		srv.PaidPlan = true
+		analysts := srv.AddGroup("Analysts")
+
+		conn := newE2EConnector(t, srv)
+		feed := newAccessChangesFeed(conn.client)
+
+		events, state, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 2})
+		require.NoError(t, err)
+		require.Empty(t, events)
+
+		user, _, err := conn.client.CreateUser(ctx, &client.CreateUserRequest{Email: "dana.white@example.com", FirstName: "Dana", LastName: "White"})
+		require.NoError(t, err)
+		_, err = conn.client.AddUserToGroup(ctx, &client.Membership{UserID: user.ID, GroupID: analysts.ID})
+		require.NoError(t, err)
+		_, _, err = conn.client.UpdateUserActiveStatus(ctx, strconv.Itoa(user.ID), false)
+		require.NoError(t, err)
+
+		var all []*v2.Event
+		for {
+			events, state, _, err = feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 2, Cursor: state.Cursor})
+			require.NoError(t, err)
+			all = append(all, events...)
+			if !state.HasMore {
+				break
+			}
+		}
+
+		userID := strconv.Itoa(user.ID)
+		require.Equal(t, []string{
+			"change user:" + userID,
+			"grant group:" + strconv.Itoa(analysts.ID) + ":member",
+			"change user:" + userID,
+		}, eventKinds(all))
+	})
+
+	t.Run("polls on free plans", func(t *testing.T) {
+		srv := metabasetest.NewServer()
+		defer srv.Close()
+		analysts := srv.AddGroup("Analysts")
+		ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+
+		conn := newE2EConnector(t, srv)
+		feed := newAccessChangesFeed(conn.client)
+
+		events, state, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{})
+		require.NoError(t, err)
+		require.Empty(t, events)
+
+		srv.SetUserActive(ana.ID, false)
+		srv.AddMembership(ana.ID, analysts.ID, false)
+		srv.SetPermissionsGraph(analysts.ID, map[string]any{"1": map[string]any{"view-data": "unrestricted"}})
+
+		// Without the audit log, the membership is not reported: Metabase keeps no history of it.
+		events, _, _, err = feed.ListEvents(ctx, nil, &pagination.StreamToken{Cursor: state.Cursor})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"change user:" + strconv.Itoa(ana.ID),
+			"change group:" + strconv.Itoa(analysts.ID),
+		}, eventKinds(events))
+	})
+}
+
+func TestE2EProvisioning(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	analysts := srv.AddGroup("Analysts")
+	conn := newE2EConnector(t, srv)
+	users := newUserBuilder(conn.client, userSyncOptions{})
+	groups := newGroupBuilder(conn.client, groupSyncOptions{})
+
+	profile, err := structpb.NewStruct(map[string]interface{}{
+		"email":      "dana.white@example.com",
+		"first_name": "Dana",
+		"last_name":  "White",
+	})
+	require.NoError(t, err)
+
+	resp, plaintexts, _, err := users.CreateAccount(ctx, &v2.AccountInfo{Profile: profile}, nil)
+	require.NoError(t, err)
+	require.Len(t, plaintexts, 1)
+	userResource := resp.(*v2.CreateAccountResponse_SuccessResult).Resource
+
+	t.Run("creating the same email twice surfaces the API error", func(t *testing.T) {
+		_, _, _, err := users.CreateAccount(ctx, &v2.AccountInfo{Profile: profile}, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status 400")
+		require.Contains(t, err.Error(), "Email address already in use.")
+	})
+
+	groupResource := &v2.Resource{
+		Id:          &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: strconv.Itoa(analysts.ID)},
+		DisplayName: analysts.Name,
+	}
+	entitlement := &v2.Entitlement{Id: "group:" + strconv.Itoa(analysts.ID) + ":member", Resource: groupResource}
+
+	t.Run("grant and revoke membership", func(t *testing.T) {
+		_, err := groups.Grant(ctx, userResource, entitlement)
+		require.NoError(t, err)
+
+		ann, err := groups.Grant(ctx, userResource, entitlement)
+		require.NoError(t, err)
+		require.True(t, ann.Contains(&v2.GrantAlreadyExists{}))
+
+		_, err = groups.Revoke(ctx, &v2.Grant{Entitlement: entitlement, Principal: userResource})
+		require.NoError(t, err)
+
+		ann, err = groups.Revoke(ctx, &v2.Grant{Entitlement: entitlement, Principal: userResource})
+		require.NoError(t, err)
+		require.True(t, ann.Contains(&v2.GrantAlreadyRevoked{}))
+	})
+
+	t.Run("manager grants require a paid plan", func(t *testing.T) {
+		managerEntitlement := &v2.Entitlement{Id: "group:" + strconv.Itoa(analysts.ID) + ":manager", Resource: groupResource}
+		_, err := groups.Grant(ctx, userResource, managerEntitlement)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status 402")
+	})
+
+	t.Run("disable and enable the account", func(t *testing.T) {
+		args, err := structpb.NewStruct(map[string]interface{}{"userId": userResource.Id.Resource})
+		require.NoError(t, err)
+
+		resp, _, err := conn.DisableUser(ctx, args)
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+
+		resp, _, err = conn.EnableUser(ctx, args)
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+
+		_, _, err = conn.EnableUser(ctx, args)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Not able to reactivate an active user")
+	})
+
+	t.Run("unknown users return not found", func(t *testing.T) {
+		_, _, err := conn.client.GetUserByID(ctx, "999")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status 404")
+	})
+}
+
+func TestE2EAPIKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	analysts := srv.AddGroup("Analysts")
+	conn := newE2EConnector(t, srv)
+	apiKeys := newAPIKeyBuilder(conn.client)
+
+	args, err := structpb.NewStruct(map[string]interface{}{
+		"name":    "dbt exporter",
+		"groupId": strconv.Itoa(analysts.ID),
+	})
+	require.NoError(t, err)
+
+	resp, _, err := conn.CreateAPIKey(ctx, args)
+	require.NoError(t, err)
+	keyResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: APIKeyResourceType.Id, Resource: resp.Fields["apiKeyId"].GetStringValue()}}
+	require.Equal(t, srv.APIKeys()[0].Key, resp.Fields["apiKey"].GetStringValue())
+
+	t.Run("regenerating returns the new key", func(t *testing.T) {
+		previous := resp.Fields["apiKey"].GetStringValue()
+		rotated, _, err := apiKeys.Rotate(ctx, keyResource.Id, nil)
+		require.NoError(t, err)
+		require.Len(t, rotated, 1)
+		require.NotEqual(t, previous, string(rotated[0].Bytes))
+		require.Equal(t, srv.APIKeys()[0].Key, string(rotated[0].Bytes))
+	})
+
+	t.Run("deleting removes the key and is idempotent", func(t *testing.T) {
+		_, err := apiKeys.Delete(ctx, keyResource.Id)
+		require.NoError(t, err)
+		require.Empty(t, srv.APIKeys())
+
+		_, err = apiKeys.Delete(ctx, keyResource.Id)
+		require.NoError(t, err)
+	})
+
+	t.Run("rotating a missing key fails", func(t *testing.T) {
+		_, _, err := apiKeys.Rotate(ctx, keyResource.Id, nil)
+		require.Error(t, err)
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestE2EAPIKeyUsers(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	srv.AddAPIKey("dbt exporter", metabasetest.AdministratorsGroupID, ana.ID)
+	conn := newE2EConnector(t, srv)
+
+	service := listAllUsers(ctx, t, newUserBuilder(conn.client, userSyncOptions{}), 10)
+	require.Len(t, service, 2)
+	trait, err := resourceSdk.GetUserTrait(service[1])
+	require.NoError(t, err)
+	require.Equal(t, v2.UserTrait_ACCOUNT_TYPE_SERVICE, trait.GetAccountType())
+
+	skipped := listAllUsers(ctx, t, newUserBuilder(conn.client, userSyncOptions{skipAPIKeyUsers: true}), 10)
+	require.Len(t, skipped, 1)
+	require.Equal(t, strconv.Itoa(ana.ID), skipped[0].Id.Resource)
+}
+
+func TestE2EAuthSource(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	srv.SetSetting("saml-enabled", true)
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	bob := srv.AddUser("bob.smith@example.com", "Bob", "Smith")
+	srv.SetUserSSOSource(bob.ID, "saml")
+
+	conn := newE2EConnector(t, srv)
+	users := newUserBuilder(conn.client, userSyncOptions{})
+
+	resources := listAllUsers(ctx, t, users, 10)
+	require.Len(t, resources, 2)
+	anaAnnos := annotations.Annotations(resources[0].Annotations)
+	bobAnnos := annotations.Annotations(resources[1].Annotations)
+	require.True(t, anaAnnos.Contains(&v2.RiskFactor{}))
+	require.False(t, bobAnnos.Contains(&v2.RiskFactor{}))
+
+	res, _, err := users.Get(ctx, &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: strconv.Itoa(ana.ID)}, nil)
+	require.NoError(t, err)
+	getAnnos := annotations.Annotations(res.Annotations)
+	require.True(t, getAnnos.Contains(&v2.RiskFactor{}))
+	trait, err := resourceSdk.GetUserTrait(res)
+	require.NoError(t, err)
+	require.Equal(t, "password", trait.GetProfile().AsMap()["auth_source"])
+}
+
+func TestE2ESSOGroupMappings(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	analysts := srv.AddGroup("Analysts")
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	srv.SetSetting("jwt-group-sync", true)
+	srv.SetSetting("jwt-group-mappings", map[string]any{"analysts": []int{analysts.ID}})
+
+	conn := newE2EConnector(t, srv)
+	groups := newGroupBuilder(conn.client, groupSyncOptions{protectSSOMapped: true})
+
+	res, _, err := groups.Get(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: strconv.Itoa(analysts.ID)}, nil)
+	require.NoError(t, err)
+	trait, err := resourceSdk.GetGroupTrait(res)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"analysts"}, trait.GetProfile().AsMap()["jwt_group_mappings"])
+
+	userResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: strconv.Itoa(ana.ID)}}
+	_, err = groups.Grant(ctx, userResource, &v2.Entitlement{Id: "group:" + strconv.Itoa(analysts.ID) + ":member", Resource: res})
+	require.ErrorContains(t, err, "managed through jwt group mappings")
+	require.Len(t, srv.Memberships(), 1, "only the All Users membership")
+}
+
+func TestE2ESSOGroupMappingActions(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	analysts := srv.AddGroup("Analysts")
+	srv.SetSetting("saml-group-mappings", map[string]any{"admins": []int{2}})
+
+	conn := newE2EConnector(t, srv)
+	analystsID := strconv.Itoa(analysts.ID)
+
+	_, _, err := conn.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "analysts", analystsID))
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"admins":   []any{float64(2)},
+		"analysts": []any{float64(analysts.ID)},
+	}, srv.Setting("saml-group-mappings"))
+
+	_, _, err = conn.RemoveSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "admins", "2"))
+	require.ErrorContains(t, err, "last saml mapping to the Administrators group")
+
+	_, _, err = conn.RemoveSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "analysts", analystsID))
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"admins": []any{float64(2)}}, srv.Setting("saml-group-mappings"))
+}
+
+func TestE2EGroupLifecycle(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	conn := newE2EConnector(t, srv)
+	groups := newGroupBuilder(conn.client, groupSyncOptions{})
+
+	res, _, err := groups.Create(ctx, &v2.Resource{DisplayName: "Analysts"})
+	require.NoError(t, err)
+	groupID := res.Id.Resource
+
+	_, _, err = groups.Create(ctx, &v2.Resource{DisplayName: "Analysts"})
+	require.ErrorContains(t, err, "already exists")
+
+	args, _ := structpb.NewStruct(map[string]interface{}{"groupId": groupID, "name": "Data Analysts"})
+	_, _, err = conn.RenameGroup(ctx, args)
+	require.NoError(t, err)
+
+	id, _ := strconv.Atoi(groupID)
+	srv.SetCollectionPermission(id, "root", "read")
+
+	_, err = groups.Delete(ctx, res.Id)
+	require.ErrorContains(t, err, "still has permissions on collections root")
+
+	args, _ = structpb.NewStruct(map[string]interface{}{"groupId": groupID, "force": true})
+	_, _, err = conn.DeleteGroup(ctx, args)
+	require.NoError(t, err)
+
+	names := make([]string, 0)
+	for _, g := range srv.Groups() {
+		names = append(names, g.Name)
+	}
+	require.Equal(t, []string{"All Users", "Administrators"}, names)
+
+	_, err = groups.Delete(ctx, res.Id)
+	require.NoError(t, err, "deleting a group that is gone is a no-op")
+}
+
+func TestE2EGroupPaging(t *testing.T) {
+	ctx := context.Background()
+
+	for _, unsupported := range []bool{false, true} {
+		// 7 groups: 5 added and the 2 built-in ones. A page size of 7 is one full page.
+		for pageSize, wantPages := range map[int]int{3: 3, 7: 2} {
+			t.Run(fmt.Sprintf("paging unsupported=%t page size %d", unsupported, pageSize), func(t *testing.T) {
+				srv := metabasetest.NewServer()
+				defer srv.Close()
+				srv.GroupPagingUnsupported = unsupported
+
+				for i := range 5 {
+					srv.AddGroup(fmt.Sprintf("Group %d", i))
+				}
+
+				conn := newE2EConnector(t, srv)
+				groups := newGroupBuilder(conn.client, groupSyncOptions{})
+
+				var ids []string
+				pages := 0
+				token := &pagination.Token{Size: pageSize}
+				for {
+					resources, next, _, err := groups.List(ctx, nil, token)
+					require.NoError(t, err)
+					pages++
+					require.LessOrEqual(t, pages, wantPages, "paging must stop")
+					for _, res := range resources {
+						ids = append(ids, res.Id.Resource)
+					}
+					if next == "" {
+						break
+					}
+					token = &pagination.Token{Size: pageSize, Token: next}
+				}
+
+				require.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7"}, ids)
+				require.Equal(t, wantPages, pages)
+				require.Equal(t, 1, countRequests(srv, "GET /api/setting/saml-group-sync"), "mappings are read once per sync")
+			})
+		}
+	}
+}
+
+func TestE2EGroupFilters(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	team := srv.AddGroup("team-data")
+	tenant := srv.AddGroup("tenant-acme")
+	ana := srv.AddUser("ana.gomez@example.com", "Ana", "Gomez")
+	srv.AddMembership(ana.ID, team.ID, false)
+	srv.AddMembership(ana.ID, tenant.ID, false)
+
+	filter, err := newGroupFilter("", "^tenant-", nil, []string{strconv.Itoa(metabasetest.AdministratorsGroupID)})
+	require.NoError(t, err)
+
+	conn := newE2EConnector(t, srv)
+	groups := newGroupBuilder(conn.client, groupSyncOptions{filter: filter})
+	resources, _, _, err := groups.List(ctx, nil, &pagination.Token{})
+	require.NoError(t, err)
+	var names []string
+	for _, res := range resources {
+		names = append(names, res.DisplayName)
+	}
+	require.Equal(t, []string{"All Users", "team-data"}, names)
+
+	users := newUserBuilder(conn.client, userSyncOptions{groupFilter: filter})
+	userResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: strconv.Itoa(ana.ID)}}
+	grants, _, _, err := users.Grants(ctx, userResource, nil)
+	require.NoError(t, err)
+	var granted []string
+	for _, g := range grants {
+		granted = append(granted, g.Entitlement.Resource.Id.Resource)
+	}
+	require.ElementsMatch(t, []string{"1", strconv.Itoa(team.ID)}, granted)
+}
+
+func TestE2ESandboxes(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	tenants := srv.AddGroup("Tenants")
+	srv.AddDatabase(1, "Warehouse", "postgres")
+	orders := srv.AddTable(1, 10, "public", "orders")
+	srv.AddTable(1, 11, "public", "customers")
+	srv.AddSandbox(tenants.ID, orders.ID, nil, map[string]any{"tenant_id": []any{"dimension", []any{"field", 101, nil}}})
+
+	conn := newE2EConnector(t, srv)
+	require.Len(t, conn.ResourceSyncers(ctx), 6)
+
+	databases, _, _, err := newDatabaseBuilder(conn.client, nil).List(ctx, nil, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, databases, 1)
+
+	tables := newTableBuilder(conn.client, tableSyncOptions{})
+	resources, _, _, err := tables.List(ctx, databases[0].Id, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	require.Equal(t, "public.orders", resources[0].DisplayName)
+
+	grants, _, _, err := tables.Grants(ctx, resources[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, strconv.Itoa(tenants.ID), grants[0].Principal.Id.Resource)
+	require.Contains(t, grantMetadata(t, grants[0]), "attribute_remappings")
+
+	grants, _, _, err = tables.Grants(ctx, resources[1], &pagination.Token{})
+	require.NoError(t, err)
+	require.Empty(t, grants)
+
+	srv.PaidPlan = false
+	require.Len(t, newE2EConnector(t, srv).ResourceSyncers(ctx), 3)
+}
+
+func TestE2EImpersonations(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	analysts := srv.AddGroup("Analysts")
+	srv.AddDatabase(1, "Snowflake", "snowflake")
+	srv.AddDatabase(2, "Postgres", "postgres")
+	srv.AddImpersonation(analysts.ID, 1, "snowflake_role")
+
+	conn := newE2EConnector(t, srv)
+	databases := newDatabaseBuilder(conn.client, nil)
+	resources, _, _, err := databases.List(ctx, nil, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+
+	grants, _, _, err := databases.Grants(ctx, resources[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, strconv.Itoa(analysts.ID), grants[0].Principal.Id.Resource)
+	require.Equal(t, "snowflake_role", grantMetadata(t, grants[0])["attribute"])
+
+	grants, _, _, err = databases.Grants(ctx, resources[1], &pagination.Token{})
+	require.NoError(t, err)
+	require.Empty(t, grants)
+}
+
+func TestE2EDatabasePermissions(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	analysts := srv.AddGroup("Analysts")
+	srv.AddDatabase(1, "Warehouse", "postgres")
+	srv.AddDatabase(2, "Events", "snowflake")
+	srv.SetPermissionsGraph(analysts.ID, map[string]any{
+		"1": map[string]any{"view-data": "unrestricted", "download": map[string]any{"schemas": "limited"}},
+		"2": map[string]any{"details": "yes"},
+	})
+
+	conn := newE2EConnector(t, srv)
+	databases := newDatabaseBuilder(conn.client, nil)
+	resources, _, _, err := databases.List(ctx, nil, &pagination.Token{})
+	require.NoError(t, err)
+
+	grants, _, _, err := databases.Grants(ctx, resources[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, "database:1:download_limited", grants[0].Entitlement.Id)
+
+	group := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: strconv.Itoa(analysts.ID)}}
+	_, err = databases.Grant(ctx, group, &v2.Entitlement{Id: "database:1:download_full", Resource: resources[0]})
+	require.NoError(t, err)
+	_, err = databases.Grant(ctx, group, &v2.Entitlement{Id: "database:1:data_model", Resource: resources[0]})
+	require.NoError(t, err)
+
+	perms := srv.PermissionsGraph(analysts.ID)
+	require.Equal(t, map[string]any{
+		"view-data":  "unrestricted",
+		"download":   map[string]any{"schemas": "full"},
+		"data-model": map[string]any{"schemas": "all"},
+	}, perms["1"])
+	require.Equal(t, map[string]any{"details": "yes"}, perms["2"])
+
+	grants, _, _, err = databases.Grants(ctx, resources[1], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	_, err = databases.Revoke(ctx, grants[0])
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"details": "no"}, srv.PermissionsGraph(analysts.ID)["2"])
+}
+
+func TestE2EApplicationPermissions(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	ops := srv.AddGroup("Ops")
+	srv.SetApplicationPermission(ops.ID, "monitoring", "yes")
+	srv.SetApplicationPermission(ops.ID, "setting", "no")
+
+	conn := newE2EConnector(t, srv)
+	applications := newApplicationBuilder(conn.client, nil)
+	resources, _, _, err := applications.List(ctx, nil, &pagination.Token{})
+	require.NoError(t, err)
+
+	grants, _, _, err := applications.Grants(ctx, resources[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, "application:metabase:monitoring", grants[0].Entitlement.Id)
+
+	group := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: strconv.Itoa(ops.ID)}}
+	_, err = applications.Grant(ctx, group, &v2.Entitlement{Id: "application:metabase:setting", Resource: resources[0]})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"monitoring": "yes", "setting": "yes"}, srv.ApplicationPermissions(ops.ID))
+
+	_, err = applications.Revoke(ctx, grants[0])
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"monitoring": "no", "setting": "yes"}, srv.ApplicationPermissions(ops.ID))
+}
+
+func TestE2ESandboxProvisioning(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	tenants := srv.AddGroup("Tenants")
+	srv.AddDatabase(1, "Warehouse", "postgres")
+	srv.AddTable(1, 10, "public", "orders", "id", "tenant_id")
+	srv.AddTable(1, 11, "public", "customers", "id")
+	srv.SetPermissionsGraph(tenants.ID, map[string]any{"1": map[string]any{"view-data": "unrestricted"}})
+
+	remappings, err := parseSandboxRemappings([]string{"tenant=public.orders.tenant_id"})
+	require.NoError(t, err)
+	conn := newE2EConnector(t, srv)
+	tables := newTableBuilder(conn.client, tableSyncOptions{sandboxRemappings: remappings})
+
+	group := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: strconv.Itoa(tenants.ID)}}
+	table := &v2.Resource{Id: &v2.ResourceId{ResourceType: TableResourceType.Id, Resource: "10"}}
+	entitlement := &v2.Entitlement{Id: "table:10:sandboxed", Resource: table}
+
+	_, err = tables.Grant(ctx, group, entitlement)
+	require.NoError(t, err)
+
+	sandboxes := srv.Sandboxes()
+	require.Len(t, sandboxes, 1)
+	require.Equal(t, tenants.ID, sandboxes[0].GroupID)
+	require.Equal(t, map[string]any{"tenant": []any{"dimension", []any{"field", float64(1002), nil}}}, sandboxes[0].AttributeRemappings)
+	require.Equal(t, map[string]any{"public": map[string]any{"10": "sandboxed", "11": "unrestricted"}},
+		srv.PermissionsGraph(tenants.ID)["1"].(map[string]any)["view-data"])
+
+	ann, err := tables.Grant(ctx, group, entitlement)
+	require.NoError(t, err)
+	require.True(t, ann.Contains(&v2.GrantAlreadyExists{}))
+
+	grants, _, _, err := tables.Grants(ctx, table, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+
+	_, err = tables.Revoke(ctx, grants[0])
+	require.NoError(t, err)
+	require.Empty(t, srv.Sandboxes())
+	require.Equal(t, map[string]any{"public": map[string]any{"10": "blocked", "11": "unrestricted"}},
+		srv.PermissionsGraph(tenants.ID)["1"].(map[string]any)["view-data"])
+
+	ann, err = tables.Revoke(ctx, grants[0])
+	require.NoError(t, err)
+	require.True(t, ann.Contains(&v2.GrantAlreadyRevoked{}))
+
+	_, err = tables.Grant(ctx, group, &v2.Entitlement{Id: "table:11:sandboxed", Resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: TableResourceType.Id, Resource: "11"}}})
+	require.ErrorContains(t, err, "no sandbox attribute remapping")
+	require.Empty(t, srv.Sandboxes())
+}
+
+func TestE2EEffectivePermissions(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	user := srv.AddUser("ada@example.com", "Ada", "Lovelace")
+	analysts := srv.AddGroup("Analysts")
+	srv.AddMembership(user.ID, analysts.ID, false)
+	srv.SetPermissionsGraph(metabasetest.AllUsersGroupID, map[string]any{"1": map[string]any{"view-data": "blocked"}})
+	srv.SetPermissionsGraph(analysts.ID, map[string]any{"1": map[string]any{"view-data": "unrestricted"}})
+	srv.SetCollectionPermission(metabasetest.AllUsersGroupID, "root", "read")
+	srv.SetApplicationPermission(analysts.ID, "subscription", "yes")
+
+	conn := newE2EConnector(t, srv)
+	args, _ := structpb.NewStruct(map[string]interface{}{"userId": strconv.Itoa(user.ID)})
+	resp, _, err := conn.EffectivePermissions(ctx, args)
+	require.NoError(t, err)
+
+	var groups, permissions []string
+	for _, v := range resp.Fields["groups"].GetListValue().GetValues() {
+		groups = append(groups, v.GetStringValue())
+	}
+	for _, v := range resp.Fields["permissions"].GetListValue().GetValues() {
+		permissions = append(permissions, v.GetStringValue())
+	}
+	require.Equal(t, []string{"All Users (1)", fmt.Sprintf("Analysts (%d)", analysts.ID)}, groups)
+	require.Equal(t, []string{
+		fmt.Sprintf("database 1: view-data unrestricted (via Analysts (%d))", analysts.ID),
+		"collection root: read (via All Users (1))",
+		fmt.Sprintf("application: subscription yes (via Analysts (%d))", analysts.ID),
+	}, permissions)
+
+	args, _ = structpb.NewStruct(map[string]interface{}{"userId": "999"})
+	_, _, err = conn.EffectivePermissions(ctx, args)
+	require.Error(t, err)
+}
+
+func TestE2EBulkUpdateGroupMembers(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	ada := srv.AddUser("ada@example.com", "Ada", "Lovelace")
+	grace := srv.AddUser("grace@example.com", "Grace", "Hopper")
+	linus := srv.AddUser("linus@example.com", "Linus", "Torvalds")
+	analysts := srv.AddGroup("Analysts")
+	srv.AddMembership(linus.ID, analysts.ID, false)
+
+	conn := newE2EConnector(t, srv)
+	args, _ := structpb.NewStruct(map[string]interface{}{
+		"groupId": strconv.Itoa(analysts.ID),
+		"add":     []any{"ada@example.com", strconv.Itoa(grace.ID)},
+		"remove":  []any{"linus@example.com"},
+	})
+	resp, _, err := conn.BulkUpdateGroupMembers(ctx, args)
+	require.NoError(t, err)
+	require.True(t, resp.Fields["success"].GetBoolValue())
+
+	var members []int
+	for _, m := range srv.Memberships() {
+		if m.GroupID == analysts.ID {
+			members = append(members, m.UserID)
+		}
+	}
+	require.ElementsMatch(t, []int{ada.ID, grace.ID}, members)
+}
+
+func TestE2EUnauthenticated(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.APIKey = "rotated"
+
+	c, err := client.New(ctx, srv.URL, metabasetest.DefaultAPIKey, false)
+	require.NoError(t, err)
+
+	_, _, _, err = c.ListUsers(ctx, client.PageOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "status 401")
+	require.Contains(t, err.Error(), "Unauthenticated")
+}
@@ -0,0 +1,367 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Scopes of an effective permission, in report order.
+const (
+	scopeDatabase    = "database"
+	scopeCollection  = "collection"
+	scopeApplication = "application"
+)
+
+// permissionRanks orders the levels of each permission from least to most permissive. Metabase
+// grants are additive across groups, so a user holds the highest level any of their groups has.
+var permissionRanks = map[string][]string{
+	"view-data":      {"blocked", "legacy-no-self-service", "sandboxed", "impersonated", "unrestricted"},
+	"create-queries": {"no", "query-builder", "query-builder-and-native"},
+	"download":       {"none", "limited", "full"},
+	"data-model":     {"none", "all"},
+	"details":        {"no", "yes"},
+	scopeCollection:  {"none", "read", "write"},
+	"setting":        {"no", "yes"},
+	"monitoring":     {"no", "yes"},
+	"subscription":   {"no", "yes"},
+}
+
+// dataPermissions are the per-database permissions of the data permissions graph, in report order.
+var dataPermissions = []string{"view-data", "create-queries", "download", "data-model", "details"}
+
+// permissionKey identifies one permission of a database, schema, collection or the application.
+type permissionKey struct {
+	scope string
+	// id is the database or collection ID, and empty for the application.
+	id string
+	// schema is set when the level applies to one schema of the database rather than all of it.
+	schema string
+	// table is set when the level applies to one table of the schema rather than all of it.
+	table      string
+	permission string
+}
+
+// effectivePermission is the level a user holds for one permission, and the groups that supply it.
+type effectivePermission struct {
+	permissionKey
+	level  string
+	groups []int
+}
+
+func permissionRank(permission, level string) int {
+	for i, l := range permissionRanks[permission] {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// effectivePermissions folds the permission graphs of groups into the most permissive level per
+// database, schema, table, collection and application permission.
+type effectivePermissions struct {
+	levels map[permissionKey]*effectivePermission
+}
+
+func newEffectivePermissions() *effectivePermissions {
+	return &effectivePermissions{levels: make(map[permissionKey]*effectivePermission)}
+}
+
+// add records that groupID holds level. A higher level replaces the current one, and the same
+// level adds the group to the groups supplying it.
+func (e *effectivePermissions) add(key permissionKey, level string, groupIDs ...int) {
+	current, ok := e.levels[key]
+	switch {
+	case !ok || permissionRank(key.permission, level) > permissionRank(key.permission, current.level):
+		e.levels[key] = &effectivePermission{
+			permissionKey: key,
+			level:         level,
+			groups:        append([]int(nil), groupIDs...),
+		}
+	case current.level == level:
+		for _, groupID := range groupIDs {
+			if !containsInt(current.groups, groupID) {
+				current.groups = append(current.groups, groupID)
+			}
+		}
+	}
+}
+
+// addDataPermissions folds a group's document for a database. Levels set per schema or per table
+// are kept at that scope, so a schema is never reported with a level only some of its tables have.
+func (e *effectivePermissions) addDataPermissions(groupID int, databaseID string, perms map[string]any) {
+	for _, permission := range dataPermissions {
+		value := perms[permission]
+		if nested, ok := value.(map[string]any); ok && (permission == "download" || permission == "data-model") {
+			value = nested["schemas"]
+		}
+
+		key := permissionKey{scope: scopeDatabase, id: databaseID, permission: permission}
+		switch v := value.(type) {
+		case string:
+			e.add(key, v, groupID)
+		case map[string]any:
+			for schema, schemaValue := range v {
+				key.schema, key.table = schema, ""
+				switch sv := schemaValue.(type) {
+				case string:
+					e.add(key, sv, groupID)
+				case map[string]any:
+					for table, level := range sv {
+						if level, ok := level.(string); ok {
+							key.table = table
+							e.add(key, level, groupID)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// list returns the effective permissions in report order. A level a group holds on a whole
+// database also applies to each schema and table some other group has a level on, and a level on a
+// whole schema to each of its tables.
+func (e *effectivePermissions) list() []*effectivePermission {
+	held := make(map[permissionKey]effectivePermission, len(e.levels))
+	for key, entry := range e.levels {
+		held[key] = effectivePermission{level: entry.level, groups: append([]int(nil), entry.groups...)}
+	}
+	for key := range held {
+		if key.scope != scopeDatabase || key.schema == "" {
+			continue
+		}
+		wider := []permissionKey{{scope: key.scope, id: key.id, permission: key.permission}}
+		if key.table != "" {
+			wider = append(wider, permissionKey{scope: key.scope, id: key.id, schema: key.schema, permission: key.permission})
+		}
+		for _, widerKey := range wider {
+			if entry, ok := held[widerKey]; ok {
+				e.add(key, entry.level, entry.groups...)
+			}
+		}
+	}
+
+	out := make([]*effectivePermission, 0, len(e.levels))
+	for _, entry := range e.levels {
+		sort.Ints(entry.groups)
+		out = append(out, entry)
+	}
+
+	scopeOrder := map[string]int{scopeDatabase: 0, scopeCollection: 1, scopeApplication: 2}
+	permissionOrder := make(map[string]int)
+	for i, permission := range dataPermissions {
+		permissionOrder[permission] = i
+	}
+	for i, permission := range applicationPermissions {
+		permissionOrder[permission.name] = len(dataPermissions) + i
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.scope != b.scope {
+			return scopeOrder[a.scope] < scopeOrder[b.scope]
+		}
+		if a.id != b.id {
+			return idLess(a.id, b.id)
+		}
+		if a.schema != b.schema {
+			return a.schema < b.schema
+		}
+		if a.table != b.table {
+			return a.table == "" || (b.table != "" && idLess(a.table, b.table))
+		}
+		return permissionOrder[a.permission] < permissionOrder[b.permission]
+	})
+	return out
+}
+
+// idLess orders numeric IDs numerically and puts them before other IDs such as "root".
+func idLess(a, b string) bool {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return ai < bi
+	case aErr == nil:
+		return true
+	case bErr == nil:
+		return false
+	}
+	return a < b
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// userEffectivePermissions resolves the groups of a user and folds the data, collection and, on paid
+// plans, application permission graphs of those groups.
+func userEffectivePermissions(ctx context.Context, c client.ClientService, userID string) ([]int, []*effectivePermission, *v2.RateLimitDescription, error) {
+	memberships, rateLimitDesc, err := c.ListMemberships(ctx)
+	if err != nil {
+		return nil, nil, rateLimitDesc, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	groupIDs := make([]int, 0, len(memberships[userID]))
+	for _, m := range memberships[userID] {
+		groupIDs = append(groupIDs, m.GroupID)
+	}
+	sort.Ints(groupIDs)
+
+	effective := newEffectivePermissions()
+
+	dataGraph, rl, err := c.GetPermissionsGraph(ctx)
+	rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+	if err != nil {
+		return nil, nil, rateLimitDesc, err
+	}
+	for _, groupID := range groupIDs {
+		for databaseID, perms := range dataGraph.Groups[strconv.Itoa(groupID)] {
+			if databasePerms, ok := perms.(map[string]any); ok {
+				effective.addDataPermissions(groupID, databaseID, databasePerms)
+			}
+		}
+	}
+
+	collectionGraph, rl, err := c.GetCollectionGraph(ctx)
+	rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+	if err != nil {
+		return nil, nil, rateLimitDesc, err
+	}
+	for _, groupID := range groupIDs {
+		for collectionID, level := range collectionGraph.Groups[strconv.Itoa(groupID)] {
+			if level, ok := level.(string); ok {
+				effective.add(permissionKey{scope: scopeCollection, id: collectionID, permission: scopeCollection}, level, groupID)
+			}
+		}
+	}
+
+	if c.IsPaidPlan() {
+		applicationGraph, rl, err := c.GetApplicationGraph(ctx)
+		rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+		if err != nil {
+			return nil, nil, rateLimitDesc, err
+		}
+		for _, groupID := range groupIDs {
+			for permission, level := range applicationGraph.Groups[strconv.Itoa(groupID)] {
+				if level, ok := level.(string); ok {
+					effective.add(permissionKey{scope: scopeApplication, permission: permission}, level, groupID)
+				}
+			}
+		}
+	}
+
+	return groupIDs, effective.list(), rateLimitDesc, nil
+}
+
+// describe renders an effective permission as a report line, naming the groups that supply it.
+func (p *effectivePermission) describe(groupNames map[int]string) string {
+	var target string
+	switch {
+	case p.scope == scopeApplication:
+		target = scopeApplication
+	case p.table != "":
+		target = fmt.Sprintf("%s %s schema %s table %s", p.scope, p.id, p.schema, p.table)
+	case p.schema != "":
+		target = fmt.Sprintf("%s %s schema %s", p.scope, p.id, p.schema)
+	default:
+		target = fmt.Sprintf("%s %s", p.scope, p.id)
+	}
+
+	permission := p.permission + " "
+	if p.scope == scopeCollection {
+		permission = ""
+	}
+
+	return fmt.Sprintf("%s: %s%s (via %s)", target, permission, p.level, describeGroups(p.groups, groupNames))
+}
+
+func describeGroups(groupIDs []int, groupNames map[int]string) string {
+	names := make([]string, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		name, ok := groupNames[groupID]
+		if !ok {
+			name = "group"
+		}
+		names = append(names, fmt.Sprintf("%s (%d)", name, groupID))
+	}
+	return strings.Join(names, ", ")
+}
+
+// EffectivePermissions reports what a user can do: the most permissive level the user holds through
+// any of their groups for each database, schema, table, collection and application permission, along with
+// the groups that supply it.
+func (c *Connector) EffectivePermissions(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+
+	if args == nil || args.Fields == nil {
+		return nil, nil, fmt.Errorf("arguments cannot be nil")
+	}
+	userID := args.Fields["userId"].GetStringValue()
+	if userID == "" {
+		return nil, nil, fmt.Errorf("userId cannot be empty")
+	}
+
+	l.Info("resolving effective permissions", zap.String("userId", userID))
+
+	_, rateLimitDesc, err := c.client.GetUserByID(ctx, userID)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, fmt.Errorf("failed to get user %s: %w", userID, err)
+	}
+
+	groupIDs, permissions, rateLimitDesc, err := userEffectivePermissions(ctx, c.client, userID)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, fmt.Errorf("failed to resolve effective permissions of user %s: %w", userID, err)
+	}
+
+	groups, rateLimitDesc, err := c.client.ListGroups(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, fmt.Errorf("failed to list groups: %w", err)
+	}
+	groupNames := make(map[int]string, len(groups))
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+
+	groupValues := make([]*structpb.Value, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		groupValues = append(groupValues, structpb.NewStringValue(describeGroups([]int{groupID}, groupNames)))
+	}
+	permissionValues := make([]*structpb.Value, 0, len(permissions))
+	for _, permission := range permissions {
+		permissionValues = append(permissionValues, structpb.NewStringValue(permission.describe(groupNames)))
+	}
+
+	response := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"groups":      structpb.NewListValue(&structpb.ListValue{Values: groupValues}),
+			"permissions": structpb.NewListValue(&structpb.ListValue{Values: permissionValues}),
+		},
+	}
+	return response, ann, nil
+}
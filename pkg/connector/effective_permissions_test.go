@@ -0,0 +1,131 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestUserEffectivePermissions(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &client.MockService{
+		ListMembershipsFunc: func(ctx context.Context) (map[string][]*client.Membership, *v2.RateLimitDescription, error) {
+			return map[string][]*client.Membership{
+				"7": {{GroupID: 1, UserID: 7}, {GroupID: 3, UserID: 7}, {GroupID: 4, UserID: 7}},
+				"8": {{GroupID: 5, UserID: 8}},
+			}, nil, nil
+		},
+		GetPermissionsGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{
+				"1": {"1": map[string]any{"view-data": "unrestricted", "create-queries": "no"}},
+				"3": {"1": map[string]any{
+					"view-data":      "unrestricted",
+					"create-queries": map[string]any{"public": "query-builder", "sales": map[string]any{"12": "query-builder-and-native", "13": "no"}},
+					"download":       map[string]any{"schemas": "limited"},
+				}},
+				"4": {"1": map[string]any{"create-queries": map[string]any{"public": "no"}, "download": map[string]any{"schemas": "full"}}},
+				"5": {"1": map[string]any{"details": "yes"}},
+			}}, nil, nil
+		},
+		GetCollectionGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{
+				"1": {"root": "read", "9": "none"},
+				"4": {"root": "write", "10": "read"},
+			}}, nil, nil
+		},
+		IsPaidPlanFunc: func() bool { return true },
+		GetApplicationGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{
+				"3": {"setting": "no", "monitoring": "yes"},
+				"4": {"setting": "no", "monitoring": "yes"},
+			}}, nil, nil
+		},
+	}
+
+	groupIDs, permissions, _, err := userEffectivePermissions(ctx, mockClient, "7")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 3, 4}, groupIDs)
+
+	groupNames := map[int]string{1: "All Users", 3: "Analysts", 4: "Finance"}
+	lines := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		lines = append(lines, permission.describe(groupNames))
+	}
+	require.Equal(t, []string{
+		"database 1: view-data unrestricted (via All Users (1), Analysts (3))",
+		"database 1: create-queries no (via All Users (1))",
+		"database 1: download full (via Finance (4))",
+		"database 1 schema public: create-queries query-builder (via Analysts (3))",
+		"database 1 schema sales table 12: create-queries query-builder-and-native (via Analysts (3))",
+		"database 1 schema sales table 13: create-queries no (via All Users (1), Analysts (3))",
+		"collection 9: none (via All Users (1))",
+		"collection 10: read (via Finance (4))",
+		"collection root: write (via Finance (4))",
+		"application: setting no (via Analysts (3), Finance (4))",
+		"application: monitoring yes (via Analysts (3), Finance (4))",
+	}, lines)
+
+	t.Run("schema level applies to its tables", func(t *testing.T) {
+		tables := *mockClient
+		tables.GetPermissionsGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{
+				"3": {"1": map[string]any{"view-data": map[string]any{"public": map[string]any{"10": "blocked", "11": "unrestricted"}}}},
+				"4": {"1": map[string]any{"view-data": map[string]any{"public": "sandboxed"}}},
+			}}, nil, nil
+		}
+		tables.GetCollectionGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{}, nil, nil
+		}
+		tables.IsPaidPlanFunc = nil
+
+		_, permissions, _, err := userEffectivePermissions(ctx, &tables, "7")
+		require.NoError(t, err)
+		lines := make([]string, 0, len(permissions))
+		for _, permission := range permissions {
+			lines = append(lines, permission.describe(groupNames))
+		}
+		require.Equal(t, []string{
+			"database 1 schema public: view-data sandboxed (via Finance (4))",
+			"database 1 schema public table 10: view-data sandboxed (via Finance (4))",
+			"database 1 schema public table 11: view-data unrestricted (via Analysts (3))",
+		}, lines)
+	})
+
+	t.Run("application graph only read on paid plans", func(t *testing.T) {
+		free := *mockClient
+		free.IsPaidPlanFunc = nil
+		free.GetApplicationGraphFunc = nil
+
+		_, permissions, _, err := userEffectivePermissions(ctx, &free, "8")
+		require.NoError(t, err)
+		require.Len(t, permissions, 1)
+		require.Equal(t, "details", permissions[0].permission)
+	})
+
+	t.Run("rate limit returned", func(t *testing.T) {
+		failing := *mockClient
+		failing.GetCollectionGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return nil, &v2.RateLimitDescription{Limit: 10}, fmt.Errorf("rate limit error")
+		}
+
+		_, _, rateLimitDesc, err := userEffectivePermissions(ctx, &failing, "7")
+		require.Error(t, err)
+		require.NotNil(t, rateLimitDesc)
+	})
+}
+
+func TestEffectivePermissionsAction(t *testing.T) {
+	ctx := context.Background()
+	conn := &Connector{client: &client.MockService{}}
+
+	_, _, err := conn.EffectivePermissions(ctx, &structpb.Struct{Fields: map[string]*structpb.Value{}})
+	require.ErrorContains(t, err, "userId cannot be empty")
+
+	_, _, err = conn.EffectivePermissions(ctx, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,405 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	accessChangesFeedID = "metabase_access_changes"
+
+	eventsPageSize = 100
+
+	eventSourceAudit = "audit"
+	eventSourcePoll  = "poll"
+)
+
+// auditTopics maps v_audit_log topics to the kind of event the feed emits for them.
+// Topics that are not listed here are skipped.
+var auditTopics = map[string]string{
+	"user-invited":             auditKindUserChanged,
+	"user-joined":              auditKindUserChanged,
+	"user-update":              auditKindUserChanged,
+	"user-deactivated":         auditKindUserChanged,
+	"user-reactivated":         auditKindUserChanged,
+	"group-membership-create":  auditKindMembershipAdded,
+	"group-membership-delete":  auditKindMembershipRemoved,
+	"permissions-graph-update": auditKindGraphChanged,
+}
+
+const (
+	auditKindUserChanged       = "user_changed"
+	auditKindMembershipAdded   = "membership_added"
+	auditKindMembershipRemoved = "membership_removed"
+	auditKindGraphChanged      = "graph_changed"
+)
+
+// eventCursor is the resumable position of the access changes feed, serialized as JSON.
+// Audit cursors only need the last audit log ID. Poll cursors need the time of the last poll and
+// the permissions graph revision seen then, which is nil until the first poll.
+type eventCursor struct {
+	Source        string    `json:"source"`
+	Since         time.Time `json:"since"`
+	LastAuditID   int       `json:"last_audit_id,omitempty"`
+	GraphRevision *int      `json:"graph_revision,omitempty"`
+}
+
+// accessChangesFeed emits user lifecycle, group membership and data permission changes.
+// On paid plans it reads Metabase's audit log. Otherwise, or when the audit database is not
+// available, it polls the user timestamps and the permissions graph revision. Metabase keeps no
+// history of group memberships outside the audit log, so polling never emits membership grants
+// or revokes; those changes are picked up by the next sync.
+type accessChangesFeed struct {
+	client client.ClientService
+	now    func() time.Time
+
+	mu        sync.Mutex
+	auditLog  *auditTable
+	auditDown bool
+}
+
+func newAccessChangesFeed(client client.ClientService) *accessChangesFeed {
+	return &accessChangesFeed{
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// EventFeedMetadata only advertises membership grants and revokes on paid plans, since they are
+// read from the audit log, which free plans do not have.
+func (f *accessChangesFeed) EventFeedMetadata(_ context.Context) *v2.EventFeedMetadata {
+	eventTypes := []v2.EventType{v2.EventType_EVENT_TYPE_RESOURCE_CHANGE}
+	if f.client.IsPaidPlan() {
+		eventTypes = append(eventTypes, v2.EventType_EVENT_TYPE_CREATE_GRANT, v2.EventType_EVENT_TYPE_CREATE_REVOKE)
+	}
+	return v2.EventFeedMetadata_builder{
+		Id:                  accessChangesFeedID,
+		SupportedEventTypes: eventTypes,
+	}.Build()
+}
+
+func (f *accessChangesFeed) ListEvents(
+	ctx context.Context,
+	earliestEvent *timestamppb.Timestamp,
+	pToken *pagination.StreamToken,
+) ([]*v2.Event, *pagination.StreamState, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	var cursor *eventCursor
+	if pToken != nil && pToken.Cursor != "" {
+		cursor = &eventCursor{}
+		if err := json.Unmarshal([]byte(pToken.Cursor), cursor); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid event cursor: %w", err)
+		}
+	}
+
+	if cursor == nil {
+		since := f.now().UTC()
+		if earliestEvent != nil {
+			since = earliestEvent.AsTime()
+		}
+		cursor = &eventCursor{Source: eventSourcePoll, Since: since}
+
+		auditLog, rateLimitDesc, err := f.auditLogTable(ctx)
+		if rateLimitDesc != nil {
+			ann.WithRateLimiting(rateLimitDesc)
+		}
+		if err != nil {
+			return nil, nil, ann, err
+		}
+		if auditLog != nil {
+			cursor.Source = eventSourceAudit
+		}
+	}
+
+	pageSize := eventsPageSize
+	if pToken != nil && pToken.Size > 0 {
+		pageSize = pToken.Size
+	}
+
+	var (
+		events        []*v2.Event
+		hasMore       bool
+		rateLimitDesc *v2.RateLimitDescription
+		err           error
+	)
+	switch cursor.Source {
+	case eventSourceAudit:
+		events, hasMore, rateLimitDesc, err = f.listAuditEvents(ctx, cursor, pageSize)
+	case eventSourcePoll:
+		events, rateLimitDesc, err = f.pollEvents(ctx, cursor)
+	default:
+		return nil, nil, nil, fmt.Errorf("invalid event cursor: unknown source %q", cursor.Source)
+	}
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, nil, ann, err
+	}
+
+	nextCursor, err := json.Marshal(cursor)
+	if err != nil {
+		return nil, nil, ann, fmt.Errorf("failed to encode event cursor: %w", err)
+	}
+
+	return events, &pagination.StreamState{Cursor: string(nextCursor), HasMore: hasMore}, ann, nil
+}
+
+// auditLogTable looks up the audit log view once and remembers whether it is available.
+func (f *accessChangesFeed) auditLogTable(ctx context.Context) (*auditTable, *v2.RateLimitDescription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.auditLog != nil || f.auditDown {
+		return f.auditLog, nil, nil
+	}
+
+	table, rateLimitDesc, err := findAuditTable(ctx, f.client, auditLogTable)
+	if err != nil {
+		return nil, rateLimitDesc, err
+	}
+	f.auditLog = table
+	f.auditDown = table == nil
+
+	return table, rateLimitDesc, nil
+}
+
+func (f *accessChangesFeed) listAuditEvents(ctx context.Context, cursor *eventCursor, pageSize int) ([]*v2.Event, bool, *v2.RateLimitDescription, error) {
+	auditLog, rateLimitDesc, err := f.auditLogTable(ctx)
+	if err != nil {
+		return nil, false, rateLimitDesc, err
+	}
+	if auditLog == nil {
+		return nil, false, rateLimitDesc, fmt.Errorf("audit log is no longer available")
+	}
+
+	// Until the first audit entry has been seen, the cursor only knows a start time.
+	filter := []any{">", auditLog.field("id"), cursor.LastAuditID}
+	if cursor.LastAuditID == 0 {
+		filter = []any{">=", auditLog.field("timestamp"), cursor.Since.Format(time.RFC3339Nano)}
+	}
+
+	resp, rateLimitDesc, err := f.client.RunQuery(ctx, &client.DatasetQuery{
+		Database: auditDatabaseID,
+		Type:     "query",
+		Query: map[string]any{
+			"source-table": auditLog.id,
+			"filter":       filter,
+			"order-by":     [][]any{{"asc", auditLog.field("id")}},
+			"limit":        pageSize,
+		},
+	})
+	if err != nil {
+		return nil, false, rateLimitDesc, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var events []*v2.Event
+	for _, row := range datasetRows(resp) {
+		entry := parseAuditRow(row)
+		if entry.id > cursor.LastAuditID {
+			cursor.LastAuditID = entry.id
+		}
+		if entry.timestamp.After(cursor.Since) {
+			cursor.Since = entry.timestamp
+		}
+		events = append(events, auditEntryEvents(entry)...)
+	}
+
+	return events, len(resp.Data.Rows) == pageSize, rateLimitDesc, nil
+}
+
+type auditEntry struct {
+	id        int
+	topic     string
+	timestamp time.Time
+	entityID  int
+	details   map[string]any
+}
+
+func parseAuditRow(row map[string]any) auditEntry {
+	entry := auditEntry{
+		id:       anyToInt(row["id"]),
+		entityID: anyToInt(row["entity_id"]),
+	}
+	entry.topic, _ = row["topic"].(string)
+	if raw, ok := row["timestamp"].(string); ok {
+		entry.timestamp, _ = time.Parse(time.RFC3339Nano, raw)
+	}
+
+	switch details := row["details"].(type) {
+	case map[string]any:
+		entry.details = details
+	case string:
+		_ = json.Unmarshal([]byte(details), &entry.details)
+	}
+
+	return entry
+}
+
+func auditEntryEvents(entry auditEntry) []*v2.Event {
+	eventID := fmt.Sprintf("audit:%d", entry.id)
+	occurredAt := timestamppb.New(entry.timestamp)
+
+	switch auditTopics[entry.topic] {
+	case auditKindUserChanged:
+		return []*v2.Event{resourceChangeEvent(eventID, occurredAt, UserResourceType, strconv.Itoa(entry.entityID))}
+	case auditKindMembershipAdded, auditKindMembershipRemoved:
+		role := MemberPermission
+		if isManager, _ := entry.details["is_group_manager"].(bool); isManager {
+			role = ManagerPermission
+		}
+		return []*v2.Event{membershipEvent(
+			eventID,
+			occurredAt,
+			strconv.Itoa(anyToInt(entry.details["user_id"])),
+			strconv.Itoa(anyToInt(entry.details["group_id"])),
+			role,
+			auditTopics[entry.topic] == auditKindMembershipAdded,
+		)}
+	case auditKindGraphChanged:
+		groups, _ := entry.details["groups"].([]any)
+		events := make([]*v2.Event, 0, len(groups))
+		for _, group := range groups {
+			groupID := fmt.Sprint(group)
+			events = append(events, resourceChangeEvent(eventID+":"+groupID, occurredAt, GroupResourceType, groupID))
+		}
+		return events
+	default:
+		return nil
+	}
+}
+
+// pollEvents reports the users created or updated since the cursor, using the date_joined and
+// updated_at timestamps Metabase keeps on users, and the groups of the permissions graph when its
+// revision moved. The user list has no filter on these timestamps, so every poll lists all users.
+// Without the audit log Metabase keeps no history of memberships, so membership changes are not
+// reported. The graph revision of the first poll is the baseline for the next one.
+func (f *accessChangesFeed) pollEvents(ctx context.Context, cursor *eventCursor) ([]*v2.Event, *v2.RateLimitDescription, error) {
+	polledAt := f.now().UTC()
+
+	var (
+		events        []*v2.Event
+		rateLimitDesc *v2.RateLimitDescription
+	)
+	opts := client.PageOptions{Limit: client.ItemsPerPage}
+	for {
+		users, nextToken, pageRateLimit, err := f.client.ListUsers(ctx, opts)
+		rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, pageRateLimit)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("failed to list users: %w", err)
+		}
+		for _, user := range users {
+			events = append(events, userPollEvents(user, cursor.Since)...)
+		}
+		if nextToken == "" {
+			break
+		}
+		opts.Offset, err = strconv.Atoi(nextToken)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("invalid page token: %w", err)
+		}
+	}
+
+	graph, graphRateLimit, err := f.client.GetPermissionsGraph(ctx)
+	rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, graphRateLimit)
+	if err != nil {
+		return nil, rateLimitDesc, err
+	}
+
+	// The graph carries no history, only its revision: when it moved, every group is reported
+	// so the platform refreshes their permissions.
+	if cursor.GraphRevision != nil && graph.Revision != *cursor.GraphRevision {
+		occurredAt := timestamppb.New(polledAt)
+		groupIDs := make([]string, 0, len(graph.Groups))
+		for groupID := range graph.Groups {
+			groupIDs = append(groupIDs, groupID)
+		}
+		slices.Sort(groupIDs)
+		for _, groupID := range groupIDs {
+			events = append(events, resourceChangeEvent(
+				fmt.Sprintf("graph-changed:%s:%d", groupID, graph.Revision),
+				occurredAt, GroupResourceType, groupID))
+		}
+	}
+
+	revision := graph.Revision
+	cursor.Since = polledAt
+	cursor.GraphRevision = &revision
+
+	return events, rateLimitDesc, nil
+}
+
+// userPollEvents reports a user that joined, or was updated, after since.
+func userPollEvents(user *client.User, since time.Time) []*v2.Event {
+	userID := strconv.Itoa(user.ID)
+	switch {
+	case user.DateJoined != nil && user.DateJoined.After(since):
+		return []*v2.Event{resourceChangeEvent(
+			fmt.Sprintf("user-created:%s:%d", userID, user.DateJoined.UnixNano()),
+			timestamppb.New(*user.DateJoined), UserResourceType, userID)}
+	case user.UpdatedAt != nil && user.UpdatedAt.After(since):
+		kind := "user-updated"
+		if !user.IsActive {
+			kind = "user-deactivated"
+		}
+		return []*v2.Event{resourceChangeEvent(
+			fmt.Sprintf("%s:%s:%d", kind, userID, user.UpdatedAt.UnixNano()),
+			timestamppb.New(*user.UpdatedAt), UserResourceType, userID)}
+	default:
+		return nil
+	}
+}
+
+func resourceChangeEvent(id string, occurredAt *timestamppb.Timestamp, resourceType *v2.ResourceType, resourceID string) *v2.Event {
+	return v2.Event_builder{
+		Id:         id,
+		OccurredAt: occurredAt,
+		ResourceChangeEvent: v2.ResourceChangeEvent_builder{
+			ResourceId: &v2.ResourceId{ResourceType: resourceType.Id, Resource: resourceID},
+		}.Build(),
+	}.Build()
+}
+
+func membershipEvent(id string, occurredAt *timestamppb.Timestamp, userID, groupID, role string, added bool) *v2.Event {
+	groupResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: groupID}}
+	ent := entitlement.NewAssignmentEntitlement(groupResource, role, entitlement.WithGrantableTo(UserResourceType))
+	principal := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: userID}}
+
+	event := v2.Event_builder{Id: id, OccurredAt: occurredAt}
+	if added {
+		event.CreateGrantEvent = v2.CreateGrantEvent_builder{Entitlement: ent, Principal: principal}.Build()
+	} else {
+		event.CreateRevokeEvent = v2.CreateRevokeEvent_builder{Entitlement: ent, Principal: principal}.Build()
+	}
+	return event.Build()
+}
+
+func anyToInt(v any) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	default:
+		return 0
+	}
+}
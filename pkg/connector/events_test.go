@@ -0,0 +1,180 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestAccessChangesFeedAudit(t *testing.T) {
+	ctx := context.Background()
+
+	mockClient := &client.MockService{
+		IsPaidPlanFunc: func() bool { return true },
+		GetDatabaseMetadataFunc: func(ctx context.Context, databaseID int) (*client.DatabaseMetadata, *v2.RateLimitDescription, error) {
+			require.Equal(t, auditDatabaseID, databaseID)
+			return &client.DatabaseMetadata{
+				ID: auditDatabaseID,
+				Tables: []*client.Table{{
+					ID:   42,
+					Name: "v_audit_log",
+					Fields: []*client.Field{
+						{ID: 1, Name: "id"},
+						{ID: 2, Name: "timestamp"},
+					},
+				}},
+			}, nil, nil
+		},
+	}
+
+	var queries []*client.DatasetQuery
+	mockClient.RunQueryFunc = func(ctx context.Context, query *client.DatasetQuery) (*client.DatasetResponse, *v2.RateLimitDescription, error) {
+		queries = append(queries, query)
+		return &client.DatasetResponse{
+			Status: "completed",
+			Data: client.DatasetData{
+				Cols: []*client.DatasetColumn{{Name: "id"}, {Name: "topic"}, {Name: "timestamp"}, {Name: "entity_id"}, {Name: "details"}},
+				Rows: [][]any{
+					{float64(7), "user-deactivated", "2026-03-01T10:00:00Z", float64(5), nil},
+					{float64(8), "group-membership-create", "2026-03-01T10:05:00Z", float64(30), `{"user_id":5,"group_id":3,"is_group_manager":true}`},
+					{float64(9), "permissions-graph-update", "2026-03-01T10:10:00Z", float64(12), `{"groups":["3","4"]}`},
+					{float64(10), "card-create", "2026-03-01T10:15:00Z", float64(99), nil},
+				},
+			},
+		}, nil, nil
+	}
+
+	feed := newAccessChangesFeed(mockClient)
+	events, state, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 4})
+	require.NoError(t, err)
+	require.True(t, state.HasMore)
+	require.Len(t, events, 4)
+
+	require.Equal(t, "audit:7", events[0].Id)
+	require.Equal(t, "5", events[0].GetResourceChangeEvent().GetResourceId().GetResource())
+
+	grantEvent := events[1].GetCreateGrantEvent()
+	require.NotNil(t, grantEvent)
+	require.Equal(t, "group:3:manager", grantEvent.GetEntitlement().GetId())
+	require.Equal(t, "5", grantEvent.GetPrincipal().GetId().GetResource())
+
+	require.Equal(t, "3", events[2].GetResourceChangeEvent().GetResourceId().GetResource())
+	require.Equal(t, GroupResourceType.Id, events[2].GetResourceChangeEvent().GetResourceId().GetResourceType())
+	require.Equal(t, "4", events[3].GetResourceChangeEvent().GetResourceId().GetResource())
+
+	var cursor eventCursor
+	require.NoError(t, json.Unmarshal([]byte(state.Cursor), &cursor))
+	require.Equal(t, eventSourceAudit, cursor.Source)
+	require.Equal(t, 10, cursor.LastAuditID)
+
+	_, _, _, err = feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 4, Cursor: state.Cursor})
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	require.Equal(t, []any{">", []any{"field", 1, nil}, 10}, queries[1].Query["filter"])
+}
+
+func TestAccessChangesFeedPoll(t *testing.T) {
+	ctx := context.Background()
+	since := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	before := since.Add(-time.Hour)
+	after := since.Add(time.Hour)
+
+	users := []*client.User{
+		{ID: 1, IsActive: true, DateJoined: &before, UpdatedAt: &before},
+		{ID: 2, IsActive: false, DateJoined: &before, UpdatedAt: &after},
+		{ID: 3, IsActive: true, DateJoined: &after, UpdatedAt: &after},
+	}
+	graph := &client.PermissionsGraph{Revision: 4, Groups: map[string]map[string]any{
+		"3": {"1": map[string]any{"view-data": "unrestricted"}},
+	}}
+
+	mockClient := &client.MockService{
+		ListUsersFunc: func(ctx context.Context, opts client.PageOptions) ([]*client.User, string, *v2.RateLimitDescription, error) {
+			return users, "", nil, nil
+		},
+		ListMembershipsFunc: func(ctx context.Context) (map[string][]*client.Membership, *v2.RateLimitDescription, error) {
+			t.Fatal("memberships should not be listed by a poll")
+			return nil, nil, nil
+		},
+		GetPermissionsGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return graph, nil, nil
+		},
+	}
+
+	now := after.Add(time.Minute)
+	feed := newAccessChangesFeed(mockClient)
+	feed.now = func() time.Time { return now }
+
+	t.Run("first poll reports users created or changed since the start time", func(t *testing.T) {
+		events, state, _, err := feed.ListEvents(ctx, timestamppb.New(since), nil)
+		require.NoError(t, err)
+		require.False(t, state.HasMore)
+		require.Len(t, events, 2)
+		require.Equal(t, "user-deactivated:2:"+strconv.FormatInt(after.UnixNano(), 10), events[0].Id)
+		require.Equal(t, "2", events[0].GetResourceChangeEvent().GetResourceId().GetResource())
+		require.Equal(t, "3", events[1].GetResourceChangeEvent().GetResourceId().GetResource())
+
+		var next eventCursor
+		require.NoError(t, json.Unmarshal([]byte(state.Cursor), &next))
+		revision := 4
+		require.Equal(t, eventCursor{Source: eventSourcePoll, Since: now, GraphRevision: &revision}, next)
+
+		later := now.Add(time.Minute)
+		users = append(users, &client.User{ID: 1, IsActive: true, DateJoined: &before, UpdatedAt: &later})
+		users = users[1:]
+		graph = &client.PermissionsGraph{Revision: 5, Groups: map[string]map[string]any{
+			"3": {"1": map[string]any{"view-data": "blocked"}},
+			"4": {"1": map[string]any{"view-data": "unrestricted"}},
+		}}
+		now = later.Add(time.Minute)
+
+		t.Run("next poll reports updated users and the groups of a new graph revision", func(t *testing.T) {
+			events, state, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{Cursor: state.Cursor})
+			require.NoError(t, err)
+			require.Len(t, events, 3)
+
+			require.Equal(t, "user-updated:1:"+strconv.FormatInt(later.UnixNano(), 10), events[0].Id)
+			require.Equal(t, "graph-changed:3:5", events[1].Id)
+			require.Equal(t, GroupResourceType.Id, events[1].GetResourceChangeEvent().GetResourceId().GetResourceType())
+			require.Equal(t, "graph-changed:4:5", events[2].Id)
+
+			events, _, _, err = feed.ListEvents(ctx, nil, &pagination.StreamToken{Cursor: state.Cursor})
+			require.NoError(t, err)
+			require.Empty(t, events)
+		})
+	})
+
+	t.Run("graph revision 0 is a baseline", func(t *testing.T) {
+		graph = &client.PermissionsGraph{Revision: 0, Groups: map[string]map[string]any{"3": {}}}
+		_, state, _, err := feed.ListEvents(ctx, timestamppb.New(now), nil)
+		require.NoError(t, err)
+
+		graph = &client.PermissionsGraph{Revision: 1, Groups: map[string]map[string]any{"3": {}}}
+		events, _, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{Cursor: state.Cursor})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, "graph-changed:3:1", events[0].Id)
+	})
+}
+
+func TestAccessChangesFeedMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	free := newAccessChangesFeed(&client.MockService{}).EventFeedMetadata(ctx)
+	require.Equal(t, []v2.EventType{v2.EventType_EVENT_TYPE_RESOURCE_CHANGE}, free.GetSupportedEventTypes())
+
+	paid := newAccessChangesFeed(&client.MockService{IsPaidPlanFunc: func() bool { return true }}).EventFeedMetadata(ctx)
+	require.Equal(t, []v2.EventType{
+		v2.EventType_EVENT_TYPE_RESOURCE_CHANGE,
+		v2.EventType_EVENT_TYPE_CREATE_GRANT,
+		v2.EventType_EVENT_TYPE_CREATE_REVOKE,
+	}, paid.GetSupportedEventTypes())
+}
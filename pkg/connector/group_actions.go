@@ -0,0 +1,102 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// RenameGroup renames a group. The built-in groups cannot be renamed.
+func (c *Connector) RenameGroup(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+
+	groupID, err := groupIDArg(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := strings.TrimSpace(args.Fields["name"].GetStringValue())
+	if name == "" {
+		return nil, nil, fmt.Errorf("name cannot be empty")
+	}
+
+	if isBuiltInGroup(groupID) {
+		return nil, nil, fmt.Errorf("group %s is a built-in Metabase group and cannot be renamed", groupID)
+	}
+
+	l.Info("renaming group", zap.String("groupId", groupID), zap.String("name", name))
+
+	_, rateLimitDesc, err := c.client.UpdateGroup(ctx, groupID, &client.GroupRequest{Name: name})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ann, fmt.Errorf("group %s does not exist", groupID)
+		}
+		return nil, ann, fmt.Errorf("failed to rename group %s: %w", groupID, err)
+	}
+
+	response := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"success": structpb.NewBoolValue(true),
+		},
+	}
+	return response, ann, nil
+}
+
+// DeleteGroup deletes a group. Unlike resource deletion, force allows deleting a group that still has
+// data or collection permissions; Metabase drops those permissions along with the group.
+func (c *Connector) DeleteGroup(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+
+	groupID, err := groupIDArg(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	force := args.Fields["force"].GetBoolValue()
+
+	l.Info("deleting group", zap.String("groupId", groupID), zap.Bool("force", force))
+
+	rateLimitDesc, err := deleteGroup(ctx, c.client, groupID, force)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	response := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"success": structpb.NewBoolValue(true),
+		},
+	}
+	return response, ann, nil
+}
+
+func groupIDArg(args *structpb.Struct) (string, error) {
+	if args == nil {
+		return "", fmt.Errorf("arguments cannot be nil")
+	}
+
+	if args.Fields == nil {
+		return "", fmt.Errorf("arguments fields cannot be nil")
+	}
+
+	groupID := args.Fields["groupId"].GetStringValue()
+	if groupID == "" {
+		return "", fmt.Errorf("groupId cannot be empty")
+	}
+
+	return groupID, nil
+}
@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// groupFilter decides which groups are synced. A group is kept when no include filter is set or
+// it matches one of them, and it matches no exclude filter. Exclusions win over inclusions.
+type groupFilter struct {
+	include    *regexp.Regexp
+	exclude    *regexp.Regexp
+	includeIDs map[string]bool
+	excludeIDs map[string]bool
+	// allowed caches, per group ID, whether a name filter allows the group, so groups are listed
+	// once per sync rather than once per resource whose grants are filtered.
+	allowed syncCache[map[int]bool]
+}
+
+// newGroupFilter compiles the configured filters. It returns nil when none are set.
+func newGroupFilter(includeRegex, excludeRegex string, includeIDs, excludeIDs []string) (*groupFilter, error) {
+	f := &groupFilter{
+		includeIDs: idSet(includeIDs),
+		excludeIDs: idSet(excludeIDs),
+	}
+
+	var err error
+	if includeRegex != "" {
+		if f.include, err = regexp.Compile(includeRegex); err != nil {
+			return nil, fmt.Errorf("invalid group include regex: %w", err)
+		}
+	}
+	if excludeRegex != "" {
+		if f.exclude, err = regexp.Compile(excludeRegex); err != nil {
+			return nil, fmt.Errorf("invalid group exclude regex: %w", err)
+		}
+	}
+
+	if f.include == nil && f.exclude == nil && len(f.includeIDs) == 0 && len(f.excludeIDs) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func idSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			set[id] = true
+		}
+	}
+	return set
+}
+
+// allows reports whether a group is synced. A nil filter allows every group.
+func (f *groupFilter) allows(group *client.Group) bool {
+	if f == nil {
+		return true
+	}
+
+	id := strconv.Itoa(group.ID)
+	if f.excludeIDs[id] || (f.exclude != nil && f.exclude.MatchString(group.Name)) {
+		return false
+	}
+	if f.include == nil && len(f.includeIDs) == 0 {
+		return true
+	}
+	return f.includeIDs[id] || (f.include != nil && f.include.MatchString(group.Name))
+}
+
+// matchesNames reports whether the filter needs group names, which memberships do not carry.
+func (f *groupFilter) matchesNames() bool {
+	return f != nil && (f.include != nil || f.exclude != nil)
+}
+
+// allowedGroups returns a check for group IDs taken from memberships. Groups are only listed
+// when a name filter is set, since ID filters can be applied to the membership directly, and
+// then only once until the filter is reset.
+func (f *groupFilter) allowedGroups(ctx context.Context, c client.ClientService) (func(groupID int) bool, *v2.RateLimitDescription, error) {
+	if f == nil {
+		return func(int) bool { return true }, nil, nil
+	}
+
+	if !f.matchesNames() {
+		return func(groupID int) bool {
+			return f.allows(&client.Group{ID: groupID})
+		}, nil, nil
+	}
+
+	allowed, rateLimitDesc, err := f.allowed.load(func() (map[int]bool, *v2.RateLimitDescription, error) {
+		groups, rateLimitDesc, err := c.ListGroups(ctx)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("failed to list groups: %w", err)
+		}
+
+		allowed := make(map[int]bool, len(groups))
+		for _, group := range groups {
+			allowed[group.ID] = f.allows(group)
+		}
+		return allowed, rateLimitDesc, nil
+	})
+	if err != nil {
+		return nil, rateLimitDesc, err
+	}
+	return func(groupID int) bool {
+		return allowed[groupID]
+	}, rateLimitDesc, nil
+}
+
+// reset drops the groups allowedGroups listed, so the next sync lists them again.
+func (f *groupFilter) reset() {
+	if f == nil {
+		return
+	}
+	f.allowed.reset()
+}
@@ -0,0 +1,176 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGroupFilter(t *testing.T) {
+	groups := []*client.Group{
+		{ID: 1, Name: "All Users"},
+		{ID: 2, Name: "Administrators"},
+		{ID: 3, Name: "team-data"},
+		{ID: 4, Name: "tenant-acme"},
+		{ID: 5, Name: "tenant-globex"},
+	}
+	allowedIDs := func(f *groupFilter) []int {
+		var ids []int
+		for _, g := range groups {
+			if f.allows(g) {
+				ids = append(ids, g.ID)
+			}
+		}
+		return ids
+	}
+
+	t.Run("no filters", func(t *testing.T) {
+		f, err := newGroupFilter("", "", nil, []string{" "})
+		require.NoError(t, err)
+		require.Nil(t, f)
+		require.Equal(t, []int{1, 2, 3, 4, 5}, allowedIDs(f))
+	})
+
+	t.Run("exclude by name and id", func(t *testing.T) {
+		f, err := newGroupFilter("", "^tenant-", nil, []string{"1"})
+		require.NoError(t, err)
+		require.Equal(t, []int{2, 3}, allowedIDs(f))
+	})
+
+	t.Run("include by name or id", func(t *testing.T) {
+		f, err := newGroupFilter("^team-", "", []string{"2"}, nil)
+		require.NoError(t, err)
+		require.Equal(t, []int{2, 3}, allowedIDs(f))
+	})
+
+	t.Run("exclusions win", func(t *testing.T) {
+		f, err := newGroupFilter("^tenant-", "globex", nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, []int{4}, allowedIDs(f))
+	})
+
+	t.Run("invalid regex", func(t *testing.T) {
+		_, err := newGroupFilter("(", "", nil, nil)
+		require.ErrorContains(t, err, "invalid group include regex")
+	})
+}
+
+func TestGroupsListFiltered(t *testing.T) {
+	ctx := context.Background()
+	filter, err := newGroupFilter("", "^tenant-", nil, nil)
+	require.NoError(t, err)
+
+	mockClient := &client.MockService{}
+	groupBuilder := newGroupBuilder(mockClient, groupSyncOptions{filter: filter})
+
+	mockClient.ListGroupsPageFunc = func(ctx context.Context, options client.PageOptions) ([]*client.Group, string, *v2.RateLimitDescription, error) {
+		require.Equal(t, 2, options.Limit)
+		switch options.Offset {
+		case 0:
+			return []*client.Group{{ID: 1, Name: "All Users"}, {ID: 3, Name: "tenant-acme"}}, "2", nil, nil
+		case 2:
+			return []*client.Group{{ID: 4, Name: "team-data"}}, "", nil, nil
+		default:
+			return nil, "", nil, fmt.Errorf("unexpected offset %d", options.Offset)
+		}
+	}
+
+	res, next, _, err := groupBuilder.List(ctx, nil, &pagination.Token{Size: 2})
+	require.NoError(t, err)
+	require.Equal(t, "2", next)
+	require.Len(t, res, 1)
+	require.Equal(t, "1", res[0].Id.Resource)
+
+	res, next, _, err = groupBuilder.List(ctx, nil, &pagination.Token{Size: 2, Token: next})
+	require.NoError(t, err)
+	require.Empty(t, next)
+	require.Len(t, res, 1)
+	require.Equal(t, "4", res[0].Id.Resource)
+
+	t.Run("excluded group is not found", func(t *testing.T) {
+		mockClient.GetGroupByIDFunc = func(ctx context.Context, groupID string) (*client.Group, *v2.RateLimitDescription, error) {
+			return &client.Group{ID: 3, Name: "tenant-acme"}, nil, nil
+		}
+
+		_, _, err := groupBuilder.Get(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "3"}, nil)
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestUsersGrantsGroupFilter(t *testing.T) {
+	ctx := context.Background()
+	memberships := map[string][]*client.Membership{
+		"10": {{GroupID: 1, UserID: 10}, {GroupID: 3, UserID: 10}, {GroupID: 4, UserID: 10}},
+	}
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: "10"}}
+
+	grantedGroups := func(t *testing.T, filter *groupFilter, mockClient *client.MockService) []string {
+		mockClient.ListMembershipsFunc = func(ctx context.Context) (map[string][]*client.Membership, *v2.RateLimitDescription, error) {
+			return memberships, nil, nil
+		}
+		builder := newUserBuilder(mockClient, userSyncOptions{groupFilter: filter})
+		grants, _, _, err := builder.Grants(ctx, user, nil)
+		require.NoError(t, err)
+
+		var ids []string
+		for _, g := range grants {
+			ids = append(ids, g.Entitlement.Resource.Id.Resource)
+		}
+		return ids
+	}
+
+	t.Run("id filters do not list groups", func(t *testing.T) {
+		filter, err := newGroupFilter("", "", nil, []string{"4"})
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"1", "3"}, grantedGroups(t, filter, &client.MockService{}))
+	})
+
+	t.Run("name filters", func(t *testing.T) {
+		filter, err := newGroupFilter("", "^tenant-", nil, nil)
+		require.NoError(t, err)
+		mockClient := &client.MockService{
+			ListGroupsFunc: func(ctx context.Context) ([]*client.Group, *v2.RateLimitDescription, error) {
+				return []*client.Group{{ID: 1, Name: "All Users"}, {ID: 3, Name: "tenant-acme"}, {ID: 4, Name: "team-data"}}, nil, nil
+			},
+		}
+
+		require.Equal(t, []string{"1", "4"}, grantedGroups(t, filter, mockClient))
+	})
+
+	t.Run("groups are listed once per sync", func(t *testing.T) {
+		filter, err := newGroupFilter("", "^tenant-", nil, nil)
+		require.NoError(t, err)
+		listed := 0
+		mockClient := &client.MockService{
+			ListGroupsFunc: func(ctx context.Context) ([]*client.Group, *v2.RateLimitDescription, error) {
+				listed++
+				return []*client.Group{{ID: 1, Name: "All Users"}, {ID: 3, Name: "tenant-acme"}, {ID: 4, Name: "team-data"}}, nil, nil
+			},
+			ListGroupsPageFunc: func(ctx context.Context, options client.PageOptions) ([]*client.Group, string, *v2.RateLimitDescription, error) {
+				return nil, "", nil, nil
+			},
+			GetSettingFunc: func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+				return nil, nil, nil
+			},
+		}
+
+		for range 3 {
+			require.Equal(t, []string{"1", "4"}, grantedGroups(t, filter, mockClient))
+		}
+		require.Equal(t, 1, listed)
+
+		// Listing the groups starts a new sync.
+		_, _, _, err = newGroupBuilder(mockClient, groupSyncOptions{filter: filter}).List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"1", "4"}, grantedGroups(t, filter, mockClient))
+		require.Equal(t, 2, listed)
+	})
+}
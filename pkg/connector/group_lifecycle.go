@@ -0,0 +1,179 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// allUsersGroupID is the built-in group every user belongs to. Together with Administrators it can
+// be neither renamed nor deleted.
+const allUsersGroupID = 1
+
+// noAccessValues are the permission levels in the data and collection graphs that grant nothing.
+var noAccessValues = map[string]bool{
+	"none":                   true,
+	"no":                     true,
+	"blocked":                true,
+	"legacy-no-self-service": true,
+}
+
+func isBuiltInGroup(groupID string) bool {
+	return groupID == strconv.Itoa(allUsersGroupID) || groupID == strconv.Itoa(administratorsGroupID)
+}
+
+// Create creates a group named after the resource's display name.
+func (g *groupBuilder) Create(ctx context.Context, resource *v2.Resource) (*v2.Resource, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	name := strings.TrimSpace(resource.GetDisplayName())
+	if name == "" {
+		return nil, nil, fmt.Errorf("group name cannot be empty")
+	}
+
+	group, rateLimitDesc, err := g.client.CreateGroup(ctx, &client.GroupRequest{Name: name})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	res, err := g.parseIntoGroupResource(group, nil)
+	if err != nil {
+		return nil, ann, err
+	}
+
+	return res, ann, nil
+}
+
+// Delete deletes a group that has no permissions left in the data or collection graphs.
+// Groups that still have permissions can only be deleted through the delete_group action with force.
+func (g *groupBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	ann := annotations.New()
+
+	rateLimitDesc, err := deleteGroup(ctx, g.client, resourceId.Resource, false)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	return ann, nil
+}
+
+// deleteGroup deletes a group. Built-in groups are refused, and so are groups that still have
+// permissions unless force is set. A group that no longer exists is treated as deleted.
+func deleteGroup(ctx context.Context, c client.ClientService, groupID string, force bool) (*v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	if isBuiltInGroup(groupID) {
+		return nil, fmt.Errorf("group %s is a built-in Metabase group and cannot be deleted", groupID)
+	}
+
+	var rateLimitDesc *v2.RateLimitDescription
+	if !force {
+		usage, rl, err := fetchGroupPermissionUsage(ctx, c, groupID)
+		rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+		if err != nil {
+			return rateLimitDesc, err
+		}
+		if !usage.empty() {
+			return rateLimitDesc, fmt.Errorf("group %s still has permissions on %s; use the %s action with force to delete it anyway", groupID, usage, ActionDeleteGroup)
+		}
+	}
+
+	rl, err := c.DeleteGroup(ctx, groupID)
+	rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			l.Info("group is already deleted", zap.String("group_id", groupID))
+			return rateLimitDesc, nil
+		}
+		return rateLimitDesc, err
+	}
+
+	return rateLimitDesc, nil
+}
+
+// groupPermissionUsage lists the databases and collections a group has access to.
+type groupPermissionUsage struct {
+	databases   []string
+	collections []string
+}
+
+func (u *groupPermissionUsage) empty() bool {
+	return len(u.databases) == 0 && len(u.collections) == 0
+}
+
+func (u *groupPermissionUsage) String() string {
+	var parts []string
+	if len(u.databases) > 0 {
+		parts = append(parts, "databases "+strings.Join(u.databases, ", "))
+	}
+	if len(u.collections) > 0 {
+		parts = append(parts, "collections "+strings.Join(u.collections, ", "))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// fetchGroupPermissionUsage reads the data and collection graphs for the permissions a group still holds.
+func fetchGroupPermissionUsage(ctx context.Context, c client.ClientService, groupID string) (*groupPermissionUsage, *v2.RateLimitDescription, error) {
+	usage := &groupPermissionUsage{}
+
+	dataGraph, rateLimitDesc, err := c.GetPermissionsGraph(ctx)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to check permissions of group %s: %w", groupID, err)
+	}
+	for databaseID, perms := range dataGraph.Groups[groupID] {
+		if grantsDataAccess(perms) {
+			usage.databases = append(usage.databases, databaseID)
+		}
+	}
+
+	collectionGraph, rl, err := c.GetCollectionGraph(ctx)
+	rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to check permissions of group %s: %w", groupID, err)
+	}
+	for collectionID, level := range collectionGraph.Groups[groupID] {
+		if grantsDataAccess(level) {
+			usage.collections = append(usage.collections, collectionID)
+		}
+	}
+
+	sort.Strings(usage.databases)
+	sort.Strings(usage.collections)
+
+	return usage, rateLimitDesc, nil
+}
+
+// grantsDataAccess reports whether a permission document grants anything. view-data is ignored:
+// Metabase lists it for every group and database, and on its own it does not let the group query anything.
+func grantsDataAccess(perms any) bool {
+	switch v := perms.(type) {
+	case string:
+		return !noAccessValues[v]
+	case map[string]any:
+		for key, value := range v {
+			if key == "view-data" {
+				continue
+			}
+			if grantsDataAccess(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
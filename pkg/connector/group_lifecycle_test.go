@@ -0,0 +1,196 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func emptyGraph(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+	return &client.PermissionsGraph{Groups: map[string]map[string]any{}}, nil, nil
+}
+
+func TestGroupsCreate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("creates the group named after the resource", func(t *testing.T) {
+		groupBuilder, mockClient := newTestGroupBuilder()
+		mockClient.CreateGroupFunc = func(ctx context.Context, request *client.GroupRequest) (*client.Group, *v2.RateLimitDescription, error) {
+			require.Equal(t, "Analysts", request.Name)
+			return &client.Group{ID: 7, Name: request.Name}, nil, nil
+		}
+
+		res, _, err := groupBuilder.Create(ctx, &v2.Resource{DisplayName: " Analysts "})
+		require.NoError(t, err)
+		require.Equal(t, "7", res.Id.Resource)
+		require.Equal(t, GroupResourceType.Id, res.Id.ResourceType)
+		require.Equal(t, "Analysts", res.DisplayName)
+	})
+
+	t.Run("requires a name", func(t *testing.T) {
+		groupBuilder, _ := newTestGroupBuilder()
+
+		_, _, err := groupBuilder.Create(ctx, &v2.Resource{})
+		require.ErrorContains(t, err, "group name cannot be empty")
+	})
+
+	t.Run("rate limit returned", func(t *testing.T) {
+		groupBuilder, mockClient := newTestGroupBuilder()
+		mockClient.CreateGroupFunc = func(ctx context.Context, request *client.GroupRequest) (*client.Group, *v2.RateLimitDescription, error) {
+			return nil, &v2.RateLimitDescription{Limit: 10}, fmt.Errorf("rate limit error")
+		}
+
+		_, ann, err := groupBuilder.Create(ctx, &v2.Resource{DisplayName: "Analysts"})
+		require.Error(t, err)
+		require.NotEmpty(t, ann)
+	})
+}
+
+func TestGroupsDelete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("deletes a group without permissions", func(t *testing.T) {
+		groupBuilder, mockClient := newTestGroupBuilder()
+		mockClient.GetPermissionsGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{
+				"7": {"1": map[string]any{"view-data": "unrestricted", "create-queries": "no"}},
+			}}, nil, nil
+		}
+		mockClient.GetCollectionGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{"7": {"root": "none"}}}, nil, nil
+		}
+		var deleted string
+		mockClient.DeleteGroupFunc = func(ctx context.Context, groupID string) (*v2.RateLimitDescription, error) {
+			deleted = groupID
+			return nil, nil
+		}
+
+		_, err := groupBuilder.Delete(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "7"})
+		require.NoError(t, err)
+		require.Equal(t, "7", deleted)
+	})
+
+	t.Run("refuses a group that still has permissions", func(t *testing.T) {
+		groupBuilder, mockClient := newTestGroupBuilder()
+		mockClient.GetPermissionsGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{
+				"7": {"1": map[string]any{"view-data": "unrestricted", "create-queries": "query-builder"}},
+			}}, nil, nil
+		}
+		mockClient.GetCollectionGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{"7": {"root": "read", "4": "none"}}}, nil, nil
+		}
+		mockClient.DeleteGroupFunc = func(ctx context.Context, groupID string) (*v2.RateLimitDescription, error) {
+			t.Fatal("group should not be deleted")
+			return nil, nil
+		}
+
+		_, err := groupBuilder.Delete(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "7"})
+		require.ErrorContains(t, err, "group 7 still has permissions on databases 1 and collections root")
+		require.ErrorContains(t, err, ActionDeleteGroup)
+	})
+
+	t.Run("refuses built-in groups", func(t *testing.T) {
+		groupBuilder, _ := newTestGroupBuilder()
+
+		for _, id := range []string{"1", "2"} {
+			_, err := groupBuilder.Delete(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: id})
+			require.ErrorContains(t, err, "built-in Metabase group")
+		}
+	})
+
+	t.Run("already deleted", func(t *testing.T) {
+		groupBuilder, mockClient := newTestGroupBuilder()
+		mockClient.GetPermissionsGraphFunc = emptyGraph
+		mockClient.GetCollectionGraphFunc = emptyGraph
+		mockClient.DeleteGroupFunc = func(ctx context.Context, groupID string) (*v2.RateLimitDescription, error) {
+			return nil, status.Error(codes.NotFound, "not found")
+		}
+
+		_, err := groupBuilder.Delete(ctx, &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "7"})
+		require.NoError(t, err)
+	})
+}
+
+func TestRenameGroupAction(t *testing.T) {
+	ctx := context.Background()
+	connector, mockClient := newTestConnector()
+
+	t.Run("renames the group", func(t *testing.T) {
+		mockClient.UpdateGroupFunc = func(ctx context.Context, groupID string, request *client.GroupRequest) (*client.Group, *v2.RateLimitDescription, error) {
+			require.Equal(t, "7", groupID)
+			require.Equal(t, "Data Analysts", request.Name)
+			return &client.Group{ID: 7, Name: request.Name}, nil, nil
+		}
+
+		args, _ := structpb.NewStruct(map[string]interface{}{"groupId": "7", "name": "Data Analysts"})
+		resp, _, err := connector.RenameGroup(ctx, args)
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+	})
+
+	t.Run("refuses built-in groups", func(t *testing.T) {
+		args, _ := structpb.NewStruct(map[string]interface{}{"groupId": "2", "name": "Admins"})
+		_, _, err := connector.RenameGroup(ctx, args)
+		require.ErrorContains(t, err, "cannot be renamed")
+	})
+
+	t.Run("unknown group", func(t *testing.T) {
+		mockClient.UpdateGroupFunc = func(ctx context.Context, groupID string, request *client.GroupRequest) (*client.Group, *v2.RateLimitDescription, error) {
+			return nil, nil, status.Error(codes.NotFound, "not found")
+		}
+
+		args, _ := structpb.NewStruct(map[string]interface{}{"groupId": "99", "name": "Analysts"})
+		_, _, err := connector.RenameGroup(ctx, args)
+		require.ErrorContains(t, err, "group 99 does not exist")
+	})
+
+	t.Run("error if missing name", func(t *testing.T) {
+		args, _ := structpb.NewStruct(map[string]interface{}{"groupId": "7"})
+		_, _, err := connector.RenameGroup(ctx, args)
+		require.ErrorContains(t, err, "name cannot be empty")
+	})
+}
+
+func TestDeleteGroupAction(t *testing.T) {
+	ctx := context.Background()
+	connector, mockClient := newTestConnector()
+
+	mockClient.GetPermissionsGraphFunc = emptyGraph
+	mockClient.GetCollectionGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+		return &client.PermissionsGraph{Groups: map[string]map[string]any{"7": {"4": "write"}}}, nil, nil
+	}
+	var deleted []string
+	mockClient.DeleteGroupFunc = func(ctx context.Context, groupID string) (*v2.RateLimitDescription, error) {
+		deleted = append(deleted, groupID)
+		return nil, nil
+	}
+
+	t.Run("refuses a group with permissions without force", func(t *testing.T) {
+		args, _ := structpb.NewStruct(map[string]interface{}{"groupId": "7"})
+		_, _, err := connector.DeleteGroup(ctx, args)
+		require.ErrorContains(t, err, "collections 4")
+		require.Empty(t, deleted)
+	})
+
+	t.Run("force deletes a group with permissions", func(t *testing.T) {
+		args, _ := structpb.NewStruct(map[string]interface{}{"groupId": "7", "force": true})
+		resp, _, err := connector.DeleteGroup(ctx, args)
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, []string{"7"}, deleted)
+	})
+
+	t.Run("force does not delete built-in groups", func(t *testing.T) {
+		args, _ := structpb.NewStruct(map[string]interface{}{"groupId": "1", "force": true})
+		_, _, err := connector.DeleteGroup(ctx, args)
+		require.ErrorContains(t, err, "built-in Metabase group")
+	})
+}
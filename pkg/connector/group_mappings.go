@@ -0,0 +1,117 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ssoGroupSyncSources are the SSO methods that can fill Metabase groups from IdP groups.
+// Each has a "<source>-group-sync" setting that turns syncing on and a "<source>-group-mappings"
+// setting that maps an IdP group name to the IDs of the Metabase groups its members join.
+var ssoGroupSyncSources = []string{authSourceSAML, authSourceJWT, authSourceLDAP}
+
+// groupMappings holds, per Metabase group ID, the IdP groups mapped to it keyed by SSO source.
+type groupMappings map[string]map[string][]string
+
+// forGroup returns the mappings of one group, or nil when the group is not mapped.
+func (m groupMappings) forGroup(groupID string) map[string][]string {
+	if m == nil {
+		return nil
+	}
+	return m[groupID]
+}
+
+// syncGroupMappings caches the SSO group mappings for the duration of a group sync, so they are
+// read once per sync rather than once per page.
+type syncGroupMappings struct {
+	mu       sync.Mutex
+	loaded   bool
+	mappings groupMappings
+}
+
+func (m *syncGroupMappings) load(ctx context.Context, c client.ClientService) (groupMappings, *v2.RateLimitDescription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.loaded {
+		return m.mappings, nil, nil
+	}
+
+	mappings, rateLimitDesc, err := fetchGroupMappings(ctx, c)
+	if err != nil {
+		return nil, rateLimitDesc, err
+	}
+	m.loaded = true
+	m.mappings = mappings
+
+	return mappings, rateLimitDesc, nil
+}
+
+func (m *syncGroupMappings) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loaded = false
+	m.mappings = nil
+}
+
+// fetchGroupMappings reads the group mappings of every SSO method that has group sync turned on.
+// Mappings of methods with group sync turned off are ignored since Metabase does not apply them.
+func fetchGroupMappings(ctx context.Context, c client.ClientService) (groupMappings, *v2.RateLimitDescription, error) {
+	var rateLimitDesc *v2.RateLimitDescription
+
+	read := func(key string) (any, error) {
+		value, rl, err := c.GetSetting(ctx, key)
+		rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to read group mappings: %w", err)
+		}
+		return value, nil
+	}
+
+	mappings := make(groupMappings)
+	for _, source := range ssoGroupSyncSources {
+		enabled, err := read(source + "-group-sync")
+		if err != nil {
+			return nil, rateLimitDesc, err
+		}
+		if !settingBool(enabled, false) {
+			continue
+		}
+
+		value, err := read(source + "-group-mappings")
+		if err != nil {
+			return nil, rateLimitDesc, err
+		}
+		raw, _ := value.(map[string]any)
+		for idpGroup, groupIDs := range raw {
+			ids, _ := groupIDs.([]any)
+			for _, id := range ids {
+				groupID := strconv.Itoa(anyToInt(id))
+				if mappings[groupID] == nil {
+					mappings[groupID] = make(map[string][]string)
+				}
+				mappings[groupID][source] = append(mappings[groupID][source], idpGroup)
+			}
+		}
+	}
+
+	for _, sources := range mappings {
+		for _, idpGroups := range sources {
+			sort.Strings(idpGroups)
+		}
+	}
+
+	return mappings, rateLimitDesc, nil
+}
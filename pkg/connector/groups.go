@@ -3,15 +3,20 @@ package connector
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/conductorone/baton-metabase/pkg/client"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -19,18 +24,46 @@ const (
 	ManagerPermission = "manager"
 )
 
+// groupSyncOptions are the optional group behaviors enabled through configuration.
+type groupSyncOptions struct {
+	// protectSSOMapped marks groups filled from IdP groups through SSO group mappings as not
+	// directly provisionable, since Metabase overwrites their membership at the next login.
+	protectSSOMapped bool
+	// filter is nil unless groups are filtered by name or ID.
+	filter *groupFilter
+}
+
 type groupBuilder struct {
 	client client.ClientService
+	groupSyncOptions
+	// targetedMembers holds the members of groups fetched through Get, keyed by group ID,
+	// until Grants consumes them. Full syncs never populate it.
+	targetedMembers sync.Map
+	// mappings caches the SSO group mappings while List pages through the groups.
+	mappings syncGroupMappings
 }
 
 func (g *groupBuilder) ResourceType(_ context.Context) *v2.ResourceType {
 	return GroupResourceType
 }
 
-func (g *groupBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+func (g *groupBuilder) List(ctx context.Context, _ *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	opts, err := getPageOptions(pToken, client.ItemsPerPage)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
 	ann := annotations.New()
 
-	groups, rateLimitDesc, err := g.client.ListGroups(ctx)
+	// Resource listing runs before any grants, so the groups the filter reads for grants are
+	// listed again on every sync. The SSO group mappings are read again on the first page, so a
+	// sync that failed part way does not leave them cached for the next one.
+	if pToken == nil || pToken.Token == "" {
+		g.filter.reset()
+		g.mappings.reset()
+	}
+
+	groups, nextPageToken, rateLimitDesc, err := g.client.ListGroupsPage(ctx, opts)
 	if rateLimitDesc != nil {
 		ann.WithRateLimiting(rateLimitDesc)
 	}
@@ -38,25 +71,78 @@ func (g *groupBuilder) List(ctx context.Context, _ *v2.ResourceId, _ *pagination
 		return nil, "", ann, fmt.Errorf("failed to list groups: %w", err)
 	}
 
+	mappings, rateLimitDesc, err := g.mappings.load(ctx, g.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+
 	outResources := make([]*v2.Resource, 0, len(groups))
 	for _, group := range groups {
-		res, err := g.parseIntoGroupResource(group)
+		if !g.filter.allows(group) {
+			continue
+		}
+		res, err := g.parseIntoGroupResource(group, mappings.forGroup(strconv.Itoa(group.ID)))
 		if err != nil {
 			return nil, "", ann, err
 		}
 		outResources = append(outResources, res)
 	}
 
-	return outResources, "", ann, nil
+	return outResources, nextPageToken, ann, nil
+}
+
+// Get fetches a single group for targeted sync. The group detail endpoint also returns its
+// members, which are kept so the Grants call the SDK makes next can report them.
+func (g *groupBuilder) Get(ctx context.Context, resourceId *v2.ResourceId, _ *v2.ResourceId) (*v2.Resource, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	group, rateLimitDesc, err := g.client.GetGroupByID(ctx, resourceId.Resource)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, fmt.Errorf("failed to get group %s: %w", resourceId.Resource, err)
+	}
+	if !g.filter.allows(group) {
+		return nil, ann, status.Errorf(codes.NotFound, "group %s is excluded by the group filters", resourceId.Resource)
+	}
+
+	if group.Members != nil && group.MemberCount == 0 {
+		group.MemberCount = len(group.Members)
+	}
+
+	mappings, rateLimitDesc, err := fetchGroupMappings(ctx, g.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	res, err := g.parseIntoGroupResource(group, mappings.forGroup(strconv.Itoa(group.ID)))
+	if err != nil {
+		return nil, ann, err
+	}
+	g.targetedMembers.Store(res.Id.Resource, group.Members)
+
+	return res, ann, nil
 }
 
 func (g *groupBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	var rv []*v2.Entitlement
+	// API keys can hold a membership too, and it is synced, but Grant and Revoke refuse API keys,
+	// so the entitlement is only grantable to users.
 	opts := []entitlement.EntitlementOption{
 		entitlement.WithGrantableTo(UserResourceType),
 		entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, "Member")),
 		entitlement.WithDescription(fmt.Sprintf("Is a %s of %s group in Metabase", "Member", resource.DisplayName)),
 	}
+	if g.protectSSOMapped && isSSOMappedGroup(resource) {
+		opts = append(opts, entitlement.WithAnnotation(&v2.EntitlementImmutable{}))
+	}
 	rv = append(rv, entitlement.NewAssignmentEntitlement(resource, MemberPermission, opts...))
 
 	if g.client.IsPaidPlan() {
@@ -65,20 +151,48 @@ func (g *groupBuilder) Entitlements(_ context.Context, resource *v2.Resource, _
 			entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, "Manager")),
 			entitlement.WithDescription(fmt.Sprintf("Is a %s of %s group in Metabase", "Manager", resource.DisplayName)),
 		}
+		if g.protectSSOMapped && isSSOMappedGroup(resource) {
+			opts = append(opts, entitlement.WithAnnotation(&v2.EntitlementImmutable{}))
+		}
 		rv = append(rv, entitlement.NewAssignmentEntitlement(resource, ManagerPermission, opts...))
 	}
 
 	return rv, "", nil, nil
 }
 
-// Grants is intentionally empty because group membership grants are computed in the userBuilder.
-func (g *groupBuilder) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+// Grants is intentionally empty during full syncs because group membership grants are computed in the userBuilder.
+// Groups fetched through Get are the exception: a targeted sync only visits that group, so its members are reported here.
+func (g *groupBuilder) Grants(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	value, ok := g.targetedMembers.LoadAndDelete(resource.Id.Resource)
+	if !ok {
+		return nil, "", nil, nil
+	}
+
+	members, _ := value.([]*client.Membership)
+	grants := make([]*v2.Grant, 0, len(members))
+	for _, member := range members {
+		role := MemberPermission
+		if member.IsGroupManager {
+			role = ManagerPermission
+		}
+
+		principal := &v2.ResourceId{
+			ResourceType: UserResourceType.Id,
+			Resource:     strconv.Itoa(member.UserID),
+		}
+		grants = append(grants, grant.NewGrant(resource, role, principal))
+	}
+
+	return grants, "", nil, nil
 }
 
 func (g *groupBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
 	ann := annotations.New()
 
+	if principal.Id.ResourceType == APIKeyResourceType.Id {
+		return nil, fmt.Errorf("api key %s: the group of an api key can only be changed in Metabase", principal.Id.Resource)
+	}
+
 	groupID, err := strconv.Atoi(entitlement.Resource.Id.Resource)
 	if err != nil {
 		return nil, fmt.Errorf("invalid group id %q: %w", entitlement.Resource.Id.Resource, err)
@@ -90,6 +204,14 @@ func (g *groupBuilder) Grant(ctx context.Context, principal *v2.Resource, entitl
 		return nil, fmt.Errorf("invalid user id %q: %w", principal.Id.Resource, err)
 	}
 
+	rateLimitDesc, err := g.checkNotSSOMapped(ctx, entitlement.Resource.Id.Resource)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
 	memberships, rateLimitDesc, err := g.client.ListMemberships(ctx)
 	if rateLimitDesc != nil {
 		ann.WithRateLimiting(rateLimitDesc)
@@ -135,6 +257,10 @@ func (g *groupBuilder) Grant(ctx context.Context, principal *v2.Resource, entitl
 func (g *groupBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
 	ann := annotations.New()
 
+	if grant.Principal.Id.ResourceType == APIKeyResourceType.Id {
+		return nil, fmt.Errorf("api key %s: the group of an api key can only be changed in Metabase", grant.Principal.Id.Resource)
+	}
+
 	groupID, err := strconv.Atoi(grant.Entitlement.Resource.Id.Resource)
 	if err != nil {
 		return nil, fmt.Errorf("invalid group id %q: %w", grant.Entitlement.Resource.Id.Resource, err)
@@ -146,6 +272,14 @@ func (g *groupBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations
 		return nil, fmt.Errorf("invalid user id %q: %w", grant.Principal.Id.Resource, err)
 	}
 
+	rateLimitDesc, err := g.checkNotSSOMapped(ctx, grant.Entitlement.Resource.Id.Resource)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
 	memberships, rateLimitDesc, err := g.client.ListMemberships(ctx)
 	if rateLimitDesc != nil {
 		ann.WithRateLimiting(rateLimitDesc)
@@ -178,10 +312,54 @@ func (g *groupBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations
 	return ann, nil
 }
 
-func (g *groupBuilder) parseIntoGroupResource(group *client.Group) (*v2.Resource, error) {
+// checkNotSSOMapped refuses membership changes to groups filled from IdP groups when they are protected.
+// The mappings are read fresh since the entitlement's resource does not carry the synced profile.
+func (g *groupBuilder) checkNotSSOMapped(ctx context.Context, groupID string) (*v2.RateLimitDescription, error) {
+	if !g.protectSSOMapped {
+		return nil, nil
+	}
+
+	mappings, rateLimitDesc, err := fetchGroupMappings(ctx, g.client)
+	if err != nil {
+		return rateLimitDesc, err
+	}
+
+	if sources := mappings.forGroup(groupID); len(sources) > 0 {
+		names := make([]string, 0, len(sources))
+		for source := range sources {
+			names = append(names, source)
+		}
+		sort.Strings(names)
+		return rateLimitDesc, fmt.Errorf("group %s is managed through %s group mappings; change its membership in the identity provider", groupID, strings.Join(names, ", "))
+	}
+
+	return rateLimitDesc, nil
+}
+
+// isSSOMappedGroup reads the sso_mapped flag that parseIntoGroupResource stores in the group profile.
+func isSSOMappedGroup(resource *v2.Resource) bool {
+	groupTrait, err := resourceSdk.GetGroupTrait(resource)
+	if err != nil {
+		return false
+	}
+	mapped, ok := groupTrait.GetProfile().AsMap()["sso_mapped"].(bool)
+	return ok && mapped
+}
+
+// parseIntoGroupResource builds the group resource. mappings holds the IdP groups mapped to the group,
+// keyed by SSO source, and is nil for groups that are not filled through SSO group mappings.
+func (g *groupBuilder) parseIntoGroupResource(group *client.Group, mappings map[string][]string) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"name":         group.Name,
 		"member_count": group.MemberCount,
+		"sso_mapped":   len(mappings) > 0,
+	}
+	for source, idpGroups := range mappings {
+		values := make([]interface{}, 0, len(idpGroups))
+		for _, idpGroup := range idpGroups {
+			values = append(values, idpGroup)
+		}
+		profile[source+"_group_mappings"] = values
 	}
 
 	return resourceSdk.NewGroupResource(
@@ -192,8 +370,9 @@ func (g *groupBuilder) parseIntoGroupResource(group *client.Group) (*v2.Resource
 	)
 }
 
-func newGroupBuilder(client client.ClientService) *groupBuilder {
+func newGroupBuilder(client client.ClientService, opts groupSyncOptions) *groupBuilder {
 	return &groupBuilder{
-		client: client,
+		client:           client,
+		groupSyncOptions: opts,
 	}
 }
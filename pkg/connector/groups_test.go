@@ -7,13 +7,15 @@ import (
 
 	"github.com/conductorone/baton-metabase/pkg/client"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/stretchr/testify/require"
 )
 
 func newTestGroupBuilder() (*groupBuilder, *client.MockService) {
 	mockClient := &client.MockService{}
-	builder := newGroupBuilder(mockClient)
+	builder := newGroupBuilder(mockClient, groupSyncOptions{})
 	return builder, mockClient
 }
 
@@ -75,6 +77,54 @@ func TestGroupsList(t *testing.T) {
 	})
 }
 
+func TestGroupsGet(t *testing.T) {
+	ctx := context.Background()
+	groupID := &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "3"}
+
+	t.Run("should return the group and its members as grants", func(t *testing.T) {
+		groupBuilder, mockClient := newTestGroupBuilder()
+		mockClient.GetGroupByIDFunc = func(ctx context.Context, id string) (*client.Group, *v2.RateLimitDescription, error) {
+			require.Equal(t, "3", id)
+			return &client.Group{
+				ID:   3,
+				Name: "Analysts",
+				Members: []*client.Membership{
+					{MembershipID: 10, UserID: 1},
+					{MembershipID: 11, UserID: 2, IsGroupManager: true},
+				},
+			}, nil, nil
+		}
+
+		res, _, err := groupBuilder.Get(ctx, groupID, nil)
+		require.NoError(t, err)
+		require.Equal(t, "Analysts", res.DisplayName)
+		require.Equal(t, "3", res.Id.Resource)
+
+		grants, _, _, err := groupBuilder.Grants(ctx, res, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+		require.Equal(t, "group:3:member", grants[0].Entitlement.Id)
+		require.Equal(t, "1", grants[0].Principal.Id.Resource)
+		require.Equal(t, "group:3:manager", grants[1].Entitlement.Id)
+		require.Equal(t, "2", grants[1].Principal.Id.Resource)
+
+		grants, _, _, err = groupBuilder.Grants(ctx, res, &pagination.Token{})
+		require.NoError(t, err)
+		require.Empty(t, grants)
+	})
+
+	t.Run("should return error if the group cannot be fetched", func(t *testing.T) {
+		groupBuilder, mockClient := newTestGroupBuilder()
+		mockClient.GetGroupByIDFunc = func(ctx context.Context, id string) (*client.Group, *v2.RateLimitDescription, error) {
+			return nil, nil, fmt.Errorf("not found")
+		}
+
+		res, _, err := groupBuilder.Get(ctx, groupID, nil)
+		require.Error(t, err)
+		require.Nil(t, res)
+	})
+}
+
 func TestGroupsEntitlements(t *testing.T) {
 	ctx := context.Background()
 	groupResource := &v2.Resource{
@@ -108,6 +158,105 @@ func TestGroupsEntitlements(t *testing.T) {
 		require.Len(t, entitlements, 1)
 
 		require.Equal(t, "group:1:member", entitlements[0].Id)
+		require.Len(t, entitlements[0].GrantableTo, 1, "api keys cannot be granted a membership")
+		require.Equal(t, UserResourceType.Id, entitlements[0].GrantableTo[0].Id)
+	})
+}
+
+func TestGroupsSSOMappings(t *testing.T) {
+	ctx := context.Background()
+	settings := map[string]any{
+		"saml-group-sync":     true,
+		"saml-group-mappings": map[string]any{"okta-analysts": []any{float64(3)}, "okta-data": []any{float64(3), float64(4)}},
+		"ldap-group-sync":     false,
+		"ldap-group-mappings": map[string]any{"cn=admins": []any{float64(2)}},
+	}
+
+	newBuilder := func(protect bool) (*groupBuilder, *client.MockService) {
+		mockClient := &client.MockService{
+			ListGroupsFunc: func(ctx context.Context) ([]*client.Group, *v2.RateLimitDescription, error) {
+				return []*client.Group{{ID: 2, Name: "Administrators"}, {ID: 3, Name: "Analysts"}}, nil, nil
+			},
+			GetSettingFunc: func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+				return settings[key], nil, nil
+			},
+		}
+		return newGroupBuilder(mockClient, groupSyncOptions{protectSSOMapped: protect}), mockClient
+	}
+
+	profileOf := func(t *testing.T, res *v2.Resource) map[string]interface{} {
+		trait, err := resourceSdk.GetGroupTrait(res)
+		require.NoError(t, err)
+		return trait.GetProfile().AsMap()
+	}
+
+	t.Run("should add the mapped IdP groups to the profile", func(t *testing.T) {
+		builder, _ := newBuilder(false)
+		resources, _, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+
+		admins := profileOf(t, resources[0])
+		require.Equal(t, false, admins["sso_mapped"], "ldap group sync is turned off")
+		require.NotContains(t, admins, "ldap_group_mappings")
+
+		analysts := profileOf(t, resources[1])
+		require.Equal(t, true, analysts["sso_mapped"])
+		require.Equal(t, []interface{}{"okta-analysts", "okta-data"}, analysts["saml_group_mappings"])
+
+		entitlements, _, _, err := builder.Entitlements(ctx, resources[1], &pagination.Token{})
+		require.NoError(t, err)
+		annos := annotations.Annotations(entitlements[0].Annotations)
+		require.False(t, annos.Contains(&v2.EntitlementImmutable{}))
+	})
+
+	t.Run("should protect mapped groups when enabled", func(t *testing.T) {
+		builder, _ := newBuilder(true)
+		resources, _, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+
+		entitlements, _, _, err := builder.Entitlements(ctx, resources[1], &pagination.Token{})
+		require.NoError(t, err)
+		annos := annotations.Annotations(entitlements[0].Annotations)
+		require.True(t, annos.Contains(&v2.EntitlementImmutable{}))
+
+		entitlements, _, _, err = builder.Entitlements(ctx, resources[0], &pagination.Token{})
+		require.NoError(t, err)
+		annos = annotations.Annotations(entitlements[0].Annotations)
+		require.False(t, annos.Contains(&v2.EntitlementImmutable{}))
+
+		user := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: "12"}}
+		_, err = builder.Grant(ctx, user, &v2.Entitlement{Id: MemberPermission, Resource: resources[1]})
+		require.ErrorContains(t, err, "group 3 is managed through saml group mappings")
+
+		_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: &v2.Entitlement{Resource: resources[1]}, Principal: user})
+		require.ErrorContains(t, err, "group 3 is managed through saml group mappings")
+	})
+
+	t.Run("should read the mappings again after a failed sync", func(t *testing.T) {
+		builder, mockClient := newBuilder(false)
+		mockClient.ListGroupsPageFunc = func(ctx context.Context, opts client.PageOptions) ([]*client.Group, string, *v2.RateLimitDescription, error) {
+			if opts.Offset > 0 {
+				return nil, "", nil, fmt.Errorf("API error")
+			}
+			return []*client.Group{{ID: 3, Name: "Analysts"}}, "1", nil, nil
+		}
+		reads := 0
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			if key == "saml-group-sync" {
+				reads++
+			}
+			return settings[key], nil, nil
+		}
+
+		_, next, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		_, _, _, err = builder.List(ctx, nil, &pagination.Token{Token: next})
+		require.Error(t, err)
+		require.Equal(t, 1, reads)
+
+		_, _, _, err = builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Equal(t, 2, reads)
 	})
 }
 
@@ -264,4 +413,14 @@ func TestGroupsGrantAndRevoke(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "list error")
 	})
+	t.Run("grant and revoke refuse api key principals", func(t *testing.T) {
+		builder, _ := newTestGroupBuilder()
+		apiKeyResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: APIKeyResourceType.Id, Resource: "4"}}
+
+		_, err := builder.Grant(ctx, apiKeyResource, &v2.Entitlement{Id: MemberPermission, Resource: groupResource})
+		require.ErrorContains(t, err, "api key 4")
+
+		_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: &v2.Entitlement{Resource: groupResource}, Principal: apiKeyResource})
+		require.ErrorContains(t, err, "api key 4")
+	})
 }
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 )
 
@@ -30,3 +31,26 @@ func getPageOptions(pToken *pagination.Token, pageSize int) (client.PageOptions,
 		Offset: offset,
 	}, nil
 }
+
+func isOverRateLimit(desc *v2.RateLimitDescription) bool {
+	return desc != nil && desc.Status == v2.RateLimitDescription_STATUS_OVERLIMIT
+}
+
+// mostRestrictiveRateLimit picks the description the SDK should act on when several requests
+// were made for one call: an over-limit report wins, otherwise the one with the fewest requests left.
+func mostRestrictiveRateLimit(current, candidate *v2.RateLimitDescription) *v2.RateLimitDescription {
+	switch {
+	case candidate == nil:
+		return current
+	case current == nil:
+		return candidate
+	case isOverRateLimit(current):
+		return current
+	case isOverRateLimit(candidate):
+		return candidate
+	case candidate.Limit > 0 && (current.Limit == 0 || candidate.Remaining < current.Remaining):
+		return candidate
+	default:
+		return current
+	}
+}
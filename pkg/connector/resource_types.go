@@ -15,4 +15,25 @@ var (
 		DisplayName: "Group",
 		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
 	}
+	APIKeyResourceType = &v2.ResourceType{
+		Id:          "api_key",
+		DisplayName: "API Key",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_USER},
+	}
+	// DatabaseResourceType and TableResourceType are only synced on paid plans, where
+	// data permissions such as impersonation and sandboxes can be set per database and table.
+	DatabaseResourceType = &v2.ResourceType{
+		Id:          "database",
+		DisplayName: "Database",
+	}
+	TableResourceType = &v2.ResourceType{
+		Id:          "table",
+		DisplayName: "Table",
+	}
+	// ApplicationResourceType is the Metabase instance itself, carrying the paid application
+	// permissions that give groups access to admin settings, monitoring and subscriptions.
+	ApplicationResourceType = &v2.ResourceType{
+		Id:          "application",
+		DisplayName: "Application",
+	}
 )
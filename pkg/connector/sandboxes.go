@@ -0,0 +1,336 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// View-data levels the connector sets on a table when a sandbox is granted or revoked.
+// Revoking sets the table to blocked rather than unrestricted so removing a sandbox never widens access.
+const (
+	viewDataSandboxed = "sandboxed"
+	viewDataBlocked   = "blocked"
+)
+
+// sandboxRemapping maps a user attribute to the column of a table it filters on.
+type sandboxRemapping struct {
+	attribute string
+	table     string
+	column    string
+}
+
+// parseSandboxRemappings parses remappings written as attribute=table.column, where the table
+// may be schema qualified, e.g. region=public.orders.region.
+func parseSandboxRemappings(values []string) ([]sandboxRemapping, error) {
+	remappings := make([]sandboxRemapping, 0, len(values))
+	for _, value := range values {
+		attribute, target, ok := strings.Cut(strings.TrimSpace(value), "=")
+		idx := strings.LastIndex(target, ".")
+		if !ok || attribute == "" || idx <= 0 || idx == len(target)-1 {
+			return nil, fmt.Errorf("invalid sandbox attribute remapping %q, expected attribute=table.column", value)
+		}
+		remappings = append(remappings, sandboxRemapping{
+			attribute: attribute,
+			table:     target[:idx],
+			column:    target[idx+1:],
+		})
+	}
+	return remappings, nil
+}
+
+func (r sandboxRemapping) matches(table *client.Table) bool {
+	return strings.EqualFold(r.table, table.Name) ||
+		(table.Schema != "" && strings.EqualFold(r.table, table.Schema+"."+table.Name))
+}
+
+// attributeRemappings builds the attribute_remappings of a sandbox of table from the configured
+// remappings that target it, in the ["dimension", ["field", id, nil]] form Metabase expects.
+func attributeRemappings(remappings []sandboxRemapping, table *client.Table) (map[string]any, error) {
+	out := make(map[string]any)
+	for _, remapping := range remappings {
+		if !remapping.matches(table) {
+			continue
+		}
+
+		fieldID := 0
+		for _, field := range table.Fields {
+			if strings.EqualFold(field.Name, remapping.column) {
+				fieldID = field.ID
+				break
+			}
+		}
+		if fieldID == 0 {
+			return nil, fmt.Errorf("column %s of sandbox attribute %s does not exist in table %s", remapping.column, remapping.attribute, table.Name)
+		}
+		out[remapping.attribute] = []any{"dimension", []any{"field", fieldID, nil}}
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no sandbox attribute remapping is configured for table %s", table.Name)
+	}
+	return out, nil
+}
+
+// findSandbox returns the sandbox of a table for a group, or nil when there is none.
+func findSandbox(sandboxes []*client.Sandbox, groupID, tableID string) *client.Sandbox {
+	for _, sandbox := range sandboxes {
+		if strconv.Itoa(sandbox.GroupID) == groupID && strconv.Itoa(sandbox.TableID) == tableID {
+			return sandbox
+		}
+	}
+	return nil
+}
+
+// setTableViewData sets the view-data level of one table for a group through a revisioned update of
+// the permissions graph, then checks the graph Metabase returns reflects it. A database-level or
+// schema-level value is first expanded to every table so the other tables keep their access.
+func setTableViewData(ctx context.Context, c client.ClientService, groupID string, table *client.Table, level string) (*v2.RateLimitDescription, error) {
+	graph, rateLimitDesc, err := c.GetPermissionsGraph(ctx)
+	if err != nil {
+		return rateLimitDesc, err
+	}
+
+	metadata, rl, err := c.GetDatabaseMetadata(ctx, table.DBID)
+	rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+	if err != nil {
+		return rateLimitDesc, err
+	}
+
+	databaseKey := strconv.Itoa(table.DBID)
+	tableKey := strconv.Itoa(table.ID)
+
+	groupPerms, err := graph.GroupCopy(groupID)
+	if err != nil {
+		return rateLimitDesc, err
+	}
+	databasePerms, _ := groupPerms[databaseKey].(map[string]any)
+	if databasePerms == nil {
+		databasePerms = make(map[string]any)
+	}
+
+	viewData := granularViewData(databasePerms["view-data"], metadata.Tables)
+	schemaPerms, _ := viewData[table.Schema].(map[string]any)
+	if schemaPerms == nil {
+		schemaPerms = make(map[string]any)
+		viewData[table.Schema] = schemaPerms
+	}
+	schemaPerms[tableKey] = level
+	databasePerms["view-data"] = viewData
+	groupPerms[databaseKey] = databasePerms
+
+	// The whole group document is sent so other databases of the group are left as they are.
+	updated, rl, err := c.UpdatePermissionsGraph(ctx, &client.PermissionsGraph{
+		Revision: graph.Revision,
+		Groups:   map[string]map[string]any{groupID: groupPerms},
+	})
+	rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, rl)
+	if err != nil {
+		return rateLimitDesc, err
+	}
+
+	if got := tableViewData(updated.Groups[groupID][databaseKey], table.Schema, tableKey); got != level {
+		return rateLimitDesc, fmt.Errorf("permissions graph shows view-data %q instead of %q on table %s for group %s", got, level, tableKey, groupID)
+	}
+
+	ctxzap.Extract(ctx).Debug("updated table view-data",
+		zap.String("group_id", groupID),
+		zap.String("table_id", tableKey),
+		zap.String("view_data", level),
+		zap.Int("revision", updated.Revision),
+	)
+
+	return rateLimitDesc, nil
+}
+
+// granularViewData expands a view-data value into schema -> table -> level for the given tables.
+func granularViewData(current any, tables []*client.Table) map[string]any {
+	out := make(map[string]any)
+	setLevel := func(schema, tableID string, level any) {
+		schemaPerms, _ := out[schema].(map[string]any)
+		if schemaPerms == nil {
+			schemaPerms = make(map[string]any)
+			out[schema] = schemaPerms
+		}
+		schemaPerms[tableID] = level
+	}
+
+	switch v := current.(type) {
+	case string:
+		for _, table := range tables {
+			setLevel(table.Schema, strconv.Itoa(table.ID), v)
+		}
+	case map[string]any:
+		for schema, schemaValue := range v {
+			switch sv := schemaValue.(type) {
+			case string:
+				for _, table := range tables {
+					if table.Schema == schema {
+						setLevel(schema, strconv.Itoa(table.ID), sv)
+					}
+				}
+			case map[string]any:
+				for tableID, level := range sv {
+					setLevel(schema, tableID, level)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// tableViewData resolves the view-data level of one table from a group's permissions on its database.
+func tableViewData(databasePerms any, schema, tableID string) string {
+	perms, _ := databasePerms.(map[string]any)
+	switch v := perms["view-data"].(type) {
+	case string:
+		return v
+	case map[string]any:
+		switch sv := v[schema].(type) {
+		case string:
+			return sv
+		case map[string]any:
+			level, _ := sv[tableID].(string)
+			return level
+		}
+	}
+	return ""
+}
+
+// Grant sandboxes a table for a group: it creates the sandbox with the configured attribute
+// remappings and marks the table as sandboxed in the group's view-data permissions.
+func (t *tableBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+	// Grants must not report the sandboxes listed before this change.
+	defer t.sandboxes.reset()
+
+	if principal.Id.ResourceType != GroupResourceType.Id {
+		return nil, fmt.Errorf("only groups can be sandboxed, got %s", principal.Id.ResourceType)
+	}
+	if !strings.HasSuffix(entitlement.Id, ":"+SandboxedPermission) {
+		return nil, fmt.Errorf("unsupported entitlement id %q", entitlement.Id)
+	}
+
+	groupID := principal.Id.Resource
+	tableID := entitlement.Resource.Id.Resource
+
+	groupIDInt, err := strconv.Atoi(groupID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group id %q: %w", groupID, err)
+	}
+
+	sandboxes, rateLimitDesc, err := t.client.ListSandboxes(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, fmt.Errorf("failed to list sandboxes: %w", err)
+	}
+	if findSandbox(sandboxes, groupID, tableID) != nil {
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
+	}
+
+	table, rateLimitDesc, err := t.client.GetTableMetadata(ctx, tableID)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	remappings, err := attributeRemappings(t.sandboxRemappings, table)
+	if err != nil {
+		return ann, err
+	}
+
+	created, rateLimitDesc, err := t.client.CreateSandbox(ctx, &client.Sandbox{
+		GroupID:             groupIDInt,
+		TableID:             table.ID,
+		AttributeRemappings: remappings,
+	})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	rateLimitDesc, err = setTableViewData(ctx, t.client, groupID, table, viewDataSandboxed)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		// Without the permission the sandbox has no effect, so it is removed rather than left behind.
+		if _, deleteErr := t.client.DeleteSandbox(ctx, strconv.Itoa(created.ID)); deleteErr != nil {
+			l.Error("failed to remove sandbox after permissions update failed", zap.Int("sandbox_id", created.ID), zap.Error(deleteErr))
+		}
+		return ann, fmt.Errorf("failed to sandbox table %s for group %s: %w", tableID, groupID, err)
+	}
+
+	return ann, nil
+}
+
+// Revoke blocks the group from viewing the table and then deletes the sandbox of the table for the group.
+func (t *tableBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	ann := annotations.New()
+	// Grants must not report the sandboxes listed before this change.
+	defer t.sandboxes.reset()
+
+	if grant.Principal.Id.ResourceType != GroupResourceType.Id {
+		return nil, fmt.Errorf("only groups can be sandboxed, got %s", grant.Principal.Id.ResourceType)
+	}
+
+	groupID := grant.Principal.Id.Resource
+	tableID := grant.Entitlement.Resource.Id.Resource
+
+	sandboxes, rateLimitDesc, err := t.client.ListSandboxes(ctx)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, fmt.Errorf("failed to list sandboxes: %w", err)
+	}
+	sandbox := findSandbox(sandboxes, groupID, tableID)
+	if sandbox == nil {
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	}
+
+	table, rateLimitDesc, err := t.client.GetTableMetadata(ctx, tableID)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, err
+	}
+
+	// The table is blocked before the sandbox is deleted, so that a failed graph write leaves the
+	// group with sandboxed access rather than with whatever the graph allows without the sandbox.
+	rateLimitDesc, err = setTableViewData(ctx, t.client, groupID, table, viewDataBlocked)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return ann, fmt.Errorf("failed to block table %s for group %s: %w", tableID, groupID, err)
+	}
+
+	// Metabase may already have removed the sandbox along with the sandboxed permission.
+	rateLimitDesc, err = t.client.DeleteSandbox(ctx, strconv.Itoa(sandbox.ID))
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil && status.Code(err) != codes.NotFound {
+		return ann, err
+	}
+
+	return ann, nil
+}
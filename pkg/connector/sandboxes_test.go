@@ -0,0 +1,245 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseSandboxRemappings(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []sandboxRemapping
+		wantErr bool
+	}{
+		{
+			name:   "table and column",
+			values: []string{"region=orders.region"},
+			want:   []sandboxRemapping{{attribute: "region", table: "orders", column: "region"}},
+		},
+		{
+			name:   "schema qualified table",
+			values: []string{"tenant=public.orders.tenant_id"},
+			want:   []sandboxRemapping{{attribute: "tenant", table: "public.orders", column: "tenant_id"}},
+		},
+		{name: "missing attribute", values: []string{"=orders.region"}, wantErr: true},
+		{name: "missing column", values: []string{"region=orders"}, wantErr: true},
+		{name: "trailing dot", values: []string{"region=orders."}, wantErr: true},
+		{name: "no separator", values: []string{"orders.region"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSandboxRemappings(tt.values)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAttributeRemappings(t *testing.T) {
+	table := &client.Table{ID: 10, Name: "orders", Schema: "public", Fields: []*client.Field{{ID: 1001, Name: "tenant_id"}, {ID: 1002, Name: "region"}}}
+
+	remappings, err := parseSandboxRemappings([]string{"tenant=public.orders.tenant_id", "region=ORDERS.region", "other=customers.id"})
+	require.NoError(t, err)
+
+	got, err := attributeRemappings(remappings, table)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"tenant": []any{"dimension", []any{"field", 1001, nil}},
+		"region": []any{"dimension", []any{"field", 1002, nil}},
+	}, got)
+
+	_, err = attributeRemappings(remappings[2:], table)
+	require.ErrorContains(t, err, "no sandbox attribute remapping")
+
+	missing, err := parseSandboxRemappings([]string{"tenant=orders.missing"})
+	require.NoError(t, err)
+	_, err = attributeRemappings(missing, table)
+	require.ErrorContains(t, err, "does not exist")
+}
+
+func TestGranularViewData(t *testing.T) {
+	tables := []*client.Table{{ID: 10, Schema: "public"}, {ID: 11, Schema: "public"}, {ID: 12, Schema: "sales"}}
+
+	require.Equal(t, map[string]any{
+		"public": map[string]any{"10": "unrestricted", "11": "unrestricted"},
+		"sales":  map[string]any{"12": "unrestricted"},
+	}, granularViewData("unrestricted", tables))
+
+	require.Equal(t, map[string]any{
+		"public": map[string]any{"10": "blocked", "11": "blocked"},
+		"sales":  map[string]any{"12": "sandboxed"},
+	}, granularViewData(map[string]any{"public": "blocked", "sales": map[string]any{"12": "sandboxed"}}, tables))
+
+	require.Empty(t, granularViewData(nil, tables))
+
+	require.Equal(t, "sandboxed", tableViewData(map[string]any{"view-data": map[string]any{"sales": map[string]any{"12": "sandboxed"}}}, "sales", "12"))
+	require.Equal(t, "unrestricted", tableViewData(map[string]any{"view-data": "unrestricted"}, "sales", "12"))
+	require.Equal(t, "", tableViewData(nil, "sales", "12"))
+}
+
+func TestTablesSandboxGrant(t *testing.T) {
+	ctx := context.Background()
+	remappings, err := parseSandboxRemappings([]string{"tenant=orders.tenant_id"})
+	require.NoError(t, err)
+
+	group := &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "3"}}
+	entitlement := &v2.Entitlement{
+		Id:       "table:10:sandboxed",
+		Resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: TableResourceType.Id, Resource: "10"}},
+	}
+	table := &client.Table{ID: 10, DBID: 1, Name: "orders", Schema: "public", Fields: []*client.Field{{ID: 1001, Name: "tenant_id"}}}
+
+	newMock := func(graphLevel string) (*client.MockService, *[]string) {
+		var deleted []string
+		return &client.MockService{
+			ListSandboxesFunc: func(ctx context.Context) ([]*client.Sandbox, *v2.RateLimitDescription, error) {
+				return []*client.Sandbox{{ID: 1, GroupID: 4, TableID: 10}}, nil, nil
+			},
+			GetTableMetadataFunc: func(ctx context.Context, tableID string) (*client.Table, *v2.RateLimitDescription, error) {
+				return table, nil, nil
+			},
+			CreateSandboxFunc: func(ctx context.Context, sandbox *client.Sandbox) (*client.Sandbox, *v2.RateLimitDescription, error) {
+				require.Equal(t, 3, sandbox.GroupID)
+				require.Equal(t, 10, sandbox.TableID)
+				require.Contains(t, sandbox.AttributeRemappings, "tenant")
+				sandbox.ID = 5
+				return sandbox, nil, nil
+			},
+			DeleteSandboxFunc: func(ctx context.Context, sandboxID string) (*v2.RateLimitDescription, error) {
+				deleted = append(deleted, sandboxID)
+				return nil, nil
+			},
+			GetPermissionsGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				return &client.PermissionsGraph{Revision: 7, Groups: map[string]map[string]any{
+					"3": {"1": map[string]any{"view-data": "unrestricted"}, "2": map[string]any{"view-data": "blocked"}},
+				}}, nil, nil
+			},
+			GetDatabaseMetadataFunc: func(ctx context.Context, databaseID int) (*client.DatabaseMetadata, *v2.RateLimitDescription, error) {
+				return &client.DatabaseMetadata{Tables: []*client.Table{table, {ID: 11, DBID: 1, Name: "customers", Schema: "public"}}}, nil, nil
+			},
+			UpdatePermissionsGraphFunc: func(ctx context.Context, graph *client.PermissionsGraph) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				require.Equal(t, 7, graph.Revision)
+				perms := graph.Groups["3"]
+				require.Equal(t, map[string]any{"view-data": "blocked"}, perms["2"])
+				require.Equal(t, map[string]any{"public": map[string]any{"10": "sandboxed", "11": "unrestricted"}}, perms["1"].(map[string]any)["view-data"])
+				return &client.PermissionsGraph{Revision: 8, Groups: map[string]map[string]any{
+					"3": {"1": map[string]any{"view-data": graphLevel}},
+				}}, nil, nil
+			},
+		}, &deleted
+	}
+
+	t.Run("creates the sandbox and sandboxes the table", func(t *testing.T) {
+		mockClient, deleted := newMock("sandboxed")
+		_, err := newTableBuilder(mockClient, tableSyncOptions{sandboxRemappings: remappings}).Grant(ctx, group, entitlement)
+		require.NoError(t, err)
+		require.Empty(t, *deleted)
+	})
+
+	t.Run("removes the sandbox when the graph does not show it", func(t *testing.T) {
+		mockClient, deleted := newMock("unrestricted")
+		_, err := newTableBuilder(mockClient, tableSyncOptions{sandboxRemappings: remappings}).Grant(ctx, group, entitlement)
+		require.ErrorContains(t, err, `view-data "unrestricted" instead of "sandboxed"`)
+		require.Equal(t, []string{"5"}, *deleted)
+	})
+
+	t.Run("only groups can be sandboxed", func(t *testing.T) {
+		mockClient, _ := newMock("sandboxed")
+		user := &v2.Resource{Id: &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: "3"}}
+		_, err := newTableBuilder(mockClient, tableSyncOptions{sandboxRemappings: remappings}).Grant(ctx, user, entitlement)
+		require.Error(t, err)
+	})
+
+	t.Run("rate limit returned", func(t *testing.T) {
+		failing := &client.MockService{
+			ListSandboxesFunc: func(ctx context.Context) ([]*client.Sandbox, *v2.RateLimitDescription, error) {
+				return nil, &v2.RateLimitDescription{Limit: 10}, fmt.Errorf("rate limit error")
+			},
+		}
+
+		ann, err := newTableBuilder(failing, tableSyncOptions{sandboxRemappings: remappings}).Grant(ctx, group, entitlement)
+		require.Error(t, err)
+		require.NotEmpty(t, ann)
+	})
+}
+
+func TestTablesSandboxRevoke(t *testing.T) {
+	ctx := context.Background()
+
+	grant := &v2.Grant{
+		Entitlement: &v2.Entitlement{
+			Id:       "table:10:sandboxed",
+			Resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: TableResourceType.Id, Resource: "10"}},
+		},
+		Principal: &v2.Resource{Id: &v2.ResourceId{ResourceType: GroupResourceType.Id, Resource: "3"}},
+	}
+	table := &client.Table{ID: 10, DBID: 1, Name: "orders", Schema: "public"}
+
+	newMock := func(calls *[]string, updateErr error, deleteErr error) *client.MockService {
+		return &client.MockService{
+			ListSandboxesFunc: func(ctx context.Context) ([]*client.Sandbox, *v2.RateLimitDescription, error) {
+				return []*client.Sandbox{{ID: 5, GroupID: 3, TableID: 10}}, nil, nil
+			},
+			GetTableMetadataFunc: func(ctx context.Context, tableID string) (*client.Table, *v2.RateLimitDescription, error) {
+				return table, nil, nil
+			},
+			GetPermissionsGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				return &client.PermissionsGraph{Revision: 7, Groups: map[string]map[string]any{
+					"3": {"1": map[string]any{"view-data": map[string]any{"public": map[string]any{"10": "sandboxed"}}}},
+				}}, nil, nil
+			},
+			GetDatabaseMetadataFunc: func(ctx context.Context, databaseID int) (*client.DatabaseMetadata, *v2.RateLimitDescription, error) {
+				return &client.DatabaseMetadata{Tables: []*client.Table{table}}, nil, nil
+			},
+			UpdatePermissionsGraphFunc: func(ctx context.Context, graph *client.PermissionsGraph) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+				*calls = append(*calls, "block")
+				if updateErr != nil {
+					return nil, nil, updateErr
+				}
+				return &client.PermissionsGraph{Revision: 8, Groups: map[string]map[string]any{
+					"3": {"1": map[string]any{"view-data": map[string]any{"public": map[string]any{"10": "blocked"}}}},
+				}}, nil, nil
+			},
+			DeleteSandboxFunc: func(ctx context.Context, sandboxID string) (*v2.RateLimitDescription, error) {
+				require.Equal(t, "5", sandboxID)
+				*calls = append(*calls, "delete")
+				return nil, deleteErr
+			},
+		}
+	}
+
+	t.Run("blocks the table before deleting the sandbox", func(t *testing.T) {
+		var calls []string
+		_, err := newTableBuilder(newMock(&calls, nil, nil), tableSyncOptions{}).Revoke(ctx, grant)
+		require.NoError(t, err)
+		require.Equal(t, []string{"block", "delete"}, calls)
+	})
+
+	t.Run("keeps the sandbox when the table cannot be blocked", func(t *testing.T) {
+		var calls []string
+		_, err := newTableBuilder(newMock(&calls, fmt.Errorf("conflict"), nil), tableSyncOptions{}).Revoke(ctx, grant)
+		require.ErrorContains(t, err, "failed to block table 10 for group 3")
+		require.Equal(t, []string{"block"}, calls)
+	})
+
+	t.Run("sandbox already removed by metabase", func(t *testing.T) {
+		var calls []string
+		notFound := fmt.Errorf("failed to delete sandbox 5: %w", status.Error(codes.NotFound, "not found"))
+		_, err := newTableBuilder(newMock(&calls, nil, notFound), tableSyncOptions{}).Revoke(ctx, grant)
+		require.NoError(t, err)
+		require.Equal(t, []string{"block", "delete"}, calls)
+	})
+}
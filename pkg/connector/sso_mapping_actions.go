@@ -0,0 +1,202 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ssoGroupMappingArgs are the parsed arguments shared by the SSO group mapping actions.
+type ssoGroupMappingArgs struct {
+	source   string
+	idpGroup string
+	groupID  int
+}
+
+func (a *ssoGroupMappingArgs) settingKey() string {
+	return a.source + "-group-mappings"
+}
+
+// AddSSOGroupMapping maps an IdP group to a Metabase group in the mapping setting of an SSO method.
+// Adding a mapping that already exists succeeds without changing the setting.
+func (c *Connector) AddSSOGroupMapping(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+
+	mappingArgs, err := parseSSOGroupMappingArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	group := strconv.Itoa(mappingArgs.groupID)
+	_, rateLimitDesc, err := c.client.GetGroupByID(ctx, group)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ann, fmt.Errorf("group %s does not exist", group)
+		}
+		return nil, ann, fmt.Errorf("failed to get group %s: %w", group, err)
+	}
+
+	mappings, rateLimitDesc, err := c.readSSOGroupMappings(ctx, mappingArgs.settingKey())
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	if slices.Contains(mappings[mappingArgs.idpGroup], mappingArgs.groupID) {
+		l.Info("sso group mapping already exists", zap.String("setting", mappingArgs.settingKey()), zap.String("idpGroup", mappingArgs.idpGroup), zap.Int("groupId", mappingArgs.groupID))
+		return ssoGroupMappingResponse(), ann, nil
+	}
+	mappings[mappingArgs.idpGroup] = append(mappings[mappingArgs.idpGroup], mappingArgs.groupID)
+
+	l.Info("adding sso group mapping", zap.String("setting", mappingArgs.settingKey()), zap.String("idpGroup", mappingArgs.idpGroup), zap.Int("groupId", mappingArgs.groupID))
+
+	rateLimitDesc, err = c.client.UpdateSetting(ctx, mappingArgs.settingKey(), mappings)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, fmt.Errorf("failed to add sso group mapping: %w", err)
+	}
+
+	return ssoGroupMappingResponse(), ann, nil
+}
+
+// RemoveSSOGroupMapping removes an IdP group to Metabase group mapping. It refuses to remove the last
+// mapping to Administrators, which would leave nobody to be made an admin through SSO.
+// Removing a mapping that does not exist succeeds without changing the setting.
+func (c *Connector) RemoveSSOGroupMapping(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ann := annotations.New()
+
+	mappingArgs, err := parseSSOGroupMappingArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mappings, rateLimitDesc, err := c.readSSOGroupMappings(ctx, mappingArgs.settingKey())
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	groupIDs := mappings[mappingArgs.idpGroup]
+	idx := slices.Index(groupIDs, mappingArgs.groupID)
+	if idx < 0 {
+		l.Info("sso group mapping does not exist", zap.String("setting", mappingArgs.settingKey()), zap.String("idpGroup", mappingArgs.idpGroup), zap.Int("groupId", mappingArgs.groupID))
+		return ssoGroupMappingResponse(), ann, nil
+	}
+
+	groupIDs = slices.Delete(groupIDs, idx, idx+1)
+	if len(groupIDs) == 0 {
+		delete(mappings, mappingArgs.idpGroup)
+	} else {
+		mappings[mappingArgs.idpGroup] = groupIDs
+	}
+
+	if mappingArgs.groupID == administratorsGroupID && !mapsToGroup(mappings, administratorsGroupID) {
+		return nil, ann, fmt.Errorf("refusing to remove the last %s mapping to the Administrators group", mappingArgs.source)
+	}
+
+	l.Info("removing sso group mapping", zap.String("setting", mappingArgs.settingKey()), zap.String("idpGroup", mappingArgs.idpGroup), zap.Int("groupId", mappingArgs.groupID))
+
+	rateLimitDesc, err = c.client.UpdateSetting(ctx, mappingArgs.settingKey(), mappings)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, fmt.Errorf("failed to remove sso group mapping: %w", err)
+	}
+
+	return ssoGroupMappingResponse(), ann, nil
+}
+
+// readSSOGroupMappings reads a mapping setting as IdP group name to Metabase group IDs.
+// An unset setting is an empty mapping.
+func (c *Connector) readSSOGroupMappings(ctx context.Context, key string) (map[string][]int, *v2.RateLimitDescription, error) {
+	value, rateLimitDesc, err := c.client.GetSetting(ctx, key)
+	if err != nil {
+		return nil, rateLimitDesc, fmt.Errorf("failed to read sso group mappings: %w", err)
+	}
+
+	mappings := make(map[string][]int)
+	raw, _ := value.(map[string]any)
+	for idpGroup, groupIDs := range raw {
+		ids, _ := groupIDs.([]any)
+		// IdP groups mapped to no Metabase group are kept, so writing the mappings back preserves them.
+		mappings[idpGroup] = make([]int, 0, len(ids))
+		for _, id := range ids {
+			mappings[idpGroup] = append(mappings[idpGroup], anyToInt(id))
+		}
+	}
+
+	return mappings, rateLimitDesc, nil
+}
+
+func mapsToGroup(mappings map[string][]int, groupID int) bool {
+	for _, groupIDs := range mappings {
+		if slices.Contains(groupIDs, groupID) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSSOGroupMappingArgs(args *structpb.Struct) (*ssoGroupMappingArgs, error) {
+	if args == nil {
+		return nil, fmt.Errorf("arguments cannot be nil")
+	}
+
+	if args.Fields == nil {
+		return nil, fmt.Errorf("arguments fields cannot be nil")
+	}
+
+	source := args.Fields["source"].GetStringValue()
+	if !slices.Contains(ssoGroupSyncSources, source) {
+		return nil, fmt.Errorf("source must be one of saml, jwt or ldap, got %q", source)
+	}
+
+	idpGroup := args.Fields["idpGroup"].GetStringValue()
+	if idpGroup == "" {
+		return nil, fmt.Errorf("idpGroup cannot be empty")
+	}
+
+	groupIDStr := args.Fields["groupId"].GetStringValue()
+	if groupIDStr == "" {
+		return nil, fmt.Errorf("groupId cannot be empty")
+	}
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid groupId %q: %w", groupIDStr, err)
+	}
+
+	return &ssoGroupMappingArgs{
+		source:   source,
+		idpGroup: idpGroup,
+		groupID:  groupID,
+	}, nil
+}
+
+func ssoGroupMappingResponse() *structpb.Struct {
+	return &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"success": structpb.NewBoolValue(true),
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func ssoGroupMappingArgsStruct(source, idpGroup, groupID string) *structpb.Struct {
+	args, _ := structpb.NewStruct(map[string]interface{}{"source": source, "idpGroup": idpGroup, "groupId": groupID})
+	return args
+}
+
+func TestAddSSOGroupMappingAction(t *testing.T) {
+	ctx := context.Background()
+	connector, mockClient := newTestConnector()
+
+	mockClient.GetGroupByIDFunc = func(ctx context.Context, groupID string) (*client.Group, *v2.RateLimitDescription, error) {
+		if groupID == "99" {
+			return nil, nil, status.Error(codes.NotFound, "group not found")
+		}
+		return &client.Group{ID: 3, Name: "Analysts"}, nil, nil
+	}
+
+	t.Run("adds the group to the idp group", func(t *testing.T) {
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			require.Equal(t, "saml-group-mappings", key)
+			return map[string]any{"analysts": []any{float64(4)}}, nil, nil
+		}
+		var updated any
+		mockClient.UpdateSettingFunc = func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+			require.Equal(t, "saml-group-mappings", key)
+			updated = value
+			return nil, nil
+		}
+
+		resp, _, err := connector.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "analysts", "3"))
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, map[string][]int{"analysts": {4, 3}}, updated)
+	})
+
+	t.Run("idp groups mapped to no group are kept", func(t *testing.T) {
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			return map[string]any{"analysts": []any{float64(4)}, "contractors": []any{}}, nil, nil
+		}
+		var updated any
+		mockClient.UpdateSettingFunc = func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+			updated = value
+			return nil, nil
+		}
+
+		_, _, err := connector.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "analysts", "3"))
+		require.NoError(t, err)
+		require.Equal(t, map[string][]int{"analysts": {4, 3}, "contractors": {}}, updated)
+	})
+
+	t.Run("existing mapping is left alone", func(t *testing.T) {
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			return map[string]any{"analysts": []any{float64(3)}}, nil, nil
+		}
+		mockClient.UpdateSettingFunc = func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+			t.Fatal("setting should not be written")
+			return nil, nil
+		}
+
+		_, _, err := connector.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "analysts", "3"))
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown group", func(t *testing.T) {
+		_, _, err := connector.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("jwt", "analysts", "99"))
+		require.ErrorContains(t, err, "group 99 does not exist")
+	})
+
+	t.Run("unsupported source", func(t *testing.T) {
+		_, _, err := connector.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("google", "analysts", "3"))
+		require.ErrorContains(t, err, "source must be one of saml, jwt or ldap")
+	})
+
+	t.Run("invalid group id", func(t *testing.T) {
+		_, _, err := connector.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("ldap", "cn=analysts", "abc"))
+		require.ErrorContains(t, err, "invalid groupId")
+	})
+
+	t.Run("rate limit returned", func(t *testing.T) {
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			return nil, &v2.RateLimitDescription{Limit: 50}, fmt.Errorf("rate limit error")
+		}
+
+		_, ann, err := connector.AddSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "analysts", "3"))
+		require.Error(t, err)
+		require.NotEmpty(t, ann)
+	})
+}
+
+func TestRemoveSSOGroupMappingAction(t *testing.T) {
+	ctx := context.Background()
+	connector, mockClient := newTestConnector()
+
+	t.Run("removes the group and drops empty idp groups", func(t *testing.T) {
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			require.Equal(t, "jwt-group-mappings", key)
+			return map[string]any{"analysts": []any{float64(3)}, "admins": []any{float64(2)}}, nil, nil
+		}
+		var updated any
+		mockClient.UpdateSettingFunc = func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+			updated = value
+			return nil, nil
+		}
+
+		resp, _, err := connector.RemoveSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("jwt", "analysts", "3"))
+		require.NoError(t, err)
+		require.True(t, resp.Fields["success"].GetBoolValue())
+		require.Equal(t, map[string][]int{"admins": {2}}, updated)
+	})
+
+	t.Run("refuses to remove the last administrators mapping", func(t *testing.T) {
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			return map[string]any{"admins": []any{float64(2), float64(3)}}, nil, nil
+		}
+		mockClient.UpdateSettingFunc = func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+			t.Fatal("setting should not be written")
+			return nil, nil
+		}
+
+		_, _, err := connector.RemoveSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("jwt", "admins", "2"))
+		require.ErrorContains(t, err, "last jwt mapping to the Administrators group")
+	})
+
+	t.Run("removes an administrators mapping when another remains", func(t *testing.T) {
+		mockClient.GetSettingFunc = func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+			return map[string]any{"admins": []any{float64(2)}, "owners": []any{float64(2)}}, nil, nil
+		}
+		var updated any
+		mockClient.UpdateSettingFunc = func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+			updated = value
+			return nil, nil
+		}
+
+		_, _, err := connector.RemoveSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("jwt", "admins", "2"))
+		require.NoError(t, err)
+		require.Equal(t, map[string][]int{"owners": {2}}, updated)
+	})
+
+	t.Run("missing mapping is left alone", func(t *testing.T) {
+		mockClient.GetSettingFunc = nil
+		mockClient.UpdateSettingFunc = func(ctx context.Context, key string, value any) (*v2.RateLimitDescription, error) {
+			t.Fatal("setting should not be written")
+			return nil, nil
+		}
+
+		_, _, err := connector.RemoveSSOGroupMapping(ctx, ssoGroupMappingArgsStruct("saml", "analysts", "3"))
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,46 @@
+package connector
+
+import (
+	"sync"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// syncCache holds an instance-wide document for the duration of a sync, so it is read once per
+// sync rather than once per resource. Builders reset it on the first page of their List, so a sync
+// never reuses what an earlier sync read, even one that failed part way through.
+type syncCache[T any] struct {
+	mu     sync.Mutex
+	loaded bool
+	value  T
+}
+
+// load returns the cached value, calling fetch when nothing has been read since the last reset.
+// A failed fetch is not cached.
+func (c *syncCache[T]) load(fetch func() (T, *v2.RateLimitDescription, error)) (T, *v2.RateLimitDescription, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.loaded {
+		return c.value, nil, nil
+	}
+
+	value, rateLimitDesc, err := fetch()
+	if err != nil {
+		var zero T
+		return zero, rateLimitDesc, err
+	}
+	c.loaded = true
+	c.value = value
+
+	return value, rateLimitDesc, nil
+}
+
+func (c *syncCache[T]) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	c.loaded = false
+	c.value = zero
+}
@@ -0,0 +1,203 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// SandboxedPermission is held by a group whose view of a table is limited by a sandbox.
+const SandboxedPermission = "sandboxed"
+
+// tableSyncOptions are the optional table behaviors enabled through configuration.
+type tableSyncOptions struct {
+	// groupFilter is nil unless groups are filtered; sandboxes of filtered out groups are not granted.
+	groupFilter *groupFilter
+	// sandboxRemappings are the attribute remappings of sandboxes created through Grant.
+	sandboxRemappings []sandboxRemapping
+}
+
+// tableBuilder syncs the tables of each database along with the sandboxes that limit them.
+type tableBuilder struct {
+	client client.ClientService
+	tableSyncOptions
+	// sandboxes holds the sandboxes of the instance keyed by table ID. They are listed once per
+	// sync rather than once per table.
+	sandboxes syncCache[map[int][]*client.Sandbox]
+}
+
+func (t *tableBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return TableResourceType
+}
+
+func (t *tableBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	ann := annotations.New()
+
+	// Tables are listed per database and always before any grants, so every sync reads the
+	// sandboxes again.
+	t.sandboxes.reset()
+
+	databaseID, err := strconv.Atoi(parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("invalid database id %q: %w", parentResourceID.Resource, err)
+	}
+
+	metadata, rateLimitDesc, err := t.client.GetDatabaseMetadata(ctx, databaseID)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	outResources := make([]*v2.Resource, 0, len(metadata.Tables))
+	for _, table := range metadata.Tables {
+		res, err := parseIntoTableResource(table, parentResourceID)
+		if err != nil {
+			return nil, "", ann, err
+		}
+		outResources = append(outResources, res)
+	}
+
+	return outResources, "", ann, nil
+}
+
+func (t *tableBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		entitlement.NewPermissionEntitlement(resource, SandboxedPermission,
+			entitlement.WithGrantableTo(GroupResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("%s Sandboxed", resource.DisplayName)),
+			entitlement.WithDescription(fmt.Sprintf("Sees the rows of %s allowed by a sandbox in Metabase", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+// Grants reports one grant per sandbox of the table, to the sandboxed group. Members of the group
+// inherit it, and the grant metadata holds the question and attribute remappings the sandbox applies.
+func (t *tableBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ann := annotations.New()
+
+	sandboxesByTable, rateLimitDesc, err := t.sandboxes.load(func() (map[int][]*client.Sandbox, *v2.RateLimitDescription, error) {
+		sandboxes, rateLimitDesc, err := t.client.ListSandboxes(ctx)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("failed to list sandboxes: %w", err)
+		}
+		byTable := make(map[int][]*client.Sandbox)
+		for _, sandbox := range sandboxes {
+			byTable[sandbox.TableID] = append(byTable[sandbox.TableID], sandbox)
+		}
+		return byTable, rateLimitDesc, nil
+	})
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+	tableID, err := strconv.Atoi(resource.Id.Resource)
+	if err != nil {
+		return nil, "", ann, fmt.Errorf("invalid table id %q: %w", resource.Id.Resource, err)
+	}
+
+	groupAllowed, rateLimitDesc, err := t.groupFilter.allowedGroups(ctx, t.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+
+	var grants []*v2.Grant
+	for _, sandbox := range sandboxesByTable[tableID] {
+		if !groupAllowed(sandbox.GroupID) {
+			continue
+		}
+
+		groupResource := &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: GroupResourceType.Id,
+				Resource:     strconv.Itoa(sandbox.GroupID),
+			},
+		}
+		grants = append(grants, grant.NewGrant(
+			resource,
+			SandboxedPermission,
+			groupResource.Id,
+			grant.WithGrantMetadata(sandboxMetadata(sandbox, resource)),
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{entitlement.NewEntitlementID(groupResource, MemberPermission)},
+			}),
+		))
+	}
+
+	return grants, "", ann, nil
+}
+
+// sandboxMetadata describes a sandbox for the grant metadata. card_id is nil for sandboxes that
+// only filter the table by user attributes.
+func sandboxMetadata(sandbox *client.Sandbox, table *v2.Resource) map[string]interface{} {
+	var cardID interface{}
+	if sandbox.CardID != nil {
+		cardID = *sandbox.CardID
+	}
+
+	remappings := make(map[string]interface{}, len(sandbox.AttributeRemappings))
+	for attribute, target := range sandbox.AttributeRemappings {
+		remappings[attribute] = target
+	}
+
+	metadata := map[string]interface{}{
+		"sandbox_id":           sandbox.ID,
+		"group_id":             strconv.Itoa(sandbox.GroupID),
+		"table_id":             table.Id.Resource,
+		"card_id":              cardID,
+		"attribute_remappings": remappings,
+	}
+	if table.ParentResourceId != nil {
+		metadata["database_id"] = table.ParentResourceId.Resource
+	}
+	return metadata
+}
+
+func parseIntoTableResource(table *client.Table, databaseID *v2.ResourceId) (*v2.Resource, error) {
+	name := table.DisplayName
+	if name == "" {
+		name = table.Name
+	}
+	if table.Schema != "" {
+		name = table.Schema + "." + name
+	}
+
+	profile := map[string]interface{}{
+		"name":        table.Name,
+		"schema":      table.Schema,
+		"database_id": databaseID.Resource,
+	}
+
+	return resourceSdk.NewResource(
+		name,
+		TableResourceType,
+		table.ID,
+		resourceSdk.WithResourceProfile(profile),
+		resourceSdk.WithParentResourceID(databaseID),
+	)
+}
+
+func newTableBuilder(client client.ClientService, opts tableSyncOptions) *tableBuilder {
+	return &tableBuilder{
+		client:           client,
+		tableSyncOptions: opts,
+	}
+}
@@ -0,0 +1,276 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+)
+
+// grantMetadata returns the metadata a grant carries in its GrantMetadata annotation.
+func grantMetadata(t *testing.T, g *v2.Grant) map[string]interface{} {
+	t.Helper()
+
+	annos := annotations.Annotations(g.Annotations)
+	metadata := &v2.GrantMetadata{}
+	ok, err := annos.Pick(metadata)
+	require.NoError(t, err)
+	require.True(t, ok)
+	return metadata.GetMetadata().AsMap()
+}
+
+func TestDatabasesList(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &client.MockService{
+		ListDatabasesFunc: func(ctx context.Context) ([]*client.Database, *v2.RateLimitDescription, error) {
+			return []*client.Database{{ID: 1, Name: "Warehouse", Engine: "postgres"}}, nil, nil
+		},
+	}
+
+	resources, _, _, err := newDatabaseBuilder(mockClient, nil).List(ctx, nil, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	require.Equal(t, "Warehouse", resources[0].DisplayName)
+
+	annos := annotations.Annotations(resources[0].Annotations)
+	child := &v2.ChildResourceType{}
+	ok, err := annos.Pick(child)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, TableResourceType.Id, child.ResourceTypeId)
+}
+
+func TestDatabasesImpersonationGrants(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &client.MockService{
+		ListImpersonationsFunc: func(ctx context.Context) ([]*client.Impersonation, *v2.RateLimitDescription, error) {
+			return []*client.Impersonation{
+				{ID: 1, GroupID: 3, DBID: 1, Attribute: "db_role"},
+				{ID: 2, GroupID: 4, DBID: 1, Attribute: "snowflake_role"},
+				{ID: 3, GroupID: 3, DBID: 2, Attribute: "db_role"},
+			}, nil, nil
+		},
+		GetPermissionsGraphFunc: func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			return &client.PermissionsGraph{Groups: map[string]map[string]any{}}, nil, nil
+		},
+	}
+	database := &v2.Resource{
+		Id:          &v2.ResourceId{ResourceType: DatabaseResourceType.Id, Resource: "1"},
+		DisplayName: "Warehouse",
+	}
+
+	t.Run("entitlement grantable to groups", func(t *testing.T) {
+		entitlements, _, _, err := newDatabaseBuilder(mockClient, nil).Entitlements(ctx, database, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, entitlements, 5)
+		require.Equal(t, "database:1:impersonated", entitlements[0].Id)
+		require.Equal(t, GroupResourceType.Id, entitlements[0].GrantableTo[0].Id)
+	})
+
+	t.Run("one grant per impersonation policy of the database", func(t *testing.T) {
+		grants, _, _, err := newDatabaseBuilder(mockClient, nil).Grants(ctx, database, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+
+		require.Equal(t, "database:1:impersonated", grants[0].Entitlement.Id)
+		require.Equal(t, "3", grants[0].Principal.Id.Resource)
+		require.Equal(t, GroupResourceType.Id, grants[0].Principal.Id.ResourceType)
+
+		metadata := grantMetadata(t, grants[0])
+		require.Equal(t, "db_role", metadata["attribute"])
+		require.Equal(t, "1", metadata["database_id"])
+		require.Equal(t, "3", metadata["group_id"])
+		require.Equal(t, float64(1), metadata["impersonation_id"])
+		require.Equal(t, "snowflake_role", grantMetadata(t, grants[1])["attribute"])
+
+		annos := annotations.Annotations(grants[0].Annotations)
+		expandable := &v2.GrantExpandable{}
+		ok, err := annos.Pick(expandable)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []string{"group:3:member"}, expandable.EntitlementIds)
+	})
+
+	t.Run("policies of filtered out groups are left out", func(t *testing.T) {
+		filter, err := newGroupFilter("", "", nil, []string{"4"})
+		require.NoError(t, err)
+
+		grants, _, _, err := newDatabaseBuilder(mockClient, filter).Grants(ctx, database, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+	})
+
+	t.Run("graph and policies are read once per sync", func(t *testing.T) {
+		var graphs, listings int
+		counting := *mockClient
+		counting.GetPermissionsGraphFunc = func(ctx context.Context) (*client.PermissionsGraph, *v2.RateLimitDescription, error) {
+			graphs++
+			return mockClient.GetPermissionsGraphFunc(ctx)
+		}
+		counting.ListImpersonationsFunc = func(ctx context.Context) ([]*client.Impersonation, *v2.RateLimitDescription, error) {
+			listings++
+			return mockClient.ListImpersonationsFunc(ctx)
+		}
+		counting.ListDatabasesFunc = func(ctx context.Context) ([]*client.Database, *v2.RateLimitDescription, error) {
+			return nil, nil, nil
+		}
+		builder := newDatabaseBuilder(&counting, nil)
+		other := &v2.Resource{Id: &v2.ResourceId{ResourceType: DatabaseResourceType.Id, Resource: "2"}}
+
+		grants, _, _, err := builder.Grants(ctx, database, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+		grants, _, _, err = builder.Grants(ctx, other, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		require.Equal(t, 1, graphs)
+		require.Equal(t, 1, listings)
+
+		// Listing databases starts a new sync.
+		_, _, _, err = builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		_, _, _, err = builder.Grants(ctx, database, &pagination.Token{})
+		require.NoError(t, err)
+		require.Equal(t, 2, graphs)
+		require.Equal(t, 2, listings)
+	})
+
+	t.Run("rate limit returned", func(t *testing.T) {
+		failing := &client.MockService{
+			ListImpersonationsFunc: func(ctx context.Context) ([]*client.Impersonation, *v2.RateLimitDescription, error) {
+				return nil, &v2.RateLimitDescription{Limit: 10}, fmt.Errorf("rate limit error")
+			},
+			GetPermissionsGraphFunc: mockClient.GetPermissionsGraphFunc,
+		}
+
+		_, _, ann, err := newDatabaseBuilder(failing, nil).Grants(ctx, database, &pagination.Token{})
+		require.Error(t, err)
+		require.NotEmpty(t, ann)
+	})
+}
+
+func TestTablesList(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &client.MockService{
+		GetDatabaseMetadataFunc: func(ctx context.Context, databaseID int) (*client.DatabaseMetadata, *v2.RateLimitDescription, error) {
+			require.Equal(t, 1, databaseID)
+			return &client.DatabaseMetadata{ID: 1, Tables: []*client.Table{
+				{ID: 10, Name: "orders", DisplayName: "Orders", Schema: "public"},
+			}}, nil, nil
+		},
+	}
+	builder := newTableBuilder(mockClient, tableSyncOptions{})
+
+	t.Run("lists the tables of a database", func(t *testing.T) {
+		parent := &v2.ResourceId{ResourceType: DatabaseResourceType.Id, Resource: "1"}
+		resources, _, _, err := builder.List(ctx, parent, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, resources, 1)
+		require.Equal(t, "public.Orders", resources[0].DisplayName)
+		require.Equal(t, "10", resources[0].Id.Resource)
+		require.Equal(t, parent, resources[0].ParentResourceId)
+	})
+
+	t.Run("tables are only listed under a database", func(t *testing.T) {
+		resources, _, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Empty(t, resources)
+	})
+}
+
+func TestTablesSandboxGrants(t *testing.T) {
+	ctx := context.Background()
+	cardID := 42
+	mockClient := &client.MockService{
+		ListSandboxesFunc: func(ctx context.Context) ([]*client.Sandbox, *v2.RateLimitDescription, error) {
+			return []*client.Sandbox{
+				{ID: 1, GroupID: 3, TableID: 10, AttributeRemappings: map[string]any{"tenant": []any{"dimension", []any{"field", float64(7), nil}}}},
+				{ID: 2, GroupID: 4, TableID: 10, CardID: &cardID},
+				{ID: 3, GroupID: 3, TableID: 11},
+			}, nil, nil
+		},
+	}
+	table := &v2.Resource{
+		Id:               &v2.ResourceId{ResourceType: TableResourceType.Id, Resource: "10"},
+		ParentResourceId: &v2.ResourceId{ResourceType: DatabaseResourceType.Id, Resource: "1"},
+		DisplayName:      "public.Orders",
+	}
+
+	t.Run("one grant per sandbox of the table", func(t *testing.T) {
+		grants, _, _, err := newTableBuilder(mockClient, tableSyncOptions{}).Grants(ctx, table, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+
+		require.Equal(t, "table:10:sandboxed", grants[0].Entitlement.Id)
+		require.Equal(t, "3", grants[0].Principal.Id.Resource)
+		require.Equal(t, GroupResourceType.Id, grants[0].Principal.Id.ResourceType)
+
+		metadata := grantMetadata(t, grants[0])
+		require.Equal(t, "1", metadata["database_id"])
+		require.Nil(t, metadata["card_id"])
+		require.Equal(t, map[string]interface{}{"tenant": []interface{}{"dimension", []interface{}{"field", float64(7), nil}}}, metadata["attribute_remappings"])
+		require.Equal(t, float64(42), grantMetadata(t, grants[1])["card_id"])
+
+		annos := annotations.Annotations(grants[0].Annotations)
+		expandable := &v2.GrantExpandable{}
+		ok, err := annos.Pick(expandable)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []string{"group:3:member"}, expandable.EntitlementIds)
+	})
+
+	t.Run("sandboxes of filtered out groups are left out", func(t *testing.T) {
+		filter, err := newGroupFilter("", "", nil, []string{"4"})
+		require.NoError(t, err)
+
+		grants, _, _, err := newTableBuilder(mockClient, tableSyncOptions{groupFilter: filter}).Grants(ctx, table, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+	})
+
+	t.Run("sandboxes are listed once per sync", func(t *testing.T) {
+		listed := 0
+		counting := *mockClient
+		counting.ListSandboxesFunc = func(ctx context.Context) ([]*client.Sandbox, *v2.RateLimitDescription, error) {
+			listed++
+			return mockClient.ListSandboxesFunc(ctx)
+		}
+		counting.GetDatabaseMetadataFunc = func(ctx context.Context, databaseID int) (*client.DatabaseMetadata, *v2.RateLimitDescription, error) {
+			return &client.DatabaseMetadata{ID: databaseID}, nil, nil
+		}
+		builder := newTableBuilder(&counting, tableSyncOptions{})
+		other := &v2.Resource{Id: &v2.ResourceId{ResourceType: TableResourceType.Id, Resource: "11"}}
+
+		grants, _, _, err := builder.Grants(ctx, table, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+		grants, _, _, err = builder.Grants(ctx, other, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		require.Equal(t, 1, listed)
+
+		// Listing tables starts a new sync.
+		_, _, _, err = builder.List(ctx, table.ParentResourceId, &pagination.Token{})
+		require.NoError(t, err)
+		_, _, _, err = builder.Grants(ctx, table, &pagination.Token{})
+		require.NoError(t, err)
+		require.Equal(t, 2, listed)
+	})
+
+	t.Run("rate limit returned", func(t *testing.T) {
+		failing := &client.MockService{
+			ListSandboxesFunc: func(ctx context.Context) ([]*client.Sandbox, *v2.RateLimitDescription, error) {
+				return nil, &v2.RateLimitDescription{Limit: 10}, fmt.Errorf("rate limit error")
+			},
+		}
+
+		_, _, ann, err := newTableBuilder(failing, tableSyncOptions{}).Grants(ctx, table, &pagination.Token{})
+		require.Error(t, err)
+		require.NotEmpty(t, ann)
+	})
+}
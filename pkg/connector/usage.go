@@ -0,0 +1,168 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// queryActivityWindow is how far back query_count_90d counts query executions.
+const queryActivityWindow = 90 * 24 * time.Hour
+
+// queryActivityPageSize is the number of users read per page of the aggregate query. It stays
+// under Metabase's default limit for aggregated results.
+const queryActivityPageSize = 1000
+
+type userQueryStats struct {
+	lastQueryAt *time.Time
+	count90d    int
+}
+
+// queryActivity enriches users with their last query execution and recent query count, read from
+// the usage analytics query log of paid plans. Stats are loaded once per sync with an aggregate
+// query, paged by user ID, and dropped when the sync finishes. Instances without the audit database are left unenriched.
+type queryActivity struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	loaded bool
+	stats  map[string]*userQueryStats
+}
+
+func newQueryActivity() *queryActivity {
+	return &queryActivity{now: time.Now}
+}
+
+func (q *queryActivity) load(ctx context.Context, c client.ClientService) (*v2.RateLimitDescription, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.loaded {
+		return nil, nil
+	}
+
+	stats, rateLimitDesc, err := q.query(ctx, c, "")
+	if err != nil {
+		return rateLimitDesc, err
+	}
+	q.loaded = true
+	q.stats = stats
+
+	return rateLimitDesc, nil
+}
+
+// forUser returns the stats of one user, always querying fresh so targeted syncs are up to date.
+func (q *queryActivity) forUser(ctx context.Context, c client.ClientService, userID string) (*userQueryStats, *v2.RateLimitDescription, error) {
+	stats, rateLimitDesc, err := q.query(ctx, c, userID)
+	if err != nil || stats == nil {
+		return nil, rateLimitDesc, err
+	}
+	if userStats, ok := stats[userID]; ok {
+		return userStats, rateLimitDesc, nil
+	}
+	return &userQueryStats{}, rateLimitDesc, nil
+}
+
+// lookup returns the stats of a user from the loaded sync-wide stats. Users without any query in
+// the log get zero stats, and nil is returned when no stats are available at all.
+func (q *queryActivity) lookup(userID int) *userQueryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stats == nil {
+		return nil
+	}
+	if stats, ok := q.stats[strconv.Itoa(userID)]; ok {
+		return stats
+	}
+	return &userQueryStats{}
+}
+
+func (q *queryActivity) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.loaded = false
+	q.stats = nil
+}
+
+// query aggregates the query log by user. It returns nil stats when the query log is not available.
+// The result is paged by user ID so no user is left out when Metabase limits the rows it returns.
+func (q *queryActivity) query(ctx context.Context, c client.ClientService, userID string) (map[string]*userQueryStats, *v2.RateLimitDescription, error) {
+	queryLog, rateLimitDesc, err := findAuditTable(ctx, c, queryLogTable)
+	if err != nil || queryLog == nil {
+		return nil, rateLimitDesc, err
+	}
+
+	var onlyUser int
+	if userID != "" {
+		onlyUser, err = strconv.Atoi(userID)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("invalid user id %q: %w", userID, err)
+		}
+	}
+
+	cutoff := q.now().UTC().Add(-queryActivityWindow).Format(time.RFC3339)
+	stats := make(map[string]*userQueryStats)
+	afterUser := 0
+	for {
+		mbql := map[string]any{
+			"source-table": queryLog.id,
+			"aggregation": [][]any{
+				{"max", queryLog.field("started_at")},
+				{"count-where", []any{">=", queryLog.field("started_at"), cutoff}},
+			},
+			"breakout": []any{queryLog.field("user_id")},
+			"order-by": [][]any{{"asc", queryLog.field("user_id")}},
+			"limit":    queryActivityPageSize,
+		}
+		switch {
+		case onlyUser != 0:
+			mbql["filter"] = []any{"=", queryLog.field("user_id"), onlyUser}
+		case afterUser != 0:
+			mbql["filter"] = []any{">", queryLog.field("user_id"), afterUser}
+		}
+
+		resp, pageRateLimit, err := c.RunQuery(ctx, &client.DatasetQuery{
+			Database: auditDatabaseID,
+			Type:     "query",
+			Query:    mbql,
+		})
+		rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, pageRateLimit)
+		if err != nil {
+			return nil, rateLimitDesc, fmt.Errorf("failed to read query log: %w", err)
+		}
+
+		lastUser := afterUser
+		for _, row := range resp.Data.Rows {
+			// Columns come back in breakout, then aggregation order.
+			if len(row) < 3 || row[0] == nil {
+				continue
+			}
+			id := anyToInt(row[0])
+			lastUser = max(lastUser, id)
+
+			userStats := &userQueryStats{count90d: anyToInt(row[2])}
+			if raw, ok := row[1].(string); ok {
+				if lastQueryAt, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+					userStats.lastQueryAt = &lastQueryAt
+				}
+			}
+			stats[strconv.Itoa(id)] = userStats
+		}
+
+		complete := len(resp.Data.Rows) < queryActivityPageSize && resp.Data.RowsTruncated == 0
+		if onlyUser != 0 || complete {
+			return stats, rateLimitDesc, nil
+		}
+		if lastUser == afterUser {
+			return nil, rateLimitDesc, fmt.Errorf("failed to read query log: paging by user made no progress after user %d", afterUser)
+		}
+		afterUser = lastUser
+	}
+}
@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsersQueryActivity(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	newMockClient := func(paid bool) (*client.MockService, *[]*client.DatasetQuery) {
+		var queries []*client.DatasetQuery
+		mockClient := &client.MockService{
+			IsPaidPlanFunc: func() bool { return paid },
+			ListUsersFunc: func(ctx context.Context, opts client.PageOptions) ([]*client.User, string, *v2.RateLimitDescription, error) {
+				return []*client.User{
+					{ID: 1, FirstName: "Ana", LastName: "Gomez"},
+					{ID: 2, FirstName: "Bob", LastName: "Smith"},
+				}, "", nil, nil
+			},
+			GetDatabaseMetadataFunc: func(ctx context.Context, databaseID int) (*client.DatabaseMetadata, *v2.RateLimitDescription, error) {
+				return &client.DatabaseMetadata{Tables: []*client.Table{{
+					ID:   7,
+					Name: "v_query_log",
+					Fields: []*client.Field{
+						{ID: 71, Name: "started_at"},
+						{ID: 72, Name: "user_id"},
+					},
+				}}}, nil, nil
+			},
+			RunQueryFunc: func(ctx context.Context, query *client.DatasetQuery) (*client.DatasetResponse, *v2.RateLimitDescription, error) {
+				queries = append(queries, query)
+				return &client.DatasetResponse{
+					Status: "completed",
+					Data: client.DatasetData{
+						Cols: []*client.DatasetColumn{{Name: "user_id"}, {Name: "max"}, {Name: "count-where"}},
+						Rows: [][]any{{float64(1), "2026-02-27T08:30:00Z", float64(12)}},
+					},
+				}, nil, nil
+			},
+		}
+		return mockClient, &queries
+	}
+
+	profileOf := func(t *testing.T, res *v2.Resource) map[string]interface{} {
+		trait, err := resourceSdk.GetUserTrait(res)
+		require.NoError(t, err)
+		return trait.GetProfile().AsMap()
+	}
+
+	t.Run("should add query activity to user profiles", func(t *testing.T) {
+		mockClient, queries := newMockClient(true)
+		activity := newQueryActivity()
+		activity.now = func() time.Time { return now }
+		builder := newUserBuilder(mockClient, userSyncOptions{queryActivity: activity})
+
+		resources, _, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, resources, 2)
+
+		ana := profileOf(t, resources[0])
+		require.Equal(t, "2026-02-27T08:30:00Z", ana["last_query_at"])
+		require.EqualValues(t, 12, ana["query_count_90d"])
+
+		bob := profileOf(t, resources[1])
+		require.NotContains(t, bob, "last_query_at")
+		require.EqualValues(t, 0, bob["query_count_90d"])
+
+		require.Len(t, *queries, 1)
+		aggregation := (*queries)[0].Query["aggregation"].([][]any)
+		require.Equal(t, []any{">=", []any{"field", 71, nil}, "2025-12-01T12:00:00Z"}, aggregation[1][1])
+
+		_, _, _, err = builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, *queries, 2, "stats are reloaded for every sync")
+	})
+
+	t.Run("should page the query log by user when Metabase truncates the result", func(t *testing.T) {
+		mockClient, queries := newMockClient(true)
+		mockClient.RunQueryFunc = func(ctx context.Context, query *client.DatasetQuery) (*client.DatasetResponse, *v2.RateLimitDescription, error) {
+			*queries = append(*queries, query)
+			data := client.DatasetData{Rows: [][]any{{float64(1), "2026-02-27T08:30:00Z", float64(12)}}, RowsTruncated: 1}
+			if len(*queries) == 2 {
+				data = client.DatasetData{Rows: [][]any{{float64(2), "2026-02-20T08:30:00Z", float64(3)}}}
+			}
+			return &client.DatasetResponse{Status: "completed", Data: data}, nil, nil
+		}
+		activity := newQueryActivity()
+		activity.now = func() time.Time { return now }
+		builder := newUserBuilder(mockClient, userSyncOptions{queryActivity: activity})
+
+		resources, _, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.EqualValues(t, 12, profileOf(t, resources[0])["query_count_90d"])
+		require.EqualValues(t, 3, profileOf(t, resources[1])["query_count_90d"])
+
+		require.Len(t, *queries, 2)
+		require.NotContains(t, (*queries)[0].Query, "filter")
+		require.Equal(t, []any{">", []any{"field", 72, nil}, 1}, (*queries)[1].Query["filter"])
+	})
+
+	t.Run("should fail rather than report zero stats when paging makes no progress", func(t *testing.T) {
+		mockClient, _ := newMockClient(true)
+		mockClient.RunQueryFunc = func(ctx context.Context, query *client.DatasetQuery) (*client.DatasetResponse, *v2.RateLimitDescription, error) {
+			return &client.DatasetResponse{Status: "completed", Data: client.DatasetData{
+				Rows:          [][]any{{float64(1), "2026-02-27T08:30:00Z", float64(12)}},
+				RowsTruncated: 1,
+			}}, nil, nil
+		}
+		builder := newUserBuilder(mockClient, userSyncOptions{queryActivity: newQueryActivity()})
+
+		_, _, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.ErrorContains(t, err, "made no progress")
+	})
+
+	t.Run("should leave profiles alone on free plans", func(t *testing.T) {
+		mockClient, queries := newMockClient(false)
+		builder := newUserBuilder(mockClient, userSyncOptions{queryActivity: newQueryActivity()})
+
+		resources, _, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.NotContains(t, profileOf(t, resources[0]), "query_count_90d")
+		require.Empty(t, *queries)
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/conductorone/baton-metabase/pkg/client"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -13,10 +16,36 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// userSyncOptions are the optional user sync behaviors enabled through configuration.
+type userSyncOptions struct {
+	// pageConcurrency is the number of extra user pages fetched in parallel per List call.
+	// Values below 2 keep the sequential one-page-per-call behavior.
+	pageConcurrency int
+	// queryActivity is nil unless query activity enrichment is enabled.
+	queryActivity *queryActivity
+	// skipAPIKeyUsers leaves the users Metabase creates for API keys out of the sync
+	// instead of syncing them as service accounts.
+	skipAPIKeyUsers bool
+	// groupFilter is nil unless groups are filtered; memberships of filtered out groups are not granted.
+	groupFilter *groupFilter
+}
+
+const (
+	apiKeyUserType        = "api-key"
+	apiKeyUserEmailDomain = "@api-key.invalid"
 )
 
 type userBuilder struct {
 	client client.ClientService
+	auth   *instanceAuth
+	// memberships is the membership map of every user, listed once per sync and shared by the
+	// Grants calls of all users.
+	memberships syncCache[map[string][]*client.Membership]
+	userSyncOptions
 }
 
 func (u *userBuilder) ResourceType(_ context.Context) *v2.ResourceType {
@@ -31,7 +60,41 @@ func (u *userBuilder) List(ctx context.Context, _ *v2.ResourceId, pToken *pagina
 
 	ann := annotations.New()
 
-	users, nextPageToken, rateLimitDesc, err := u.client.ListUsers(ctx, opts)
+	// The per-sync caches are cleared on the first page rather than after the last one, so a sync
+	// that failed part way does not leave them cached for the next one.
+	if pToken == nil || pToken.Token == "" {
+		u.memberships.reset()
+		u.auth.reset()
+		if u.queryActivity != nil {
+			u.queryActivity.reset()
+		}
+	}
+
+	rateLimitDesc, err := u.auth.load(ctx, u.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+	sso := u.auth.current()
+
+	if u.queryActivity != nil {
+		rateLimitDesc, err := u.queryActivity.load(ctx, u.client)
+		if rateLimitDesc != nil {
+			ann.WithRateLimiting(rateLimitDesc)
+		}
+		if err != nil {
+			return nil, "", ann, fmt.Errorf("failed to load query activity: %w", err)
+		}
+	}
+
+	listUsers := u.client.ListUsers
+	if u.pageConcurrency > 1 {
+		listUsers = u.listUsersConcurrently
+	}
+
+	users, nextPageToken, rateLimitDesc, err := listUsers(ctx, opts)
 	if rateLimitDesc != nil {
 		ann.WithRateLimiting(rateLimitDesc)
 	}
@@ -41,7 +104,15 @@ func (u *userBuilder) List(ctx context.Context, _ *v2.ResourceId, pToken *pagina
 
 	outResources := make([]*v2.Resource, 0, len(users))
 	for _, user := range users {
-		res, err := u.parseIntoUserResource(user)
+		if u.skipAPIKeyUsers && isAPIKeyUser(user) {
+			continue
+		}
+
+		var stats *userQueryStats
+		if u.queryActivity != nil {
+			stats = u.queryActivity.lookup(user.ID)
+		}
+		res, err := u.parseIntoUserResource(user, stats, sso)
 		if err != nil {
 			return nil, "", ann, err
 		}
@@ -51,6 +122,114 @@ func (u *userBuilder) List(ctx context.Context, _ *v2.ResourceId, pToken *pagina
 	return outResources, nextPageToken, ann, nil
 }
 
+// Get fetches a single user so the platform can refresh one account without a full sync.
+// The SDK follows up with Grants for the returned resource, which reports its group memberships
+// from a fresh listing rather than from the one an earlier sync read.
+func (u *userBuilder) Get(ctx context.Context, resourceId *v2.ResourceId, _ *v2.ResourceId) (*v2.Resource, annotations.Annotations, error) {
+	ann := annotations.New()
+	u.memberships.reset()
+
+	user, rateLimitDesc, err := u.client.GetUserByID(ctx, resourceId.Resource)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, fmt.Errorf("failed to get user %s: %w", resourceId.Resource, err)
+	}
+	if u.skipAPIKeyUsers && isAPIKeyUser(user) {
+		return nil, ann, status.Errorf(codes.NotFound, "user %s belongs to an api key and is not synced", resourceId.Resource)
+	}
+
+	var stats *userQueryStats
+	if u.queryActivity != nil {
+		var rateLimitDesc *v2.RateLimitDescription
+		stats, rateLimitDesc, err = u.queryActivity.forUser(ctx, u.client, resourceId.Resource)
+		if rateLimitDesc != nil {
+			ann.WithRateLimiting(rateLimitDesc)
+		}
+		if err != nil {
+			return nil, ann, fmt.Errorf("failed to load query activity: %w", err)
+		}
+	}
+
+	sso, rateLimitDesc, err := fetchSSOSettings(ctx, u.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, ann, err
+	}
+
+	res, err := u.parseIntoUserResource(user, stats, sso)
+	if err != nil {
+		return nil, ann, err
+	}
+
+	return res, ann, nil
+}
+
+// listUsersConcurrently fetches the page at opts and then, using the total that page reports,
+// up to pageConcurrency following pages in parallel. Pages are stitched back together in
+// offset order so users are returned in the same order as a sequential listing.
+// If Metabase reports that we are over the rate limit for a page, the pages before it are
+// returned with a token that resumes at that page, and the rate limit annotation lets the
+// SDK back off before asking for it.
+// It has the same shape as ClientService.ListUsers so List can use either.
+func (u *userBuilder) listUsersConcurrently(ctx context.Context, opts client.PageOptions) ([]*client.User, string, *v2.RateLimitDescription, error) {
+	first, rateLimitDesc, err := u.client.ListUsersPage(ctx, opts)
+	if err != nil {
+		return nil, "", rateLimitDesc, err
+	}
+
+	limit := first.Limit
+	if limit <= 0 {
+		limit = opts.Limit
+	}
+
+	var offsets []int
+	for offset := first.Offset + limit; offset < first.Total && len(offsets) < u.pageConcurrency; offset += limit {
+		offsets = append(offsets, offset)
+	}
+
+	pages := make([]*client.UsersQueryResponse, len(offsets))
+	pageErrs := make([]error, len(offsets))
+	pageRateLimits := make([]*v2.RateLimitDescription, len(offsets))
+
+	var wg sync.WaitGroup
+	for i, offset := range offsets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pages[i], pageRateLimits[i], pageErrs[i] = u.client.ListUsersPage(ctx, client.PageOptions{Limit: limit, Offset: offset})
+		}()
+	}
+	wg.Wait()
+
+	// Which pages to keep is decided only once every fetch is done, so the result does not
+	// depend on the order the requests finished in: pages are kept in offset order up to the
+	// first one that was throttled.
+	users := first.Data
+	nextToken := client.NextPageToken(first.Offset, limit, first.Total)
+	for _, pageRateLimit := range pageRateLimits {
+		rateLimitDesc = mostRestrictiveRateLimit(rateLimitDesc, pageRateLimit)
+	}
+	for i, offset := range offsets {
+		if isOverRateLimit(pageRateLimits[i]) {
+			// Resume from here on the next call.
+			nextToken = strconv.Itoa(offset)
+			break
+		}
+		if pageErrs[i] != nil {
+			return nil, "", rateLimitDesc, pageErrs[i]
+		}
+
+		users = append(users, pages[i].Data...)
+		nextToken = client.NextPageToken(offset, limit, pages[i].Total)
+	}
+
+	return users, nextToken, rateLimitDesc, nil
+}
+
 // Entitlements always returns an empty slice for users.
 func (u *userBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	return nil, "", nil, nil
@@ -60,24 +239,37 @@ func (u *userBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *paginat
 // We implement it here in users (instead of groups) to avoid inefficient lookups:
 // for each user we already have their memberships, so we can generate grants directly.
 // Placing this in groups would require iterating over all users for each group,
-// which is costly and unnecessary.
+// which is costly and unnecessary. Memberships are listed once per sync for all users.
 func (u *userBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	ann := annotations.New()
-	allMemberships, rateLimitDesc, err := u.client.ListMemberships(ctx)
+
+	allMemberships, rateLimitDesc, err := u.memberships.load(func() (map[string][]*client.Membership, *v2.RateLimitDescription, error) {
+		return u.client.ListMemberships(ctx)
+	})
 	if rateLimitDesc != nil {
 		ann.WithRateLimiting(rateLimitDesc)
 	}
 	if err != nil {
 		return nil, "", ann, fmt.Errorf("failed to list memberships: %w", err)
 	}
-
-	userMemberships, ok := allMemberships[resource.Id.Resource]
-	if !ok {
+	userMemberships := allMemberships[resource.Id.Resource]
+	if len(userMemberships) == 0 {
 		return nil, "", ann, nil
 	}
 
+	groupAllowed, rateLimitDesc, err := u.groupFilter.allowedGroups(ctx, u.client)
+	if rateLimitDesc != nil {
+		ann.WithRateLimiting(rateLimitDesc)
+	}
+	if err != nil {
+		return nil, "", ann, err
+	}
+
 	grants := make([]*v2.Grant, 0, len(userMemberships))
 	for _, membership := range userMemberships {
+		if !groupAllowed(membership.GroupID) {
+			continue
+		}
 		groupResource := &v2.Resource{
 			Id: &v2.ResourceId{
 				ResourceType: GroupResourceType.Id,
@@ -161,7 +353,7 @@ func (u *userBuilder) CreateAccount(
 		return nil, nil, ann, err
 	}
 
-	userResource, err := u.parseIntoUserResource(user)
+	userResource, err := u.parseIntoUserResource(user, nil, nil)
 	if err != nil {
 		return nil, nil, ann, err
 	}
@@ -181,10 +373,26 @@ func (u *userBuilder) CreateAccount(
 	return resp, plaintexts, ann, nil
 }
 
-func (u *userBuilder) parseIntoUserResource(user *client.User) (*v2.Resource, error) {
+// parseIntoUserResource builds the user resource. stats is nil unless query activity enrichment is enabled and available.
+// sso is nil when the instance's SSO settings are unknown, and then local password accounts are not flagged.
+func (u *userBuilder) parseIntoUserResource(user *client.User, stats *userQueryStats, sso *ssoSettings) (*v2.Resource, error) {
+	source := authSource(user)
 	profile := map[string]interface{}{
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
+		"first_name":  user.FirstName,
+		"last_name":   user.LastName,
+		"google_auth": user.GoogleAuth,
+		"ldap_auth":   user.LDAPAuth,
+		"auth_source": source,
+	}
+	if user.SSOSource != nil {
+		profile["sso_source"] = *user.SSOSource
+	}
+
+	if stats != nil {
+		profile["query_count_90d"] = stats.count90d
+		if stats.lastQueryAt != nil {
+			profile["last_query_at"] = stats.lastQueryAt.UTC().Format(time.RFC3339)
+		}
 	}
 
 	traitOptions := []resourceSdk.UserTraitOption{
@@ -197,22 +405,44 @@ func (u *userBuilder) parseIntoUserResource(user *client.User) (*v2.Resource, er
 		traitOptions = append(traitOptions, resourceSdk.WithLastLogin(*user.LastLogin))
 	}
 
+	if isAPIKeyUser(user) {
+		traitOptions = append(traitOptions, resourceSdk.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE))
+	} else {
+		traitOptions = append(traitOptions, resourceSdk.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_HUMAN))
+	}
+
 	if user.IsActive {
 		traitOptions = append(traitOptions, resourceSdk.WithStatus(v2.UserTrait_Status_STATUS_ENABLED))
 	} else {
 		traitOptions = append(traitOptions, resourceSdk.WithStatus(v2.UserTrait_Status_STATUS_DISABLED))
 	}
 
+	var resourceOptions []resourceSdk.ResourceOption
+	if source == authSourcePassword {
+		if risk := sso.localPasswordRisk(); risk != nil {
+			resourceOptions = append(resourceOptions, resourceSdk.WithAnnotation(risk))
+		}
+	}
+
 	return resourceSdk.NewUserResource(
 		fmt.Sprintf("%s %s", user.FirstName, user.LastName),
 		UserResourceType,
 		user.ID,
 		traitOptions,
+		resourceOptions...,
 	)
 }
 
-func newUserBuilder(client client.ClientService) *userBuilder {
+// isAPIKeyUser reports whether user is the internal user behind an API key. Older versions
+// don't return user_type, but always give these users an address in the api-key.invalid domain.
+func isAPIKeyUser(user *client.User) bool {
+	return user.UserType == apiKeyUserType || strings.HasSuffix(strings.ToLower(user.Email), apiKeyUserEmailDomain)
+}
+
+func newUserBuilder(client client.ClientService, opts userSyncOptions) *userBuilder {
 	return &userBuilder{
-		client: client,
+		client:          client,
+		auth:            newInstanceAuth(),
+		userSyncOptions: opts,
 	}
 }
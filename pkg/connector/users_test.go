@@ -4,21 +4,26 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/conductorone/baton-metabase/pkg/client"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-sdk/pkg/test"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func newTestUserBuilder() (*userBuilder, *client.MockService) {
 	mockClient := &client.MockService{}
-	builder := newUserBuilder(mockClient)
+	builder := newUserBuilder(mockClient, userSyncOptions{})
 	return builder, mockClient
 }
 
@@ -87,6 +92,288 @@ func TestUsersList(t *testing.T) {
 	})
 }
 
+func TestUsersListConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	usersPage := func(offset, limit, total int) *client.UsersQueryResponse {
+		page := &client.UsersQueryResponse{Limit: limit, Offset: offset, Total: total}
+		for id := offset + 1; id <= offset+limit && id <= total; id++ {
+			page.Data = append(page.Data, &client.User{ID: id, Email: fmt.Sprintf("user%d@example.com", id), FirstName: "User", LastName: fmt.Sprint(id)})
+		}
+		return page
+	}
+
+	t.Run("should fetch following pages in parallel and keep offset order", func(t *testing.T) {
+		mockClient := &client.MockService{}
+		builder := newUserBuilder(mockClient, userSyncOptions{pageConcurrency: 3})
+
+		mockClient.ListUsersPageFunc = func(ctx context.Context, opts client.PageOptions) (*client.UsersQueryResponse, *v2.RateLimitDescription, error) {
+			return usersPage(opts.Offset, opts.Limit, 10), nil, nil
+		}
+
+		resources, next, _, err := builder.List(ctx, nil, &pagination.Token{Size: 2})
+		require.NoError(t, err)
+		require.Len(t, resources, 8)
+		for i, res := range resources {
+			require.Equal(t, fmt.Sprint(i+1), res.Id.Resource)
+		}
+		require.Equal(t, "8", next)
+
+		resources, next, _, err = builder.List(ctx, nil, &pagination.Token{Size: 2, Token: next})
+		require.NoError(t, err)
+		require.Len(t, resources, 2)
+		require.Empty(t, next)
+	})
+
+	t.Run("should stop at the first throttled page and resume from it", func(t *testing.T) {
+		mockClient := &client.MockService{}
+		builder := newUserBuilder(mockClient, userSyncOptions{pageConcurrency: 3})
+
+		overLimit := &v2.RateLimitDescription{
+			Status:  v2.RateLimitDescription_STATUS_OVERLIMIT,
+			ResetAt: timestamppb.New(time.Now().Add(5 * time.Second)),
+		}
+		mockClient.ListUsersPageFunc = func(ctx context.Context, opts client.PageOptions) (*client.UsersQueryResponse, *v2.RateLimitDescription, error) {
+			if opts.Offset == 4 {
+				return nil, overLimit, fmt.Errorf("too many requests")
+			}
+			return usersPage(opts.Offset, opts.Limit, 10), nil, nil
+		}
+
+		resources, next, annotations, err := builder.List(ctx, nil, &pagination.Token{Size: 2})
+		require.NoError(t, err)
+		require.Len(t, resources, 4)
+		require.Equal(t, "4", next)
+
+		rlOut := v2.RateLimitDescription{}
+		require.Len(t, annotations, 1)
+		require.NoError(t, annotations[0].UnmarshalTo(&rlOut))
+		require.Equal(t, v2.RateLimitDescription_STATUS_OVERLIMIT, rlOut.Status)
+	})
+
+	t.Run("should ignore failures after the first throttled page", func(t *testing.T) {
+		mockClient := &client.MockService{}
+		builder := newUserBuilder(mockClient, userSyncOptions{pageConcurrency: 3})
+
+		overLimit := &v2.RateLimitDescription{
+			Status:  v2.RateLimitDescription_STATUS_OVERLIMIT,
+			ResetAt: timestamppb.New(time.Now().Add(5 * time.Second)),
+		}
+		var mu sync.Mutex
+		var offsets []int
+		mockClient.ListUsersPageFunc = func(ctx context.Context, opts client.PageOptions) (*client.UsersQueryResponse, *v2.RateLimitDescription, error) {
+			mu.Lock()
+			offsets = append(offsets, opts.Offset)
+			mu.Unlock()
+			switch opts.Offset {
+			case 2:
+				return nil, overLimit, fmt.Errorf("too many requests")
+			case 6:
+				return nil, nil, fmt.Errorf("internal server error")
+			}
+			return usersPage(opts.Offset, opts.Limit, 10), nil, nil
+		}
+
+		resources, next, _, err := builder.List(ctx, nil, &pagination.Token{Size: 2})
+		require.NoError(t, err)
+		require.Len(t, resources, 2)
+		require.Equal(t, "2", next)
+		require.ElementsMatch(t, []int{0, 2, 4, 6}, offsets)
+	})
+
+	t.Run("should return error if a page fails for another reason", func(t *testing.T) {
+		mockClient := &client.MockService{}
+		builder := newUserBuilder(mockClient, userSyncOptions{pageConcurrency: 3})
+
+		mockClient.ListUsersPageFunc = func(ctx context.Context, opts client.PageOptions) (*client.UsersQueryResponse, *v2.RateLimitDescription, error) {
+			if opts.Offset == 2 {
+				return nil, nil, fmt.Errorf("internal server error")
+			}
+			return usersPage(opts.Offset, opts.Limit, 10), nil, nil
+		}
+
+		resources, next, _, err := builder.List(ctx, nil, &pagination.Token{Size: 2})
+		require.Error(t, err)
+		require.Nil(t, resources)
+		require.Empty(t, next)
+	})
+}
+
+func TestUsersGet(t *testing.T) {
+	ctx := context.Background()
+	userID := &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: "1"}
+
+	t.Run("should return the user", func(t *testing.T) {
+		userBuilder, mockClient := newTestUserBuilder()
+		mockClient.GetUserByIDFunc = func(ctx context.Context, id string) (*client.User, *v2.RateLimitDescription, error) {
+			require.Equal(t, "1", id)
+			return &client.User{ID: 1, Email: "ana.gomez@example.com", FirstName: "Ana", LastName: "Gomez", IsActive: true}, nil, nil
+		}
+
+		res, annotations, err := userBuilder.Get(ctx, userID, nil)
+		require.NoError(t, err)
+		require.Equal(t, "Ana Gomez", res.DisplayName)
+		require.Equal(t, "1", res.Id.Resource)
+		test.AssertNoRatelimitAnnotations(t, annotations)
+	})
+
+	t.Run("should return error if the user cannot be fetched", func(t *testing.T) {
+		userBuilder, mockClient := newTestUserBuilder()
+		mockClient.GetUserByIDFunc = func(ctx context.Context, id string) (*client.User, *v2.RateLimitDescription, error) {
+			return nil, nil, fmt.Errorf("not found")
+		}
+
+		res, _, err := userBuilder.Get(ctx, userID, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get user 1")
+		require.Nil(t, res)
+	})
+}
+
+func TestUsersAPIKeyUsers(t *testing.T) {
+	ctx := context.Background()
+	person := &client.User{ID: 1, Email: "ana.gomez@example.com", FirstName: "Ana", LastName: "Gomez", UserType: "personal"}
+	keyUser := &client.User{ID: 2, Email: "api-key-user-1f2e@api-key.invalid", FirstName: "dbt exporter", UserType: "api-key"}
+	legacyKeyUser := &client.User{ID: 3, Email: "api-key-user-9a8b@api-key.invalid", FirstName: "legacy"}
+
+	newBuilder := func(skip bool) *userBuilder {
+		mockClient := &client.MockService{
+			ListUsersFunc: func(ctx context.Context, opts client.PageOptions) ([]*client.User, string, *v2.RateLimitDescription, error) {
+				return []*client.User{person, keyUser, legacyKeyUser}, "", nil, nil
+			},
+			GetUserByIDFunc: func(ctx context.Context, userID string) (*client.User, *v2.RateLimitDescription, error) {
+				return keyUser, nil, nil
+			},
+		}
+		return newUserBuilder(mockClient, userSyncOptions{skipAPIKeyUsers: skip})
+	}
+
+	accountType := func(t *testing.T, res *v2.Resource) v2.UserTrait_AccountType {
+		trait, err := resourceSdk.GetUserTrait(res)
+		require.NoError(t, err)
+		return trait.GetAccountType()
+	}
+
+	t.Run("should sync api key users as service accounts", func(t *testing.T) {
+		resources, _, _, err := newBuilder(false).List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, resources, 3)
+		require.Equal(t, v2.UserTrait_ACCOUNT_TYPE_HUMAN, accountType(t, resources[0]))
+		require.Equal(t, v2.UserTrait_ACCOUNT_TYPE_SERVICE, accountType(t, resources[1]))
+		require.Equal(t, v2.UserTrait_ACCOUNT_TYPE_SERVICE, accountType(t, resources[2]))
+	})
+
+	t.Run("should skip api key users", func(t *testing.T) {
+		resources, _, _, err := newBuilder(true).List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, resources, 1)
+		require.Equal(t, "1", resources[0].Id.Resource)
+	})
+
+	t.Run("should report skipped api key users as not found", func(t *testing.T) {
+		_, _, err := newBuilder(true).Get(ctx, &v2.ResourceId{ResourceType: UserResourceType.Id, Resource: "2"}, nil)
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestUsersAuthSource(t *testing.T) {
+	ctx := context.Background()
+	saml := "saml"
+	users := []*client.User{
+		{ID: 1, Email: "ana.gomez@example.com", FirstName: "Ana", LastName: "Gomez"},
+		{ID: 2, Email: "bob.smith@example.com", FirstName: "Bob", LastName: "Smith", SSOSource: &saml},
+		{ID: 3, Email: "carl.jones@example.com", FirstName: "Carl", LastName: "Jones", GoogleAuth: true},
+	}
+
+	newBuilder := func(settings map[string]any) *userBuilder {
+		mockClient := &client.MockService{
+			ListUsersFunc: func(ctx context.Context, opts client.PageOptions) ([]*client.User, string, *v2.RateLimitDescription, error) {
+				return users, "", nil, nil
+			},
+			GetSettingFunc: func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+				return settings[key], nil, nil
+			},
+		}
+		return newUserBuilder(mockClient, userSyncOptions{})
+	}
+
+	riskOf := func(t *testing.T, res *v2.Resource) *v2.RiskFactor {
+		risk := &v2.RiskFactor{}
+		annos := annotations.Annotations(res.Annotations)
+		ok, err := annos.Pick(risk)
+		require.NoError(t, err)
+		if !ok {
+			return nil
+		}
+		return risk
+	}
+
+	t.Run("should normalize the auth source", func(t *testing.T) {
+		resources, _, _, err := newBuilder(nil).List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+
+		var sources []interface{}
+		for _, res := range resources {
+			trait, err := resourceSdk.GetUserTrait(res)
+			require.NoError(t, err)
+			sources = append(sources, trait.GetProfile().AsMap()["auth_source"])
+			require.Nil(t, riskOf(t, res), "no SSO on the instance")
+		}
+		require.Equal(t, []interface{}{"password", "saml", "google"}, sources)
+
+		trait, err := resourceSdk.GetUserTrait(resources[1])
+		require.NoError(t, err)
+		require.Equal(t, "saml", trait.GetProfile().AsMap()["sso_source"])
+	})
+
+	t.Run("should flag local passwords when SSO is enabled", func(t *testing.T) {
+		resources, _, _, err := newBuilder(map[string]any{"saml-enabled": true}).List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+
+		risk := riskOf(t, resources[0])
+		require.NotNil(t, risk)
+		require.Equal(t, v2.RiskFactor_SEVERITY_HIGH, risk.GetSeverity())
+		require.Contains(t, risk.GetDescription(), "saml")
+		require.Nil(t, riskOf(t, resources[1]))
+		require.Nil(t, riskOf(t, resources[2]))
+	})
+
+	t.Run("should lower the severity when password login is disabled", func(t *testing.T) {
+		resources, _, _, err := newBuilder(map[string]any{"jwt-enabled": "true", "enable-password-login": false}).List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Equal(t, v2.RiskFactor_SEVERITY_LOW, riskOf(t, resources[0]).GetSeverity())
+	})
+
+	t.Run("should read the settings again after a failed sync", func(t *testing.T) {
+		reads := 0
+		mockClient := &client.MockService{
+			ListUsersFunc: func(ctx context.Context, opts client.PageOptions) ([]*client.User, string, *v2.RateLimitDescription, error) {
+				if opts.Offset > 0 {
+					return nil, "", nil, fmt.Errorf("API error")
+				}
+				return users, "3", nil, nil
+			},
+			GetSettingFunc: func(ctx context.Context, key string) (any, *v2.RateLimitDescription, error) {
+				if key == "saml-enabled" {
+					reads++
+				}
+				return nil, nil, nil
+			},
+		}
+		builder := newUserBuilder(mockClient, userSyncOptions{})
+
+		_, next, _, err := builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		_, _, _, err = builder.List(ctx, nil, &pagination.Token{Token: next})
+		require.Error(t, err)
+		require.Equal(t, 1, reads)
+
+		_, _, _, err = builder.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Equal(t, 2, reads)
+	})
+}
+
 func TestUsersGrants(t *testing.T) {
 	ctx := context.Background()
 	userResource := &v2.Resource{
@@ -0,0 +1,389 @@
+package metabasetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AuditDatabaseID is the fixed ID Metabase gives the internal audit database on paid plans.
+	AuditDatabaseID = 13371337
+
+	auditLogTableID = 1
+	queryLogTableID = 2
+)
+
+// auditTable is a view of the fake audit database. Field IDs are assigned per table
+// as tableID*100 + column index + 1 so they stay unique across tables.
+type auditTable struct {
+	id      int
+	name    string
+	columns []string
+	rows    func(s *Server) [][]any
+}
+
+var auditTables = []*auditTable{
+	{
+		id:      auditLogTableID,
+		name:    "v_audit_log",
+		columns: []string{"id", "topic", "timestamp", "user_id", "entity_type", "entity_id", "details"},
+		rows: func(s *Server) [][]any {
+			rows := make([][]any, 0, len(s.auditLog))
+			for _, entry := range s.auditLog {
+				details, _ := json.Marshal(entry.Details)
+				rows = append(rows, []any{
+					entry.ID, entry.Topic, entry.Timestamp.Format(time.RFC3339Nano), entry.UserID,
+					entry.EntityType, entry.EntityID, string(details),
+				})
+			}
+			return rows
+		},
+	},
+	{
+		id:      queryLogTableID,
+		name:    "v_query_log",
+		columns: []string{"entity_id", "started_at", "user_id", "is_native"},
+		rows: func(s *Server) [][]any {
+			rows := make([][]any, 0, len(s.queryLog))
+			for i, execution := range s.queryLog {
+				rows = append(rows, []any{i + 1, execution.StartedAt.Format(time.RFC3339Nano), execution.UserID, execution.IsNative})
+			}
+			return rows
+		},
+	},
+}
+
+// AuditEntry is a row of the v_audit_log view.
+type AuditEntry struct {
+	ID         int
+	Topic      string
+	Timestamp  time.Time
+	UserID     int
+	EntityType string
+	EntityID   int
+	Details    map[string]any
+}
+
+// QueryExecution is a row of the v_query_log view.
+type QueryExecution struct {
+	UserID    int
+	StartedAt time.Time
+	IsNative  bool
+}
+
+// AuditLog returns every audit entry recorded so far, oldest first.
+func (s *Server) AuditLog() []AuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]AuditEntry(nil), s.auditLog...)
+}
+
+// AddQueryExecution seeds the usage analytics query log.
+func (s *Server) AddQueryExecution(userID int, startedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queryLog = append(s.queryLog, QueryExecution{UserID: userID, StartedAt: startedAt.UTC()})
+}
+
+// recordAuditLocked appends to the audit log. Like Metabase, only paid plans keep one.
+func (s *Server) recordAuditLocked(topic, entityType string, entityID int, details map[string]any) {
+	if !s.PaidPlan {
+		return
+	}
+	s.auditLog = append(s.auditLog, AuditEntry{
+		ID:         len(s.auditLog) + 1,
+		Topic:      topic,
+		Timestamp:  s.now().UTC(),
+		EntityType: entityType,
+		EntityID:   entityID,
+		Details:    details,
+	})
+}
+
+func (s *Server) handleDatabaseMetadata(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userDatabaseMetadataLocked(w, r) {
+		return
+	}
+	if r.PathValue("id") != strconv.Itoa(AuditDatabaseID) || !s.PaidPlan {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+
+	tables := make([]map[string]any, 0, len(auditTables))
+	for _, table := range auditTables {
+		fields := make([]map[string]any, 0, len(table.columns))
+		for i, name := range table.columns {
+			fields = append(fields, map[string]any{"id": table.id*100 + i + 1, "name": name})
+		}
+		tables = append(tables, map[string]any{"id": table.id, "name": table.name, "schema": nil, "fields": fields})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":     AuditDatabaseID,
+		"name":   "Internal Metabase Database",
+		"tables": tables,
+	})
+}
+
+// handleDataset evaluates the small MBQL subset the connector uses against the audit views:
+// a source table, a single comparison filter, ascending or descending order-by, a limit, and
+// max/count/count-where aggregations with a single breakout.
+func (s *Server) handleDataset(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Database int `json:"database"`
+		Query    struct {
+			SourceTable int     `json:"source-table"`
+			Filter      []any   `json:"filter"`
+			OrderBy     [][]any `json:"order-by"`
+			Limit       int     `json:"limit"`
+			Aggregation [][]any `json:"aggregation"`
+			Breakout    []any   `json:"breakout"`
+		} `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queryFailed := func(message string) {
+		writeJSON(w, http.StatusAccepted, map[string]any{"status": "failed", "error": message})
+	}
+
+	var table *auditTable
+	for _, t := range auditTables {
+		if t.id == body.Query.SourceTable {
+			table = t
+		}
+	}
+	if body.Database != AuditDatabaseID || table == nil || !s.PaidPlan {
+		queryFailed("Table not found.")
+		return
+	}
+
+	rows := table.rows(s)
+	columns := table.columns
+
+	if len(body.Query.Filter) > 0 {
+		filtered := rows[:0]
+		for _, row := range rows {
+			ok, err := matchFilter(table, row, body.Query.Filter)
+			if err != nil {
+				queryFailed(err.Error())
+				return
+			}
+			if ok {
+				filtered = append(filtered, row)
+			}
+		}
+		rows = filtered
+	}
+
+	if len(body.Query.Aggregation) > 0 {
+		var err error
+		columns, rows, err = aggregate(table, rows, body.Query.Aggregation, body.Query.Breakout)
+		if err != nil {
+			queryFailed(err.Error())
+			return
+		}
+	}
+
+	for _, clause := range body.Query.OrderBy {
+		if len(clause) != 2 {
+			continue
+		}
+		col, err := table.column(clause[1])
+		if err != nil {
+			continue
+		}
+		if len(body.Query.Aggregation) > 0 {
+			// Aggregated rows only hold the breakout column, first.
+			if breakout, err := table.column(body.Query.Breakout[0]); err != nil || breakout != col {
+				continue
+			}
+			col = 0
+		}
+		desc := clause[0] == "desc"
+		sort.SliceStable(rows, func(i, j int) bool {
+			if desc {
+				return compareCell(rows[i][col], rows[j][col]) > 0
+			}
+			return compareCell(rows[i][col], rows[j][col]) < 0
+		})
+	}
+
+	if body.Query.Limit > 0 && len(rows) > body.Query.Limit {
+		rows = rows[:body.Query.Limit]
+	}
+
+	cols := make([]map[string]any, 0, len(columns))
+	for _, name := range columns {
+		cols = append(cols, map[string]any{"name": name})
+	}
+	data := map[string]any{"cols": cols, "rows": rows}
+	if s.DatasetRowLimit > 0 && len(rows) > s.DatasetRowLimit {
+		data["rows"] = rows[:s.DatasetRowLimit]
+		data["rows_truncated"] = s.DatasetRowLimit
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"status": "completed",
+		"data":   data,
+	})
+}
+
+// column resolves an MBQL ["field", id, options] reference to a column index of the table.
+func (t *auditTable) column(ref any) (int, error) {
+	parts, ok := ref.([]any)
+	if !ok || len(parts) < 2 || parts[0] != "field" {
+		return 0, fmt.Errorf("unsupported field reference: %v", ref)
+	}
+	id, ok := parts[1].(float64)
+	idx := int(id) - t.id*100 - 1
+	if !ok || idx < 0 || idx >= len(t.columns) {
+		return 0, fmt.Errorf("unknown field: %v", parts[1])
+	}
+	return idx, nil
+}
+
+func matchFilter(table *auditTable, row []any, filter []any) (bool, error) {
+	if len(filter) != 3 {
+		return false, fmt.Errorf("unsupported filter: %v", filter)
+	}
+	col, err := table.column(filter[1])
+	if err != nil {
+		return false, err
+	}
+	cmp := compareCell(row[col], filter[2])
+	switch filter[0] {
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "=":
+		return cmp == 0, nil
+	default:
+		return false, fmt.Errorf("unsupported filter operator: %v", filter[0])
+	}
+}
+
+// aggregate groups rows by a single breakout field. The result columns are the breakout
+// column followed by one column per aggregation, named like Metabase names them.
+func aggregate(table *auditTable, rows [][]any, aggregations [][]any, breakout []any) ([]string, [][]any, error) {
+	if len(breakout) != 1 {
+		return nil, nil, fmt.Errorf("exactly one breakout is supported")
+	}
+	keyCol, err := table.column(breakout[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := []string{table.columns[keyCol]}
+	var keys []any
+	groups := make(map[string][][]any)
+	for _, row := range rows {
+		key := fmt.Sprint(row[keyCol])
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, row[keyCol])
+		}
+		groups[key] = append(groups[key], row)
+	}
+
+	out := make([][]any, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, []any{key})
+	}
+
+	for _, agg := range aggregations {
+		if len(agg) == 0 {
+			return nil, nil, fmt.Errorf("empty aggregation")
+		}
+		switch agg[0] {
+		case "count":
+			columns = append(columns, "count")
+			for i, key := range keys {
+				out[i] = append(out[i], len(groups[fmt.Sprint(key)]))
+			}
+		case "count-where":
+			if len(agg) != 2 {
+				return nil, nil, fmt.Errorf("count-where needs a condition")
+			}
+			condition, _ := agg[1].([]any)
+			columns = append(columns, "count-where")
+			for i, key := range keys {
+				var n int
+				for _, row := range groups[fmt.Sprint(key)] {
+					ok, err := matchFilter(table, row, condition)
+					if err != nil {
+						return nil, nil, err
+					}
+					if ok {
+						n++
+					}
+				}
+				out[i] = append(out[i], n)
+			}
+		case "max":
+			if len(agg) != 2 {
+				return nil, nil, fmt.Errorf("max needs a field")
+			}
+			col, err := table.column(agg[1])
+			if err != nil {
+				return nil, nil, err
+			}
+			columns = append(columns, "max")
+			for i, key := range keys {
+				var max any
+				for _, row := range groups[fmt.Sprint(key)] {
+					if max == nil || compareCell(row[col], max) > 0 {
+						max = row[col]
+					}
+				}
+				out[i] = append(out[i], max)
+			}
+		default:
+			return nil, nil, fmt.Errorf("unsupported aggregation: %v", agg[0])
+		}
+	}
+
+	return columns, out, nil
+}
+
+func compareCell(a, b any) int {
+	switch av := a.(type) {
+	case int:
+		var bv float64
+		switch v := b.(type) {
+		case int:
+			bv = float64(v)
+		case float64:
+			bv = v
+		}
+		switch {
+		case float64(av) < bv:
+			return -1
+		case float64(av) > bv:
+			return 1
+		}
+		return 0
+	case string:
+		bs := fmt.Sprint(b)
+		at, aErr := time.Parse(time.RFC3339Nano, av)
+		bt, bErr := time.Parse(time.RFC3339Nano, bs)
+		if aErr == nil && bErr == nil {
+			return at.Compare(bt)
+		}
+		return strings.Compare(av, bs)
+	}
+	return 0
+}
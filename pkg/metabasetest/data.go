@@ -0,0 +1,300 @@
+package metabasetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Database is a user database as returned by /api/database.
+type Database struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Engine string `json:"engine"`
+}
+
+// Table is a table of a user database, served by /api/database/{id}/metadata.
+type Table struct {
+	ID          int      `json:"id"`
+	DBID        int      `json:"db_id"`
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Schema      string   `json:"schema"`
+	Fields      []*Field `json:"fields"`
+}
+
+// Field is a column of a Table.
+type Field struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Sandbox is a group table access policy (GTAP) as returned by /api/mt/gtap.
+type Sandbox struct {
+	ID                  int            `json:"id"`
+	GroupID             int            `json:"group_id"`
+	TableID             int            `json:"table_id"`
+	CardID              *int           `json:"card_id"`
+	AttributeRemappings map[string]any `json:"attribute_remappings"`
+}
+
+// Impersonation is a connection impersonation policy as returned by
+// /api/ee/advanced-permissions/impersonation.
+type Impersonation struct {
+	ID        int    `json:"id"`
+	GroupID   int    `json:"group_id"`
+	DBID      int    `json:"db_id"`
+	Attribute string `json:"attribute"`
+}
+
+// AddDatabase seeds a user database.
+func (s *Server) AddDatabase(id int, name, engine string) *Database {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := &Database{ID: id, Name: name, Engine: engine}
+	s.databases[id] = db
+	return db
+}
+
+// AddTable seeds a table in a database seeded with AddDatabase. Field IDs are assigned
+// as id*100 + column index + 1.
+func (s *Server) AddTable(dbID, id int, schema, name string, columns ...string) *Table {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &Table{ID: id, DBID: dbID, Name: name, DisplayName: name, Schema: schema, Fields: make([]*Field, 0, len(columns))}
+	for i, column := range columns {
+		t.Fields = append(t.Fields, &Field{ID: id*100 + i + 1, Name: column})
+	}
+	s.tables[id] = t
+	return t
+}
+
+// AddSandbox seeds a sandbox of tableID for groupID. cardID is nil for sandboxes that only filter
+// the table by user attributes.
+func (s *Server) AddSandbox(groupID, tableID int, cardID *int, remappings map[string]any) *Sandbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sb := &Sandbox{ID: s.nextSandboxID, GroupID: groupID, TableID: tableID, CardID: cardID, AttributeRemappings: remappings}
+	s.nextSandboxID++
+	s.sandboxes[sb.ID] = sb
+	return sb
+}
+
+// AddImpersonation seeds an impersonation policy of dbID for groupID, keyed by the user attribute
+// that names the database role.
+func (s *Server) AddImpersonation(groupID, dbID int, attribute string) *Impersonation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	imp := &Impersonation{ID: len(s.impersonations) + 1, GroupID: groupID, DBID: dbID, Attribute: attribute}
+	s.impersonations[imp.ID] = imp
+	return imp
+}
+
+// SetApplicationPermission sets a group's application permission ("setting", "monitoring" or
+// "subscription") to "yes" or "no".
+func (s *Server) SetApplicationPermission(groupID int, permission, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strconv.Itoa(groupID)
+	if s.applicationGraph.Groups[key] == nil {
+		s.applicationGraph.Groups[key] = make(map[string]any)
+	}
+	s.applicationGraph.Groups[key][permission] = value
+	s.applicationGraph.Revision++
+}
+
+// ApplicationPermissions returns a copy of a group's entry in the application permissions graph.
+func (s *Server) ApplicationPermissions(groupID int) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]any)
+	for permission, value := range s.applicationGraph.Groups[strconv.Itoa(groupID)] {
+		out[permission] = value
+	}
+	return out
+}
+
+// Sandboxes returns a snapshot of all sandboxes ordered by ID.
+func (s *Server) Sandboxes() []Sandbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Sandbox, 0, len(s.sandboxes))
+	for _, id := range sortedKeys(s.sandboxes) {
+		out = append(out, *s.sandboxes[id])
+	}
+	return out
+}
+
+// PermissionsGraph returns a copy of a group's entry in the data permissions graph.
+func (s *Server) PermissionsGraph(groupID int) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, _ := json.Marshal(s.permissionsGraph.Groups[strconv.Itoa(groupID)])
+	var perms map[string]any
+	_ = json.Unmarshal(raw, &perms)
+	return perms
+}
+
+func (s *Server) handleListDatabases(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Database, 0, len(s.databases))
+	for _, id := range sortedKeys(s.databases) {
+		out = append(out, s.databases[id])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "total": len(out)})
+}
+
+// userDatabaseMetadataLocked serves the metadata of a seeded user database.
+func (s *Server) userDatabaseMetadataLocked(w http.ResponseWriter, r *http.Request) bool {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return false
+	}
+	db, ok := s.databases[id]
+	if !ok {
+		return false
+	}
+
+	tables := make([]*Table, 0)
+	for _, tableID := range sortedKeys(s.tables) {
+		if t := s.tables[tableID]; t.DBID == id {
+			tables = append(tables, t)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":     db.ID,
+		"name":   db.Name,
+		"engine": db.Engine,
+		"tables": tables,
+	})
+	return true
+}
+
+func (s *Server) handleTableQueryMetadata(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	t, ok := s.tables[id]
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleListSandboxes serves /api/mt/gtap, which only exists on paid plans.
+func (s *Server) handleListSandboxes(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.PaidPlan {
+		writeText(w, http.StatusNotFound, "API endpoint does not exist.")
+		return
+	}
+
+	out := make([]*Sandbox, 0, len(s.sandboxes))
+	for _, id := range sortedKeys(s.sandboxes) {
+		out = append(out, s.sandboxes[id])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleCreateSandbox creates a sandbox. Like Metabase, a group can only have one sandbox per table.
+func (s *Server) handleCreateSandbox(w http.ResponseWriter, r *http.Request) {
+	var body Sandbox
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.PaidPlan {
+		writeText(w, http.StatusNotFound, "API endpoint does not exist.")
+		return
+	}
+	if _, ok := s.groups[body.GroupID]; !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if _, ok := s.tables[body.TableID]; !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	for _, sb := range s.sandboxes {
+		if sb.GroupID == body.GroupID && sb.TableID == body.TableID {
+			writeMessage(w, http.StatusBadRequest, "A sandbox already exists for this group and table.")
+			return
+		}
+	}
+
+	sb := &Sandbox{ID: s.nextSandboxID, GroupID: body.GroupID, TableID: body.TableID, CardID: body.CardID, AttributeRemappings: body.AttributeRemappings}
+	s.nextSandboxID++
+	s.sandboxes[sb.ID] = sb
+	writeJSON(w, http.StatusOK, sb)
+}
+
+func (s *Server) handleDeleteSandbox(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !s.PaidPlan {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if _, ok := s.sandboxes[id]; !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	delete(s.sandboxes, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListImpersonations serves /api/ee/advanced-permissions/impersonation, which only exists on paid plans.
+func (s *Server) handleListImpersonations(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.PaidPlan {
+		writeText(w, http.StatusNotFound, "API endpoint does not exist.")
+		return
+	}
+
+	out := make([]*Impersonation, 0, len(s.impersonations))
+	for _, id := range sortedKeys(s.impersonations) {
+		out = append(out, s.impersonations[id])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// paidOnly answers 404 like Metabase does for enterprise endpoints when the instance is not on a paid plan.
+func (s *Server) paidOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		paid := s.PaidPlan
+		s.mu.Unlock()
+
+		if !paid {
+			writeText(w, http.StatusNotFound, "API endpoint does not exist.")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,1118 @@
+// Package metabasetest provides an in-memory fake of the Metabase HTTP API
+// so the real MetabaseClient can be exercised end to end in tests.
+package metabasetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAPIKey is the API key accepted by a Server unless overridden.
+	DefaultAPIKey = "mb_test_api_key"
+
+	// AllUsersGroupID and AdministratorsGroupID are the built-in groups every Metabase instance has.
+	AllUsersGroupID       = 1
+	AdministratorsGroupID = 2
+
+	headerAPIKey = "X-API-KEY"
+
+	msgNotFound           = "Not found."
+	msgUnauthenticated    = "Unauthenticated"
+	msgPermissionsChanged = "Looks like someone else edited the permissions and your data is out of date. Please fetch new data and try again."
+)
+
+// User is the fake's representation of a Metabase user, serialized the way /api/user returns it.
+type User struct {
+	ID          int        `json:"id"`
+	Email       string     `json:"email"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	CommonName  string     `json:"common_name"`
+	UserType    string     `json:"user_type"`
+	SSOSource   *string    `json:"sso_source"`
+	GoogleAuth  bool       `json:"google_auth"`
+	LDAPAuth    bool       `json:"ldap_auth"`
+	IsActive    bool       `json:"is_active"`
+	IsSuperuser bool       `json:"is_superuser"`
+	LastLogin   *time.Time `json:"last_login"`
+	DateJoined  time.Time  `json:"date_joined"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Group is the fake's representation of a permissions group.
+// Members is only filled in by GET /api/permissions/group/{id}.
+type Group struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	MemberCount int           `json:"member_count"`
+	Members     []*Membership `json:"members,omitempty"`
+}
+
+// Membership links a user to a group.
+type Membership struct {
+	MembershipID   int  `json:"membership_id"`
+	GroupID        int  `json:"group_id"`
+	UserID         int  `json:"user_id"`
+	IsGroupManager bool `json:"is_group_manager"`
+}
+
+// APIKey is the fake's representation of an API key, serialized the way /api/api-key returns it.
+// Key holds the unmasked value and is never sent by the list endpoint.
+type APIKey struct {
+	ID        int          `json:"id"`
+	Name      string       `json:"name"`
+	MaskedKey string       `json:"masked_key"`
+	Group     APIKeyGroup  `json:"group"`
+	CreatorID int          `json:"creator_id"`
+	UpdatedBy *APIKeyActor `json:"updated_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Key       string       `json:"-"`
+	UserID    int          `json:"-"`
+}
+
+type APIKeyGroup struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type APIKeyActor struct {
+	ID         int    `json:"id"`
+	CommonName string `json:"common_name"`
+}
+
+// Collection is a Metabase collection as returned by /api/collection.
+type Collection struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Archived bool   `json:"archived"`
+}
+
+// Graph is the revisioned permissions graph shape shared by the data and collection graphs.
+// Group IDs map to an opaque per-group permission document.
+type Graph struct {
+	Revision int                       `json:"revision"`
+	Groups   map[string]map[string]any `json:"groups"`
+}
+
+// Server is an httptest-backed fake Metabase instance. All state lives in memory
+// and is safe for concurrent use by the handlers and the seeding helpers.
+type Server struct {
+	*httptest.Server
+
+	APIKey   string
+	PaidPlan bool
+	// GroupPagingUnsupported makes GET /api/permissions/group ignore limit and offset,
+	// like Metabase versions that return every group at once.
+	GroupPagingUnsupported bool
+	// DatasetRowLimit caps the rows POST /api/dataset returns, like Metabase's result row limits,
+	// and reports rows_truncated when a result was cut. 0 means no limit.
+	DatasetRowLimit int
+
+	mu               sync.Mutex
+	now              func() time.Time
+	nextUserID       int
+	nextGroupID      int
+	nextMembershipID int
+	nextAPIKeyID     int
+	users            map[int]*User
+	groups           map[int]*Group
+	memberships      map[int]*Membership
+	apiKeys          map[int]*APIKey
+	settings         map[string]any
+	collections      map[int]*Collection
+	databases        map[int]*Database
+	tables           map[int]*Table
+	sandboxes        map[int]*Sandbox
+	nextSandboxID    int
+	impersonations   map[int]*Impersonation
+	permissionsGraph *Graph
+	collectionGraph  *Graph
+	applicationGraph *Graph
+	auditLog         []AuditEntry
+	queryLog         []QueryExecution
+	requests         []string
+}
+
+// NewServer starts a fake Metabase with the built-in All Users and Administrators groups.
+// Callers must Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		APIKey:           DefaultAPIKey,
+		now:              time.Now,
+		nextUserID:       1,
+		nextGroupID:      AdministratorsGroupID + 1,
+		nextMembershipID: 1,
+		nextAPIKeyID:     1,
+		users:            make(map[int]*User),
+		groups:           make(map[int]*Group),
+		memberships:      make(map[int]*Membership),
+		apiKeys:          make(map[int]*APIKey),
+		settings:         make(map[string]any),
+		collections:      make(map[int]*Collection),
+		databases:        make(map[int]*Database),
+		tables:           make(map[int]*Table),
+		sandboxes:        make(map[int]*Sandbox),
+		nextSandboxID:    1,
+		impersonations:   make(map[int]*Impersonation),
+		permissionsGraph: &Graph{Revision: 1, Groups: make(map[string]map[string]any)},
+		collectionGraph:  &Graph{Revision: 1, Groups: make(map[string]map[string]any)},
+		applicationGraph: &Graph{Revision: 1, Groups: make(map[string]map[string]any)},
+	}
+	s.groups[AllUsersGroupID] = &Group{ID: AllUsersGroupID, Name: "All Users"}
+	s.groups[AdministratorsGroupID] = &Group{ID: AdministratorsGroupID, Name: "Administrators"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/user", s.handleListUsers)
+	mux.HandleFunc("POST /api/user", s.handleCreateUser)
+	mux.HandleFunc("GET /api/user/{id}", s.handleGetUser)
+	mux.HandleFunc("DELETE /api/user/{id}", s.handleDeactivateUser)
+	mux.HandleFunc("PUT /api/user/{id}/reactivate", s.handleReactivateUser)
+	mux.HandleFunc("GET /api/permissions/group", s.handleListGroups)
+	mux.HandleFunc("POST /api/permissions/group", s.handleCreateGroup)
+	mux.HandleFunc("GET /api/permissions/group/{id}", s.handleGetGroup)
+	mux.HandleFunc("PUT /api/permissions/group/{id}", s.handleUpdateGroup)
+	mux.HandleFunc("DELETE /api/permissions/group/{id}", s.handleDeleteGroup)
+	mux.HandleFunc("GET /api/permissions/membership", s.handleListMemberships)
+	mux.HandleFunc("POST /api/permissions/membership", s.handleAddMembership)
+	mux.HandleFunc("DELETE /api/permissions/membership/{id}", s.handleRemoveMembership)
+	mux.HandleFunc("PUT /api/permissions/membership/{id}", s.handleUpdateMembership)
+	mux.HandleFunc("GET /api/permissions/graph", s.handleGetGraph(func() *Graph { return s.permissionsGraph }))
+	mux.HandleFunc("PUT /api/permissions/graph", s.handlePutGraph(func() *Graph { return s.permissionsGraph }, "permissions-graph-update"))
+	mux.HandleFunc("GET /api/collection", s.handleListCollections)
+	mux.HandleFunc("GET /api/collection/graph", s.handleGetGraph(func() *Graph { return s.collectionGraph }))
+	mux.HandleFunc("PUT /api/collection/graph", s.handlePutGraph(func() *Graph { return s.collectionGraph }, ""))
+	mux.HandleFunc("GET /api/database", s.handleListDatabases)
+	mux.HandleFunc("GET /api/database/{id}/metadata", s.handleDatabaseMetadata)
+	mux.HandleFunc("GET /api/table/{id}/query_metadata", s.handleTableQueryMetadata)
+	mux.HandleFunc("GET /api/mt/gtap", s.handleListSandboxes)
+	mux.HandleFunc("POST /api/mt/gtap", s.handleCreateSandbox)
+	mux.HandleFunc("DELETE /api/mt/gtap/{id}", s.handleDeleteSandbox)
+	mux.HandleFunc("GET /api/ee/advanced-permissions/impersonation", s.handleListImpersonations)
+	mux.HandleFunc("GET /api/ee/advanced-permissions/application/graph", s.paidOnly(s.handleGetGraph(func() *Graph { return s.applicationGraph })))
+	mux.HandleFunc("PUT /api/ee/advanced-permissions/application/graph", s.paidOnly(s.handlePutGraph(func() *Graph { return s.applicationGraph }, "")))
+	mux.HandleFunc("POST /api/dataset", s.handleDataset)
+	mux.HandleFunc("GET /api/setting/{key}", s.handleGetSetting)
+	mux.HandleFunc("PUT /api/setting/{key}", s.handlePutSetting)
+	mux.HandleFunc("GET /api/api-key", s.handleListAPIKeys)
+	mux.HandleFunc("POST /api/api-key", s.handleCreateAPIKey)
+	mux.HandleFunc("PUT /api/api-key/{id}/regenerate", s.handleRegenerateAPIKey)
+	mux.HandleFunc("DELETE /api/api-key/{id}", s.handleDeleteAPIKey)
+
+	s.Server = httptest.NewServer(s.authenticate(mux))
+	return s
+}
+
+// AddUser seeds an active user and places them in All Users, like Metabase does on creation.
+func (s *Server) AddUser(email, firstName, lastName string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addUserLocked(email, firstName, lastName)
+}
+
+// AddGroup seeds a custom group.
+func (s *Server) AddGroup(name string) *Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := &Group{ID: s.nextGroupID, Name: name}
+	s.nextGroupID++
+	s.groups[g.ID] = g
+	return g
+}
+
+// AddMembership seeds a membership of userID in groupID.
+func (s *Server) AddMembership(userID, groupID int, isManager bool) *Membership {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addMembershipLocked(userID, groupID, isManager)
+}
+
+// AddAPIKey seeds an API key in groupID, created by the user with creatorID.
+func (s *Server) AddAPIKey(name string, groupID, creatorID int) *APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addAPIKeyLocked(name, groupID, creatorID)
+}
+
+// APIKeys returns a snapshot of all API keys ordered by ID, including their unmasked keys.
+func (s *Server) APIKeys() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]APIKey, 0, len(s.apiKeys))
+	for _, id := range sortedKeys(s.apiKeys) {
+		out = append(out, *s.apiKeys[id])
+	}
+	return out
+}
+
+// AddCollection seeds a collection under the root collection.
+func (s *Server) AddCollection(id int, name string) *Collection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := &Collection{ID: id, Name: name, Location: "/"}
+	s.collections[id] = c
+	return c
+}
+
+// SetUserActive flips a user's active flag without going through the API.
+func (s *Server) SetUserActive(userID int, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userID]; ok {
+		u.IsActive = active
+		u.UpdatedAt = s.now().UTC()
+	}
+}
+
+// SetUserSSOSource marks a user as created by an SSO method, e.g. "saml".
+func (s *Server) SetUserSSOSource(userID int, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userID]; ok {
+		u.SSOSource = &source
+		u.GoogleAuth = source == "google"
+		u.LDAPAuth = source == "ldap"
+	}
+}
+
+// SetSetting sets an admin setting such as "saml-enabled". Unset settings are served as null.
+func (s *Server) SetSetting(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings[key] = value
+}
+
+// Setting returns the current value of an admin setting, as decoded from JSON when set through the API.
+func (s *Server) Setting(key string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.settings[key]
+}
+
+// SetPermissionsGraph replaces the data permissions graph for a group.
+func (s *Server) SetPermissionsGraph(groupID int, perms map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.permissionsGraph.Groups[strconv.Itoa(groupID)] = perms
+	s.permissionsGraph.Revision++
+}
+
+// SetCollectionPermission sets a group's access level ("read", "write" or "none") on a collection.
+// Use "root" as the collection ID for the root collection.
+func (s *Server) SetCollectionPermission(groupID int, collectionID string, level string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strconv.Itoa(groupID)
+	if s.collectionGraph.Groups[key] == nil {
+		s.collectionGraph.Groups[key] = make(map[string]any)
+	}
+	s.collectionGraph.Groups[key][collectionID] = level
+	s.collectionGraph.Revision++
+}
+
+// Users returns a snapshot of all users ordered by ID.
+func (s *Server) Users() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]User, 0, len(s.users))
+	for _, id := range sortedKeys(s.users) {
+		out = append(out, *s.users[id])
+	}
+	return out
+}
+
+// Groups returns a snapshot of all groups ordered by ID.
+func (s *Server) Groups() []Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Group, 0, len(s.groups))
+	for _, id := range sortedKeys(s.groups) {
+		out = append(out, *s.groups[id])
+	}
+	return out
+}
+
+// Memberships returns a snapshot of all memberships ordered by membership ID.
+func (s *Server) Memberships() []Membership {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Membership, 0, len(s.memberships))
+	for _, id := range sortedKeys(s.memberships) {
+		out = append(out, *s.memberships[id])
+	}
+	return out
+}
+
+// Requests returns the "METHOD /path" of every authenticated request served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headerAPIKey) != s.APIKey {
+			writeText(w, http.StatusUnauthorized, msgUnauthenticated)
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	includeInactive := r.URL.Query().Get("status") == "all"
+	all := make([]*User, 0, len(s.users))
+	for _, id := range sortedKeys(s.users) {
+		u := s.users[id]
+		if !includeInactive && !u.IsActive {
+			continue
+		}
+		all = append(all, u)
+	}
+
+	limit, offset, paged, err := pageParams(r)
+	if err != nil {
+		writeMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data := all
+	if paged {
+		data = paginate(all, limit, offset)
+	}
+
+	resp := map[string]any{
+		"data":   data,
+		"total":  len(all),
+		"limit":  nil,
+		"offset": nil,
+	}
+	if paged {
+		resp["limit"] = limit
+		resp["offset"] = offset
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.lookupUser(r)
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email     string `json:"email"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Password  string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if body.Email == "" || !strings.Contains(body.Email, "@") {
+		writeFieldErrors(w, map[string]string{"email": "value must be a valid email address."})
+		return
+	}
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, body.Email) {
+			writeFieldErrors(w, map[string]string{"email": "Email address already in use."})
+			return
+		}
+	}
+
+	u := s.addUserLocked(body.Email, body.FirstName, body.LastName)
+	s.recordAuditLocked("user-invited", "User", u.ID, map[string]any{"email": u.Email})
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) handleDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.lookupUser(r)
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	u.IsActive = false
+	u.UpdatedAt = s.now().UTC()
+	s.recordAuditLocked("user-deactivated", "User", u.ID, nil)
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (s *Server) handleReactivateUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.lookupUser(r)
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if u.IsActive {
+		writeMessage(w, http.StatusBadRequest, "Not able to reactivate an active user")
+		return
+	}
+	u.IsActive = true
+	u.UpdatedAt = s.now().UTC()
+	s.recordAuditLocked("user-reactivated", "User", u.ID, nil)
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit, offset, paged, err := pageParams(r)
+	if err != nil {
+		writeMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	counts := make(map[int]int)
+	for _, m := range s.memberships {
+		counts[m.GroupID]++
+	}
+
+	out := make([]Group, 0, len(s.groups))
+	for _, id := range sortedKeys(s.groups) {
+		g := *s.groups[id]
+		g.MemberCount = counts[id]
+		out = append(out, g)
+	}
+	if paged && !s.GroupPagingUnsupported {
+		out = paginate(out, limit, offset)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	group, ok := s.groups[id]
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+
+	g := *group
+	g.Members = make([]*Membership, 0)
+	for _, mID := range sortedKeys(s.memberships) {
+		if m := s.memberships[mID]; m.GroupID == id {
+			g.Members = append(g.Members, m)
+		}
+	}
+	g.MemberCount = len(g.Members)
+	writeJSON(w, http.StatusOK, g)
+}
+
+func (s *Server) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg, ok := s.validateGroupNameLocked(body.Name, 0); !ok {
+		writeFieldErrors(w, map[string]string{"name": msg})
+		return
+	}
+
+	g := &Group{ID: s.nextGroupID, Name: body.Name}
+	s.nextGroupID++
+	s.groups[g.ID] = g
+	writeJSON(w, http.StatusOK, g)
+}
+
+// handleUpdateGroup renames a group. Like Metabase, the built-in groups cannot be renamed.
+func (s *Server) handleUpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.lookupGroupLocked(r)
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if group.ID == AllUsersGroupID || group.ID == AdministratorsGroupID {
+		writeMessage(w, http.StatusBadRequest, "You cannot edit or delete the built-in groups.")
+		return
+	}
+	if msg, ok := s.validateGroupNameLocked(body.Name, group.ID); !ok {
+		writeFieldErrors(w, map[string]string{"name": msg})
+		return
+	}
+
+	group.Name = body.Name
+	g := *group
+	g.MemberCount = s.countMembersLocked(group.ID)
+	writeJSON(w, http.StatusOK, g)
+}
+
+// handleDeleteGroup deletes a group along with its memberships and its entries in both permission graphs.
+func (s *Server) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.lookupGroupLocked(r)
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if group.ID == AllUsersGroupID || group.ID == AdministratorsGroupID {
+		writeMessage(w, http.StatusBadRequest, "You cannot edit or delete the built-in groups.")
+		return
+	}
+
+	delete(s.groups, group.ID)
+	for id, m := range s.memberships {
+		if m.GroupID == group.ID {
+			delete(s.memberships, id)
+		}
+	}
+	key := strconv.Itoa(group.ID)
+	delete(s.permissionsGraph.Groups, key)
+	delete(s.collectionGraph.Groups, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetSetting(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, s.settings[r.PathValue("key")])
+}
+
+func (s *Server) handlePutSetting(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Value any `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings[r.PathValue("key")] = body.Value
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*APIKey, 0, len(s.apiKeys))
+	for _, id := range sortedKeys(s.apiKeys) {
+		out = append(out, s.apiKeys[id])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name    string `json:"name"`
+		GroupID int    `json:"group_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.TrimSpace(body.Name) == "" {
+		writeFieldErrors(w, map[string]string{"name": "value must be a non-blank string."})
+		return
+	}
+	if _, ok := s.groups[body.GroupID]; !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	for _, k := range s.apiKeys {
+		if k.Name == body.Name {
+			writeMessage(w, http.StatusBadRequest, "An API key with this name already exists.")
+			return
+		}
+	}
+
+	k := s.addAPIKeyLocked(body.Name, body.GroupID, 0)
+	writeJSON(w, http.StatusOK, unmaskedAPIKey{APIKey: k, UnmaskedKey: k.Key})
+}
+
+func (s *Server) handleRegenerateAPIKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.lookupAPIKey(r)
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	s.setAPIKeySecretLocked(k)
+	k.UpdatedAt = s.now().UTC()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":           k.ID,
+		"unmasked_key": k.Key,
+		"masked_key":   k.MaskedKey,
+		"prefix":       k.Key[:7],
+	})
+}
+
+func (s *Server) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.lookupAPIKey(r)
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	delete(s.apiKeys, k.ID)
+	if u, ok := s.users[k.UserID]; ok {
+		u.IsActive = false
+		u.UpdatedAt = s.now().UTC()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListMemberships(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string][]*Membership)
+	for _, id := range sortedKeys(s.memberships) {
+		m := s.memberships[id]
+		key := strconv.Itoa(m.UserID)
+		out[key] = append(out[key], m)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleAddMembership(w http.ResponseWriter, r *http.Request) {
+	var body Membership
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if body.IsGroupManager && !s.PaidPlan {
+		writeMessage(w, http.StatusPaymentRequired, "Group Manager is a paid feature not currently available to your instance.")
+		return
+	}
+	if _, ok := s.users[body.UserID]; !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if _, ok := s.groups[body.GroupID]; !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if body.GroupID == AllUsersGroupID {
+		writeMessage(w, http.StatusBadRequest, "You cannot add or remove users to/from the 'All Users' group.")
+		return
+	}
+	for _, m := range s.memberships {
+		if m.UserID == body.UserID && m.GroupID == body.GroupID {
+			writeMessage(w, http.StatusBadRequest, "User is already a member of this group.")
+			return
+		}
+	}
+
+	m := s.addMembershipLocked(body.UserID, body.GroupID, body.IsGroupManager)
+	s.recordAuditLocked("group-membership-create", "PermissionsGroupMembership", m.MembershipID, membershipDetails(m))
+
+	members := make([]*Membership, 0)
+	for _, id := range sortedKeys(s.memberships) {
+		if m := s.memberships[id]; m.GroupID == body.GroupID {
+			members = append(members, m)
+		}
+	}
+	writeJSON(w, http.StatusOK, members)
+}
+
+func (s *Server) handleRemoveMembership(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	m, ok := s.memberships[id]
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if m.GroupID == AllUsersGroupID {
+		writeMessage(w, http.StatusBadRequest, "You cannot add or remove users to/from the 'All Users' group.")
+		return
+	}
+	if m.GroupID == AdministratorsGroupID && s.countMembersLocked(AdministratorsGroupID) == 1 {
+		writeMessage(w, http.StatusBadRequest, "You cannot remove the last member of the 'Administrators' group.")
+		return
+	}
+
+	delete(s.memberships, id)
+	s.recordAuditLocked("group-membership-delete", "PermissionsGroupMembership", m.MembershipID, membershipDetails(m))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleUpdateMembership(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IsGroupManager bool `json:"is_group_manager"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.PaidPlan {
+		writeMessage(w, http.StatusPaymentRequired, "Group Manager is a paid feature not currently available to your instance.")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	m, ok := s.memberships[id]
+	if !ok {
+		writeText(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+
+	m.IsGroupManager = body.IsGroupManager
+	writeJSON(w, http.StatusOK, m)
+}
+
+func (s *Server) handleListCollections(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Collection, 0, len(s.collections))
+	for _, id := range sortedKeys(s.collections) {
+		out = append(out, s.collections[id])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleGetGraph(graph func() *Graph) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, graph())
+	}
+}
+
+// handlePutGraph applies a partial graph the way Metabase does: only the groups present
+// in the body are replaced, and the request must carry the current revision.
+// handlePutGraph merges the groups in the body into graph. When auditTopic is set, the change is audited.
+func (s *Server) handlePutGraph(graph func() *Graph, auditTopic string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body Graph
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeMessage(w, http.StatusBadRequest, "Invalid JSON body.")
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		current := graph()
+		if body.Revision != current.Revision {
+			writeMessage(w, http.StatusConflict, msgPermissionsChanged)
+			return
+		}
+		for groupID, perms := range body.Groups {
+			id, err := strconv.Atoi(groupID)
+			if err != nil {
+				writeMessage(w, http.StatusBadRequest, fmt.Sprintf("Invalid group ID: %s", groupID))
+				return
+			}
+			if _, ok := s.groups[id]; !ok {
+				writeText(w, http.StatusNotFound, msgNotFound)
+				return
+			}
+			current.Groups[groupID] = perms
+		}
+		current.Revision++
+		if auditTopic != "" {
+			groups := make([]string, 0, len(body.Groups))
+			for groupID := range body.Groups {
+				groups = append(groups, groupID)
+			}
+			sort.Strings(groups)
+			s.recordAuditLocked(auditTopic, "PermissionsRevision", current.Revision, map[string]any{"groups": groups})
+		}
+		writeJSON(w, http.StatusOK, current)
+	}
+}
+
+func (s *Server) addUserLocked(email, firstName, lastName string) *User {
+	now := s.now().UTC()
+	u := &User{
+		ID:         s.nextUserID,
+		Email:      email,
+		FirstName:  firstName,
+		LastName:   lastName,
+		CommonName: strings.TrimSpace(firstName + " " + lastName),
+		UserType:   "personal",
+		IsActive:   true,
+		DateJoined: now,
+		UpdatedAt:  now,
+	}
+	s.nextUserID++
+	s.users[u.ID] = u
+	s.addMembershipLocked(u.ID, AllUsersGroupID, false)
+	return u
+}
+
+func (s *Server) addMembershipLocked(userID, groupID int, isManager bool) *Membership {
+	m := &Membership{
+		MembershipID:   s.nextMembershipID,
+		GroupID:        groupID,
+		UserID:         userID,
+		IsGroupManager: isManager,
+	}
+	s.nextMembershipID++
+	s.memberships[m.MembershipID] = m
+	if groupID == AdministratorsGroupID {
+		if u, ok := s.users[userID]; ok {
+			u.IsSuperuser = true
+		}
+	}
+	return m
+}
+
+func (s *Server) addAPIKeyLocked(name string, groupID, creatorID int) *APIKey {
+	now := s.now().UTC()
+	k := &APIKey{
+		ID:        s.nextAPIKeyID,
+		Name:      name,
+		CreatorID: creatorID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.nextAPIKeyID++
+	if g, ok := s.groups[groupID]; ok {
+		k.Group = APIKeyGroup{ID: g.ID, Name: g.Name}
+	}
+	if u, ok := s.users[creatorID]; ok {
+		k.UpdatedBy = &APIKeyActor{ID: u.ID, CommonName: u.CommonName}
+	}
+	s.setAPIKeySecretLocked(k)
+	s.apiKeys[k.ID] = k
+
+	// Like Metabase, back the key with an internal user that holds the group membership.
+	u := s.addUserLocked(fmt.Sprintf("api-key-user-%d@api-key.invalid", k.ID), name, "")
+	u.UserType = "api-key"
+	k.UserID = u.ID
+	if groupID != AllUsersGroupID {
+		s.addMembershipLocked(u.ID, groupID, false)
+	}
+	return k
+}
+
+// unmaskedAPIKey is how Metabase returns a key right after creating it, the only time the full key is shown.
+type unmaskedAPIKey struct {
+	*APIKey
+	UnmaskedKey string `json:"unmasked_key"`
+}
+
+func (s *Server) lookupGroupLocked(r *http.Request) (*Group, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, false
+	}
+	g, ok := s.groups[id]
+	return g, ok
+}
+
+// validateGroupNameLocked rejects empty names and names already used by a group other than exceptID.
+func (s *Server) validateGroupNameLocked(name string, exceptID int) (string, bool) {
+	if strings.TrimSpace(name) == "" {
+		return "value must be a non-blank string.", false
+	}
+	for _, g := range s.groups {
+		if g.ID != exceptID && strings.EqualFold(g.Name, name) {
+			return "A group with that name already exists.", false
+		}
+	}
+	return "", true
+}
+
+func (s *Server) lookupAPIKey(r *http.Request) (*APIKey, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, false
+	}
+	k, ok := s.apiKeys[id]
+	return k, ok
+}
+
+// setAPIKeySecretLocked generates a new unmasked key. Metabase masks all but the prefix.
+func (s *Server) setAPIKeySecretLocked(k *APIKey) {
+	k.Key = fmt.Sprintf("mb_%04d%s", k.ID, strconv.FormatInt(s.now().UnixNano(), 36))
+	k.MaskedKey = k.Key[:7] + strings.Repeat("*", 8)
+}
+
+func membershipDetails(m *Membership) map[string]any {
+	return map[string]any{
+		"user_id":          m.UserID,
+		"group_id":         m.GroupID,
+		"is_group_manager": m.IsGroupManager,
+	}
+}
+
+func (s *Server) countMembersLocked(groupID int) int {
+	var n int
+	for _, m := range s.memberships {
+		if m.GroupID == groupID {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) lookupUser(r *http.Request) (*User, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, false
+	}
+	u, ok := s.users[id]
+	return u, ok
+}
+
+// pageParams reads Metabase's limit/offset query parameters. Paging only applies
+// when limit is present, mirroring the API's behavior of returning everything otherwise.
+func pageParams(r *http.Request) (int, int, bool, error) {
+	q := r.URL.Query()
+	if q.Get("limit") == "" {
+		return 0, 0, false, nil
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 0 {
+		return 0, 0, false, fmt.Errorf("limit must be a non-negative integer")
+	}
+	var offset int
+	if raw := q.Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, false, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, true, nil
+}
+
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
+
+func sortedKeys[T any](m map[int]T) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"message": message})
+}
+
+func writeFieldErrors(w http.ResponseWriter, errs map[string]string) {
+	writeJSON(w, http.StatusBadRequest, map[string]any{"errors": errs})
+}
+
+func writeText(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(message))
+}
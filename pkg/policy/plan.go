@@ -0,0 +1,443 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	"github.com/conductorone/baton-metabase/pkg/snapshot"
+)
+
+// Built-in groups. Every user belongs to All Users, and Administrators always has full access.
+const (
+	allUsersGroupID       = 1
+	administratorsGroupID = 2
+)
+
+// Membership change actions.
+const (
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+	ActionRole   = "role"
+)
+
+// unset describes a permission the group has no value for.
+const unset = "unset"
+
+const usersPageSize = 100
+
+// MembershipChange adds a user to a group, removes one, or changes whether the user manages it.
+type MembershipChange struct {
+	Action  string
+	GroupID int
+	Group   string
+	UserID  int
+	Email   string
+	// MembershipID is the membership a removal or role change replaces.
+	MembershipID int
+	// Manager is the role the user ends up with, or had before a removal.
+	Manager bool
+}
+
+// PermissionChange sets one level of a group in the data or collection graph. Object is a path
+// such as database/1 or collection/root, as in snapshots.
+type PermissionChange struct {
+	Graph      string
+	GroupID    int
+	Group      string
+	Object     string
+	Permission string
+	Old        string
+	New        string
+}
+
+// Plan is the set of changes that makes the instance match a policy.
+type Plan struct {
+	Memberships []MembershipChange
+	Permissions []PermissionChange
+
+	// dataGraph and collectionGraph hold the full documents of the groups with permission changes,
+	// with the revision they were read at so applying fails if the graph changed since.
+	dataGraph       *client.PermissionsGraph
+	collectionGraph *client.PermissionsGraph
+}
+
+// Empty reports whether the instance already matches the policy.
+func (p *Plan) Empty() bool {
+	return len(p.Memberships) == 0 && len(p.Permissions) == 0
+}
+
+// Plan compares the policy with the instance and returns the changes that make it match. It fails
+// without changes when the policy names a group or user that does not exist, or would change what
+// Metabase manages itself: the members of All Users and the permissions of Administrators.
+func (p *Policy) Plan(ctx context.Context, c client.ClientService) (*Plan, error) {
+	groups, _, err := c.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupsByName := make(map[string]*client.Group, len(groups))
+	for _, g := range groups {
+		groupsByName[strings.ToLower(g.Name)] = g
+	}
+
+	plan := &Plan{}
+	var manageMembers, manageData, manageCollections bool
+	resolved := make([]*client.Group, len(p.Groups))
+	for i, g := range p.Groups {
+		group, ok := groupsByName[strings.ToLower(g.Name)]
+		if !ok {
+			return nil, fmt.Errorf("group %q does not exist", g.Name)
+		}
+		if group.ID == allUsersGroupID && g.Members != nil {
+			return nil, fmt.Errorf("group %q: every user belongs to %s, its members cannot be managed", g.Name, group.Name)
+		}
+		if group.ID == administratorsGroupID && (len(g.Data) > 0 || len(g.Collections) > 0) {
+			return nil, fmt.Errorf("group %q: %s always has full access, its permissions cannot be managed", g.Name, group.Name)
+		}
+		if group.ID == administratorsGroupID && g.Members != nil && len(g.Members) == 0 {
+			return nil, fmt.Errorf("group %q: the policy would remove every member of %s", g.Name, group.Name)
+		}
+		resolved[i] = group
+		manageMembers = manageMembers || g.Members != nil
+		manageData = manageData || len(g.Data) > 0
+		manageCollections = manageCollections || len(g.Collections) > 0
+	}
+
+	if manageMembers {
+		if err := p.planMemberships(ctx, c, resolved, plan); err != nil {
+			return nil, err
+		}
+	}
+	if manageData {
+		if err := p.planData(ctx, c, resolved, plan); err != nil {
+			return nil, err
+		}
+	}
+	if manageCollections {
+		if err := p.planCollections(ctx, c, resolved, plan); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+func (p *Policy) planMemberships(ctx context.Context, c client.ClientService, groups []*client.Group, plan *Plan) error {
+	users := make(map[string]*client.User)
+	usersByID := make(map[int]*client.User)
+	for offset := 0; ; offset += usersPageSize {
+		page, _, err := c.ListUsersPage(ctx, client.PageOptions{Limit: usersPageSize, Offset: offset})
+		if err != nil {
+			return err
+		}
+		for _, u := range page.Data {
+			users[strings.ToLower(u.Email)] = u
+			usersByID[u.ID] = u
+		}
+		if len(page.Data) == 0 || offset+len(page.Data) >= page.Total {
+			break
+		}
+	}
+
+	memberships, _, err := c.ListMemberships(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list memberships: %w", err)
+	}
+	// Memberships of principals that are not users, such as API keys, are left alone.
+	current := make(map[int]map[int]*client.Membership)
+	for _, userMemberships := range memberships {
+		for _, m := range userMemberships {
+			if _, ok := usersByID[m.UserID]; !ok {
+				continue
+			}
+			if current[m.GroupID] == nil {
+				current[m.GroupID] = make(map[int]*client.Membership)
+			}
+			current[m.GroupID][m.UserID] = m
+		}
+	}
+
+	for i, g := range p.Groups {
+		if g.Members == nil {
+			continue
+		}
+		group := groups[i]
+
+		desired := make(map[int]bool)
+		for _, member := range g.Members {
+			user, ok := users[strings.ToLower(member.Email)]
+			if !ok {
+				return fmt.Errorf("group %q: no Metabase user has the email %s", g.Name, member.Email)
+			}
+			if member.Manager && !c.IsPaidPlan() {
+				return fmt.Errorf("group %q: %s cannot be a manager, group managers need a paid plan", g.Name, member.Email)
+			}
+			desired[user.ID] = true
+
+			change := MembershipChange{GroupID: group.ID, Group: group.Name, UserID: user.ID, Email: user.Email, Manager: member.Manager}
+			m, ok := current[group.ID][user.ID]
+			switch {
+			case !ok:
+				change.Action = ActionAdd
+			case m.IsGroupManager != member.Manager:
+				change.Action = ActionRole
+				change.MembershipID = m.MembershipID
+			default:
+				continue
+			}
+			plan.Memberships = append(plan.Memberships, change)
+		}
+
+		for userID, m := range current[group.ID] {
+			if desired[userID] {
+				continue
+			}
+			plan.Memberships = append(plan.Memberships, MembershipChange{
+				Action:       ActionRemove,
+				GroupID:      group.ID,
+				Group:        group.Name,
+				UserID:       userID,
+				Email:        usersByID[userID].Email,
+				MembershipID: m.MembershipID,
+				Manager:      m.IsGroupManager,
+			})
+		}
+	}
+
+	sort.SliceStable(plan.Memberships, func(i, j int) bool {
+		a, b := plan.Memberships[i], plan.Memberships[j]
+		if a.GroupID != b.GroupID {
+			return a.GroupID < b.GroupID
+		}
+		return strings.ToLower(a.Email) < strings.ToLower(b.Email)
+	})
+	return nil
+}
+
+func (p *Policy) planData(ctx context.Context, c client.ClientService, groups []*client.Group, plan *Plan) error {
+	databases, _, err := c.ListDatabases(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+	databaseIDs := make(map[string]bool, len(databases))
+	for _, db := range databases {
+		databaseIDs[strconv.Itoa(db.ID)] = true
+	}
+
+	graph, _, err := c.GetPermissionsGraph(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get permissions graph: %w", err)
+	}
+	updated := &client.PermissionsGraph{Revision: graph.Revision, Groups: make(map[string]map[string]any)}
+
+	for i, g := range p.Groups {
+		group := groups[i]
+		groupKey := strconv.Itoa(group.ID)
+		doc, err := graph.GroupCopy(groupKey)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, databaseID := range slices.Sorted(maps.Keys(g.Data)) {
+			if !databaseIDs[databaseID] {
+				return fmt.Errorf("group %q: database %s does not exist", g.Name, databaseID)
+			}
+			databasePerms, _ := doc[databaseID].(map[string]any)
+			if databasePerms == nil {
+				databasePerms = make(map[string]any)
+			}
+			for _, permission := range slices.Sorted(maps.Keys(g.Data[databaseID])) {
+				level := g.Data[databaseID][permission]
+				old := dataLevel(databasePerms, permission)
+				if old == level {
+					continue
+				}
+
+				setDataLevel(databasePerms, permission, level)
+				doc[databaseID] = databasePerms
+				changed = true
+				plan.Permissions = append(plan.Permissions, PermissionChange{
+					Graph:      snapshot.GraphData,
+					GroupID:    group.ID,
+					Group:      group.Name,
+					Object:     "database/" + databaseID,
+					Permission: permission,
+					Old:        old,
+					New:        level,
+				})
+			}
+		}
+		if changed {
+			updated.Groups[groupKey] = doc
+		}
+	}
+
+	if len(updated.Groups) > 0 {
+		plan.dataGraph = updated
+	}
+	return nil
+}
+
+func (p *Policy) planCollections(ctx context.Context, c client.ClientService, groups []*client.Group, plan *Plan) error {
+	graph, _, err := c.GetCollectionGraph(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get collection graph: %w", err)
+	}
+	updated := &client.PermissionsGraph{Revision: graph.Revision, Groups: make(map[string]map[string]any)}
+
+	for i, g := range p.Groups {
+		group := groups[i]
+		groupKey := strconv.Itoa(group.ID)
+		doc, err := graph.GroupCopy(groupKey)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, collectionID := range slices.Sorted(maps.Keys(g.Collections)) {
+			level := g.Collections[collectionID]
+			old, ok := doc[collectionID].(string)
+			if !ok {
+				old = unset
+			}
+			if old == level {
+				continue
+			}
+
+			doc[collectionID] = level
+			changed = true
+			plan.Permissions = append(plan.Permissions, PermissionChange{
+				Graph:      snapshot.GraphCollection,
+				GroupID:    group.ID,
+				Group:      group.Name,
+				Object:     "collection/" + collectionID,
+				Permission: snapshot.GraphCollection,
+				Old:        old,
+				New:        level,
+			})
+		}
+		if changed {
+			updated.Groups[groupKey] = doc
+		}
+	}
+
+	if len(updated.Groups) > 0 {
+		plan.collectionGraph = updated
+	}
+	return nil
+}
+
+// dataLevel returns the database-wide level of a permission, "granular" when it is set per schema
+// or table.
+func dataLevel(databasePerms map[string]any, permission string) string {
+	value := databasePerms[permission]
+	if permission == "download" || permission == "data-model" {
+		nested, _ := value.(map[string]any)
+		value = nested["schemas"]
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return unset
+	case string:
+		return v
+	default:
+		return "granular"
+	}
+}
+
+// setDataLevel sets a permission for the whole database, replacing any per schema levels.
+func setDataLevel(databasePerms map[string]any, permission, level string) {
+	if permission == "download" || permission == "data-model" {
+		databasePerms[permission] = map[string]any{"schemas": level}
+		return
+	}
+	databasePerms[permission] = level
+}
+
+// Apply makes the changes of the plan. The graphs are written first, at the revision the plan read,
+// so a plan computed before someone else changed permissions fails before touching memberships.
+// A role change updates the membership in place.
+func (p *Plan) Apply(ctx context.Context, c client.ClientService) error {
+	if p.dataGraph != nil {
+		if _, _, err := c.UpdatePermissionsGraph(ctx, p.dataGraph); err != nil {
+			return fmt.Errorf("failed to apply data permissions, re-run the plan if they changed since: %w", err)
+		}
+	}
+	if p.collectionGraph != nil {
+		if _, _, err := c.UpdateCollectionGraph(ctx, p.collectionGraph); err != nil {
+			return fmt.Errorf("failed to apply collection permissions, re-run the plan if they changed since: %w", err)
+		}
+	}
+
+	for _, change := range p.Memberships {
+		switch change.Action {
+		case ActionRemove:
+			if _, err := c.RemoveUserFromGroup(ctx, strconv.Itoa(change.MembershipID)); err != nil {
+				return fmt.Errorf("failed to remove %s from %s: %w", change.Email, change.Group, err)
+			}
+		case ActionAdd:
+			membership := &client.Membership{GroupID: change.GroupID, UserID: change.UserID, IsGroupManager: change.Manager}
+			if _, err := c.AddUserToGroup(ctx, membership); err != nil {
+				return fmt.Errorf("failed to add %s to %s: %w", change.Email, change.Group, err)
+			}
+		case ActionRole:
+			if _, err := c.UpdateMembership(ctx, strconv.Itoa(change.MembershipID), change.Manager); err != nil {
+				return fmt.Errorf("failed to change the role of %s in %s: %w", change.Email, change.Group, err)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteText writes the plan for review, one change per line followed by a summary.
+func (p *Plan) WriteText(w io.Writer) error {
+	if p.Empty() {
+		_, err := fmt.Fprintln(w, "no changes, the instance matches the policy")
+		return err
+	}
+
+	var lines []string
+	var adds, removes, changes int
+	for _, m := range p.Memberships {
+		switch m.Action {
+		case ActionAdd:
+			adds++
+			lines = append(lines, fmt.Sprintf("+ add %s to %s (%d) as %s", m.Email, m.Group, m.GroupID, role(m.Manager)))
+		case ActionRemove:
+			removes++
+			lines = append(lines, fmt.Sprintf("- remove %s from %s (%d)", m.Email, m.Group, m.GroupID))
+		case ActionRole:
+			changes++
+			lines = append(lines, fmt.Sprintf("~ change %s in %s (%d): %s -> %s", m.Email, m.Group, m.GroupID, role(!m.Manager), role(m.Manager)))
+		}
+	}
+	for _, c := range p.Permissions {
+		changes++
+		permission := c.Graph + " " + c.Permission
+		if c.Graph == snapshot.GraphCollection {
+			permission = "collection access"
+		}
+		lines = append(lines, fmt.Sprintf("~ set %s of %s (%d) on %s: %s -> %s", permission, c.Group, c.GroupID, c.Object, c.Old, c.New))
+	}
+	lines = append(lines, fmt.Sprintf("plan: %d to add, %d to remove, %d to change", adds, removes, changes))
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func role(manager bool) string {
+	if manager {
+		return "manager"
+	}
+	return "member"
+}
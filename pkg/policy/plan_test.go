@@ -0,0 +1,201 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	"github.com/conductorone/baton-metabase/pkg/metabasetest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, srv *metabasetest.Server) *client.MetabaseClient {
+	t.Helper()
+	t.Setenv("BATON_HTTP_CACHE_TTL", "0")
+
+	c, err := client.New(context.Background(), srv.URL, srv.APIKey, srv.PaidPlan)
+	require.NoError(t, err)
+	return c
+}
+
+func mustParse(t *testing.T, policy string) *Policy {
+	t.Helper()
+	p, err := Parse(strings.NewReader(policy))
+	require.NoError(t, err)
+	return p
+}
+
+func TestPlanAndApply(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	ada := srv.AddUser("ada@example.com", "Ada", "Lovelace")
+	grace := srv.AddUser("grace@example.com", "Grace", "Hopper")
+	linus := srv.AddUser("linus@example.com", "Linus", "Torvalds")
+	analysts := srv.AddGroup("Analysts")
+	finance := srv.AddGroup("Finance")
+	graceAnalyst := srv.AddMembership(grace.ID, analysts.ID, false)
+	linusAnalyst := srv.AddMembership(linus.ID, analysts.ID, false)
+	srv.AddMembership(linus.ID, finance.ID, false)
+	srv.AddDatabase(1, "Warehouse", "postgres")
+	srv.SetPermissionsGraph(analysts.ID, map[string]any{
+		"1": map[string]any{
+			"view-data":      "blocked",
+			"create-queries": "no",
+			"download":       map[string]any{"schemas": map[string]any{"public": "full"}},
+		},
+	})
+	srv.SetCollectionPermission(analysts.ID, "root", "none")
+	srv.SetCollectionPermission(analysts.ID, "5", "write")
+
+	p := mustParse(t, `
+groups:
+  - name: analysts
+    members:
+      - ada@example.com
+      - email: GRACE@example.com
+        manager: true
+    data:
+      "1":
+        view-data: unrestricted
+        create-queries: "no"
+        download: limited
+    collections:
+      root: read
+  - name: Finance
+    collections:
+      root: read
+`)
+	c := newTestClient(t, srv)
+
+	plan, err := p.Plan(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, []MembershipChange{
+		{Action: ActionAdd, GroupID: analysts.ID, Group: "Analysts", UserID: ada.ID, Email: "ada@example.com"},
+		{Action: ActionRole, GroupID: analysts.ID, Group: "Analysts", UserID: grace.ID, Email: "grace@example.com", MembershipID: graceAnalyst.MembershipID, Manager: true},
+		{Action: ActionRemove, GroupID: analysts.ID, Group: "Analysts", UserID: linus.ID, Email: "linus@example.com", MembershipID: linusAnalyst.MembershipID},
+	}, plan.Memberships)
+
+	var out bytes.Buffer
+	require.NoError(t, plan.WriteText(&out))
+	require.Equal(t, `+ add ada@example.com to Analysts (3) as member
+~ change grace@example.com in Analysts (3): member -> manager
+- remove linus@example.com from Analysts (3)
+~ set data download of Analysts (3) on database/1: granular -> limited
+~ set data view-data of Analysts (3) on database/1: blocked -> unrestricted
+~ set collection access of Analysts (3) on collection/root: none -> read
+~ set collection access of Finance (4) on collection/root: unset -> read
+plan: 1 to add, 1 to remove, 5 to change
+`, out.String())
+
+	// Planning changes nothing.
+	require.Equal(t, "blocked", srv.PermissionsGraph(analysts.ID)["1"].(map[string]any)["view-data"])
+	require.Len(t, srv.Memberships(), 6)
+
+	require.NoError(t, plan.Apply(ctx, c))
+
+	require.Equal(t, map[string]any{
+		"1": map[string]any{
+			"view-data":      "unrestricted",
+			"create-queries": "no",
+			"download":       map[string]any{"schemas": "limited"},
+		},
+	}, srv.PermissionsGraph(analysts.ID))
+	collections, _, err := c.GetCollectionGraph(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"root": "read", "5": "write"}, collections.Groups["3"])
+	require.Equal(t, map[string]any{"root": "read"}, collections.Groups["4"])
+
+	var members []metabasetest.Membership
+	for _, m := range srv.Memberships() {
+		if m.GroupID == analysts.ID {
+			members = append(members, metabasetest.Membership{GroupID: m.GroupID, UserID: m.UserID, IsGroupManager: m.IsGroupManager})
+		}
+		if m.UserID == grace.ID && m.GroupID == analysts.ID {
+			require.Equal(t, graceAnalyst.MembershipID, m.MembershipID, "a role change keeps the membership")
+		}
+	}
+	require.ElementsMatch(t, []metabasetest.Membership{
+		{GroupID: analysts.ID, UserID: ada.ID},
+		{GroupID: analysts.ID, UserID: grace.ID, IsGroupManager: true},
+	}, members)
+
+	// Once applied, the instance matches the policy.
+	again, err := p.Plan(ctx, c)
+	require.NoError(t, err)
+	require.True(t, again.Empty())
+	out.Reset()
+	require.NoError(t, again.WriteText(&out))
+	require.Equal(t, "no changes, the instance matches the policy\n", out.String())
+}
+
+func TestApplyStalePlan(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	ada := srv.AddUser("ada@example.com", "Ada", "Lovelace")
+	analysts := srv.AddGroup("Analysts")
+	srv.AddDatabase(1, "Warehouse", "postgres")
+	c := newTestClient(t, srv)
+
+	p := mustParse(t, `
+groups:
+  - name: Analysts
+    members: [ada@example.com]
+    data: {"1": {view-data: unrestricted}}
+`)
+	plan, err := p.Plan(ctx, c)
+	require.NoError(t, err)
+	require.Len(t, plan.Permissions, 1)
+
+	// Someone changes the data permissions between the plan and the apply.
+	srv.SetPermissionsGraph(analysts.ID, map[string]any{"1": map[string]any{"view-data": "blocked"}})
+
+	err = plan.Apply(ctx, c)
+	require.ErrorContains(t, err, "re-run the plan")
+	require.Equal(t, "blocked", srv.PermissionsGraph(analysts.ID)["1"].(map[string]any)["view-data"])
+	for _, m := range srv.Memberships() {
+		require.False(t, m.GroupID == analysts.ID && m.UserID == ada.ID, "memberships are not touched after a failed graph write")
+	}
+}
+
+func TestPlanRefusals(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	srv.AddUser("ada@example.com", "Ada", "Lovelace")
+	srv.AddGroup("Analysts")
+	srv.AddDatabase(1, "Warehouse", "postgres")
+	c := newTestClient(t, srv)
+
+	for name, tc := range map[string]struct {
+		policy string
+		err    string
+	}{
+		"unknown group":              {"groups: [{name: Sales}]", `group "Sales" does not exist`},
+		"unknown user":               {"groups: [{name: Analysts, members: [bob@example.com]}]", "no Metabase user has the email bob@example.com"},
+		"unknown database":           {`groups: [{name: Analysts, data: {"9": {details: "yes"}}}]`, "database 9 does not exist"},
+		"manager on free plan":       {"groups: [{name: Analysts, members: [{email: ada@example.com, manager: true}]}]", "group managers need a paid plan"},
+		"all users members":          {"groups: [{name: All Users, members: [ada@example.com]}]", "its members cannot be managed"},
+		"administrators data":        {`groups: [{name: Administrators, data: {"1": {view-data: blocked}}}]`, "its permissions cannot be managed"},
+		"administrators collections": {"groups: [{name: Administrators, collections: {root: none}}]", "its permissions cannot be managed"},
+		"emptying administrators":    {"groups: [{name: Administrators, members: []}]", "would remove every member of Administrators"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := mustParse(t, tc.policy).Plan(ctx, c)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+
+	t.Run("all users permissions are managed", func(t *testing.T) {
+		plan, err := mustParse(t, "groups: [{name: All Users, collections: {root: read}}]").Plan(ctx, c)
+		require.NoError(t, err)
+		require.Len(t, plan.Permissions, 1)
+	})
+}
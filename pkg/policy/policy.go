@@ -0,0 +1,150 @@
+// Package policy manages Metabase group memberships and group permissions from a desired-state
+// file kept in version control. Plan compares the file with the live instance, and Apply makes the
+// changes of a plan.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Levels each permission of the file accepts. Data permissions are set for a whole database.
+var (
+	dataLevels = map[string][]string{
+		"view-data":      {"unrestricted", "blocked", "legacy-no-self-service"},
+		"create-queries": {"query-builder-and-native", "query-builder", "no"},
+		"download":       {"full", "limited", "none"},
+		"data-model":     {"all", "none"},
+		"details":        {"yes", "no"},
+	}
+	collectionLevels = []string{"read", "write", "none"}
+)
+
+// Policy is the desired access of the groups it lists. Groups that are not listed, and the parts of
+// a listed group that are left out, are not managed.
+type Policy struct {
+	Groups []Group `yaml:"groups"`
+}
+
+// Group is the desired access of one existing group, found by name.
+type Group struct {
+	Name string `yaml:"name"`
+	// Members is the complete list of the group's members. Leaving it out leaves the memberships
+	// unmanaged, while an empty list removes every member.
+	Members []Member `yaml:"members"`
+	// Data maps database IDs to the levels of the permissions to set on the whole database.
+	Data map[string]map[string]string `yaml:"data"`
+	// Collections maps collection IDs, or "root", to read, write or none.
+	Collections map[string]string `yaml:"collections"`
+}
+
+// Member is a user of a group, found by email. In the file it is either an email or a mapping
+// with email and manager.
+type Member struct {
+	Email   string `yaml:"email"`
+	Manager bool   `yaml:"manager"`
+}
+
+func (m *Member) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&m.Email)
+	}
+
+	type plain Member
+	return node.Decode((*plain)(m))
+}
+
+// Load reads and validates a policy file.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open policy: %w", err)
+	}
+	defer f.Close()
+
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse reads and validates a policy. Unknown keys are rejected so typos do not silently leave
+// access unmanaged.
+func Parse(r io.Reader) (*Policy, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	var p Policy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	names := make(map[string]bool)
+	for i := range p.Groups {
+		g := &p.Groups[i]
+		g.Name = strings.TrimSpace(g.Name)
+		if g.Name == "" {
+			return fmt.Errorf("group %d has no name", i+1)
+		}
+		if names[strings.ToLower(g.Name)] {
+			return fmt.Errorf("group %q is listed more than once", g.Name)
+		}
+		names[strings.ToLower(g.Name)] = true
+
+		emails := make(map[string]bool)
+		for j := range g.Members {
+			m := &g.Members[j]
+			m.Email = strings.TrimSpace(m.Email)
+			if m.Email == "" {
+				return fmt.Errorf("group %q: member %d has no email", g.Name, j+1)
+			}
+			if emails[strings.ToLower(m.Email)] {
+				return fmt.Errorf("group %q: member %s is listed more than once", g.Name, m.Email)
+			}
+			emails[strings.ToLower(m.Email)] = true
+		}
+
+		for _, databaseID := range slices.Sorted(maps.Keys(g.Data)) {
+			for _, permission := range slices.Sorted(maps.Keys(g.Data[databaseID])) {
+				level := g.Data[databaseID][permission]
+				levels, ok := dataLevels[permission]
+				if !ok {
+					return fmt.Errorf("group %q: database %s: unknown permission %q, expected one of %s",
+						g.Name, databaseID, permission, strings.Join(slices.Sorted(maps.Keys(dataLevels)), ", "))
+				}
+				if !slices.Contains(levels, level) {
+					return fmt.Errorf("group %q: database %s: invalid %s level %q, expected one of %s",
+						g.Name, databaseID, permission, level, strings.Join(levels, ", "))
+				}
+			}
+		}
+
+		for _, collectionID := range slices.Sorted(maps.Keys(g.Collections)) {
+			level := g.Collections[collectionID]
+			if !slices.Contains(collectionLevels, level) {
+				return fmt.Errorf("group %q: collection %s: invalid level %q, expected one of %s",
+					g.Name, collectionID, level, strings.Join(collectionLevels, ", "))
+			}
+		}
+	}
+	return nil
+}
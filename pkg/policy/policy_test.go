@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("members as emails or mappings", func(t *testing.T) {
+		p, err := Parse(strings.NewReader(`
+groups:
+  - name: " Analysts "
+    members:
+      - ada@example.com
+      - email: grace@example.com
+        manager: true
+    data:
+      "1":
+        view-data: unrestricted
+        download: limited
+    collections:
+      root: read
+  - name: Finance
+`))
+		require.NoError(t, err)
+		require.Len(t, p.Groups, 2)
+		require.Equal(t, "Analysts", p.Groups[0].Name)
+		require.Equal(t, []Member{{Email: "ada@example.com"}, {Email: "grace@example.com", Manager: true}}, p.Groups[0].Members)
+		require.Equal(t, map[string]map[string]string{"1": {"view-data": "unrestricted", "download": "limited"}}, p.Groups[0].Data)
+		require.Equal(t, map[string]string{"root": "read"}, p.Groups[0].Collections)
+		require.Nil(t, p.Groups[1].Members, "left out members stay unmanaged")
+	})
+
+	t.Run("empty members list", func(t *testing.T) {
+		p, err := Parse(strings.NewReader("groups:\n  - name: Finance\n    members: []\n"))
+		require.NoError(t, err)
+		require.NotNil(t, p.Groups[0].Members)
+		require.Empty(t, p.Groups[0].Members)
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		p, err := Parse(strings.NewReader(""))
+		require.NoError(t, err)
+		require.Empty(t, p.Groups)
+	})
+
+	for name, tc := range map[string]struct {
+		policy string
+		err    string
+	}{
+		"unknown key":           {"groups:\n  - name: Finance\n    member: []\n", "field member not found"},
+		"missing name":          {"groups:\n  - members: []\n", "group 1 has no name"},
+		"duplicate group":       {"groups:\n  - name: Finance\n  - name: finance\n", `group "finance" is listed more than once`},
+		"duplicate member":      {"groups:\n  - name: Finance\n    members: [a@example.com, A@example.com]\n", "member A@example.com is listed more than once"},
+		"unknown permission":    {"groups:\n  - name: Finance\n    data: {\"1\": {view: yes}}\n", `unknown permission "view"`},
+		"invalid data level":    {"groups:\n  - name: Finance\n    data: {\"1\": {download: all}}\n", `invalid download level "all"`},
+		"invalid collection":    {"groups:\n  - name: Finance\n    collections: {root: curate}\n", `invalid level "curate"`},
+		"member without email":  {"groups:\n  - name: Finance\n    members: [{manager: true}]\n", "member 1 has no email"},
+		"not a policy document": {"- Finance\n", "failed to parse policy"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.policy))
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
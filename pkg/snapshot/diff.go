@@ -0,0 +1,328 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Diff is the access drift between two snapshots of the same instance.
+type Diff struct {
+	UsersAdded         []User             `json:"users_added"`
+	UsersRemoved       []User             `json:"users_removed"`
+	ActivationChanges  []ActivationChange `json:"activation_changes"`
+	GroupsAdded        []Group            `json:"groups_added"`
+	GroupsRemoved      []Group            `json:"groups_removed"`
+	MembershipsAdded   []Membership       `json:"memberships_added"`
+	MembershipsRemoved []Membership       `json:"memberships_removed"`
+	RoleChanges        []Membership       `json:"role_changes"`
+	PermissionChanges  []PermissionChange `json:"permission_changes"`
+
+	// users and groups name the IDs in the text report, preferring the newer snapshot.
+	users  map[int]User
+	groups map[int]Group
+}
+
+// ActivationChange is a user that was activated or deactivated. Active is the new state.
+type ActivationChange struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Active bool   `json:"active"`
+}
+
+// PermissionChange is a cell of a permission graph that changed. Old is empty for a level that
+// was added and New is empty for one that was removed.
+type PermissionChange struct {
+	Graph      string `json:"graph"`
+	GroupID    int    `json:"group_id"`
+	Object     string `json:"object"`
+	Permission string `json:"permission"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+}
+
+// Read reads a snapshot written by Write. path is the snapshot directory or its snapshot.json.
+func Read(path string) (*Snapshot, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, JSONFile)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	s.normalize()
+	return &s, nil
+}
+
+// Compare reports the drift from old to current.
+func Compare(old, current *Snapshot) *Diff {
+	d := &Diff{
+		users:  make(map[int]User),
+		groups: make(map[int]Group),
+	}
+	for _, s := range []*Snapshot{old, current} {
+		for _, u := range s.Users {
+			d.users[u.ID] = u
+		}
+		for _, g := range s.Groups {
+			d.groups[g.ID] = g
+		}
+	}
+
+	oldUsers := make(map[int]User, len(old.Users))
+	for _, u := range old.Users {
+		oldUsers[u.ID] = u
+	}
+	currentUsers := make(map[int]bool, len(current.Users))
+	for _, u := range current.Users {
+		currentUsers[u.ID] = true
+		before, ok := oldUsers[u.ID]
+		switch {
+		case !ok:
+			d.UsersAdded = append(d.UsersAdded, u)
+		case before.Active != u.Active:
+			d.ActivationChanges = append(d.ActivationChanges, ActivationChange{UserID: u.ID, Email: u.Email, Active: u.Active})
+		}
+	}
+	for _, u := range old.Users {
+		if !currentUsers[u.ID] {
+			d.UsersRemoved = append(d.UsersRemoved, u)
+		}
+	}
+
+	oldGroups := make(map[int]bool, len(old.Groups))
+	for _, g := range old.Groups {
+		oldGroups[g.ID] = true
+	}
+	currentGroups := make(map[int]bool, len(current.Groups))
+	for _, g := range current.Groups {
+		currentGroups[g.ID] = true
+		if !oldGroups[g.ID] {
+			d.GroupsAdded = append(d.GroupsAdded, g)
+		}
+	}
+	for _, g := range old.Groups {
+		if !currentGroups[g.ID] {
+			d.GroupsRemoved = append(d.GroupsRemoved, g)
+		}
+	}
+
+	type membershipKey struct{ userID, groupID int }
+	oldMemberships := make(map[membershipKey]Membership, len(old.Memberships))
+	for _, m := range old.Memberships {
+		oldMemberships[membershipKey{m.UserID, m.GroupID}] = m
+	}
+	currentMemberships := make(map[membershipKey]bool, len(current.Memberships))
+	for _, m := range current.Memberships {
+		key := membershipKey{m.UserID, m.GroupID}
+		currentMemberships[key] = true
+		before, ok := oldMemberships[key]
+		switch {
+		case !ok:
+			d.MembershipsAdded = append(d.MembershipsAdded, m)
+		case before.IsGroupManager != m.IsGroupManager:
+			d.RoleChanges = append(d.RoleChanges, m)
+		}
+	}
+	for _, m := range old.Memberships {
+		if !currentMemberships[membershipKey{m.UserID, m.GroupID}] {
+			d.MembershipsRemoved = append(d.MembershipsRemoved, m)
+		}
+	}
+
+	type cellKey struct {
+		graph, object, permission string
+		groupID                   int
+	}
+	oldCells := make(map[cellKey]string)
+	for _, g := range old.Grants() {
+		oldCells[cellKey{g.Graph, g.Object, g.Permission, g.GroupID}] = g.Level
+	}
+	for _, g := range current.Grants() {
+		key := cellKey{g.Graph, g.Object, g.Permission, g.GroupID}
+		before, ok := oldCells[key]
+		delete(oldCells, key)
+		if ok && before == g.Level {
+			continue
+		}
+		d.PermissionChanges = append(d.PermissionChanges, PermissionChange{
+			Graph: g.Graph, GroupID: g.GroupID, Object: g.Object, Permission: g.Permission, Old: before, New: g.Level,
+		})
+	}
+	for key, level := range oldCells {
+		d.PermissionChanges = append(d.PermissionChanges, PermissionChange{
+			Graph: key.graph, GroupID: key.groupID, Object: key.object, Permission: key.permission, Old: level,
+		})
+	}
+	sort.Slice(d.PermissionChanges, func(i, j int) bool {
+		a, b := d.PermissionChanges[i], d.PermissionChanges[j]
+		switch {
+		case a.Graph != b.Graph:
+			return a.Graph < b.Graph
+		case a.GroupID != b.GroupID:
+			return a.GroupID < b.GroupID
+		case a.Object != b.Object:
+			return a.Object < b.Object
+		}
+		return a.Permission < b.Permission
+	})
+
+	return d
+}
+
+// Empty reports whether there is no drift.
+func (d *Diff) Empty() bool {
+	return len(d.UsersAdded) == 0 && len(d.UsersRemoved) == 0 && len(d.ActivationChanges) == 0 &&
+		len(d.GroupsAdded) == 0 && len(d.GroupsRemoved) == 0 &&
+		len(d.MembershipsAdded) == 0 && len(d.MembershipsRemoved) == 0 && len(d.RoleChanges) == 0 &&
+		len(d.PermissionChanges) == 0
+}
+
+// WriteJSON writes the diff as indented JSON, with empty lists rather than nulls.
+func (d *Diff) WriteJSON(w io.Writer) error {
+	out := *d
+	out.UsersAdded = nonNil(out.UsersAdded)
+	out.UsersRemoved = nonNil(out.UsersRemoved)
+	out.ActivationChanges = nonNil(out.ActivationChanges)
+	out.GroupsAdded = nonNil(out.GroupsAdded)
+	out.GroupsRemoved = nonNil(out.GroupsRemoved)
+	out.MembershipsAdded = nonNil(out.MembershipsAdded)
+	out.MembershipsRemoved = nonNil(out.MembershipsRemoved)
+	out.RoleChanges = nonNil(out.RoleChanges)
+	out.PermissionChanges = nonNil(out.PermissionChanges)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+	return nil
+}
+
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+// WriteText writes the diff as a human readable report, one section per kind of change.
+func (d *Diff) WriteText(w io.Writer) error {
+	if d.Empty() {
+		_, err := fmt.Fprintln(w, "no access drift")
+		return err
+	}
+
+	var lines []string
+	section := func(title string, entries []string) {
+		if len(entries) == 0 {
+			return
+		}
+		lines = append(lines, title+":")
+		for _, entry := range entries {
+			lines = append(lines, "  "+entry)
+		}
+	}
+
+	var entries []string
+	for _, u := range d.UsersAdded {
+		entries = append(entries, "+ "+d.user(u.ID))
+	}
+	section("users added", entries)
+
+	entries = nil
+	for _, u := range d.UsersRemoved {
+		entries = append(entries, "- "+d.user(u.ID))
+	}
+	section("users removed", entries)
+
+	entries = nil
+	for _, c := range d.ActivationChanges {
+		change := "inactive -> active"
+		if !c.Active {
+			change = "active -> inactive"
+		}
+		entries = append(entries, fmt.Sprintf("~ %s: %s", d.user(c.UserID), change))
+	}
+	section("activation changes", entries)
+
+	entries = nil
+	for _, g := range d.GroupsAdded {
+		entries = append(entries, "+ "+d.group(g.ID))
+	}
+	section("groups added", entries)
+
+	entries = nil
+	for _, g := range d.GroupsRemoved {
+		entries = append(entries, "- "+d.group(g.ID))
+	}
+	section("groups removed", entries)
+
+	entries = nil
+	for _, m := range d.MembershipsAdded {
+		entries = append(entries, fmt.Sprintf("+ %s in %s as %s", d.user(m.UserID), d.group(m.GroupID), role(m.IsGroupManager)))
+	}
+	section("memberships added", entries)
+
+	entries = nil
+	for _, m := range d.MembershipsRemoved {
+		entries = append(entries, fmt.Sprintf("- %s in %s", d.user(m.UserID), d.group(m.GroupID)))
+	}
+	section("memberships removed", entries)
+
+	entries = nil
+	for _, m := range d.RoleChanges {
+		entries = append(entries, fmt.Sprintf("~ %s in %s: %s -> %s", d.user(m.UserID), d.group(m.GroupID), role(!m.IsGroupManager), role(m.IsGroupManager)))
+	}
+	section("role changes", entries)
+
+	entries = nil
+	for _, c := range d.PermissionChanges {
+		entries = append(entries, fmt.Sprintf("~ %s %s %s %s: %s -> %s", c.Graph, d.group(c.GroupID), c.Object, c.Permission, level(c.Old), level(c.New)))
+	}
+	section("permission changes", entries)
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Diff) user(id int) string {
+	if u, ok := d.users[id]; ok && u.Email != "" {
+		return fmt.Sprintf("%s (%d)", u.Email, id)
+	}
+	return fmt.Sprintf("user %d", id)
+}
+
+func (d *Diff) group(id int) string {
+	if g, ok := d.groups[id]; ok && g.Name != "" {
+		return fmt.Sprintf("%s (%d)", g.Name, id)
+	}
+	return fmt.Sprintf("group %d", id)
+}
+
+func role(isManager bool) string {
+	if isManager {
+		return "manager"
+	}
+	return "member"
+}
+
+func level(l string) string {
+	if l == "" {
+		return "(none)"
+	}
+	return l
+}
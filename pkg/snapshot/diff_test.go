@@ -0,0 +1,122 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	old := &Snapshot{
+		Users: []User{
+			{ID: 1, Email: "ada@example.com", Active: true},
+			{ID: 2, Email: "grace@example.com", Active: true},
+			{ID: 3, Email: "linus@example.com", Active: true},
+		},
+		Groups: []Group{{ID: 1, Name: "All Users"}, {ID: 3, Name: "Analysts"}, {ID: 4, Name: "Finance"}},
+		Memberships: []Membership{
+			{UserID: 1, GroupID: 3},
+			{UserID: 2, GroupID: 3, IsGroupManager: true},
+			{UserID: 3, GroupID: 4},
+		},
+		PermissionsGraph: map[string]map[string]any{
+			"3": {"1": map[string]any{"view-data": "blocked", "download": map[string]any{"schemas": "full"}}},
+		},
+		CollectionGraph: map[string]map[string]any{"3": {"root": "read"}},
+	}
+	current := &Snapshot{
+		Users: []User{
+			{ID: 1, Email: "ada@example.com", Active: false},
+			{ID: 2, Email: "grace@example.com", Active: true},
+			{ID: 5, Email: "eve@example.com", Active: true},
+		},
+		Groups: []Group{{ID: 1, Name: "All Users"}, {ID: 3, Name: "Analysts"}, {ID: 6, Name: "Ops"}},
+		Memberships: []Membership{
+			{UserID: 1, GroupID: 3},
+			{UserID: 2, GroupID: 3},
+			{UserID: 5, GroupID: 6},
+		},
+		PermissionsGraph: map[string]map[string]any{
+			"3": {"1": map[string]any{"view-data": "unrestricted"}},
+		},
+		CollectionGraph:  map[string]map[string]any{"3": {"root": "read"}},
+		ApplicationGraph: map[string]map[string]any{"6": {"monitoring": "yes"}},
+	}
+
+	d := Compare(old, current)
+	require.False(t, d.Empty())
+	require.Equal(t, []User{{ID: 5, Email: "eve@example.com", Active: true}}, d.UsersAdded)
+	require.Equal(t, []User{{ID: 3, Email: "linus@example.com", Active: true}}, d.UsersRemoved)
+	require.Equal(t, []ActivationChange{{UserID: 1, Email: "ada@example.com", Active: false}}, d.ActivationChanges)
+	require.Equal(t, []Group{{ID: 6, Name: "Ops"}}, d.GroupsAdded)
+	require.Equal(t, []Group{{ID: 4, Name: "Finance"}}, d.GroupsRemoved)
+	require.Equal(t, []Membership{{UserID: 5, GroupID: 6}}, d.MembershipsAdded)
+	require.Equal(t, []Membership{{UserID: 3, GroupID: 4}}, d.MembershipsRemoved)
+	require.Equal(t, []Membership{{UserID: 2, GroupID: 3}}, d.RoleChanges)
+	require.Equal(t, []PermissionChange{
+		{Graph: GraphApplication, GroupID: 6, Object: "application", Permission: "monitoring", New: "yes"},
+		{Graph: GraphData, GroupID: 3, Object: "database/1", Permission: "download", Old: "full"},
+		{Graph: GraphData, GroupID: 3, Object: "database/1", Permission: "view-data", Old: "blocked", New: "unrestricted"},
+	}, d.PermissionChanges)
+
+	var text bytes.Buffer
+	require.NoError(t, d.WriteText(&text))
+	require.Equal(t, `users added:
+  + eve@example.com (5)
+users removed:
+  - linus@example.com (3)
+activation changes:
+  ~ ada@example.com (1): active -> inactive
+groups added:
+  + Ops (6)
+groups removed:
+  - Finance (4)
+memberships added:
+  + eve@example.com (5) in Ops (6) as member
+memberships removed:
+  - linus@example.com (3) in Finance (4)
+role changes:
+  ~ grace@example.com (2) in Analysts (3): manager -> member
+permission changes:
+  ~ application Ops (6) application monitoring: (none) -> yes
+  ~ data Analysts (3) database/1 download: full -> (none)
+  ~ data Analysts (3) database/1 view-data: blocked -> unrestricted
+`, text.String())
+
+	var out bytes.Buffer
+	require.NoError(t, d.WriteJSON(&out))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Len(t, decoded["permission_changes"], 3)
+}
+
+func TestCompareWithoutDrift(t *testing.T) {
+	s := &Snapshot{
+		Users:            []User{{ID: 1, Email: "ada@example.com", Active: true}},
+		PermissionsGraph: map[string]map[string]any{"1": {"1": map[string]any{"view-data": "blocked"}}},
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, Write(dir, s))
+	read, err := Read(dir)
+	require.NoError(t, err)
+	read2, err := Read(filepath.Join(dir, JSONFile))
+	require.NoError(t, err)
+
+	d := Compare(read, read2)
+	require.True(t, d.Empty())
+
+	var text bytes.Buffer
+	require.NoError(t, d.WriteText(&text))
+	require.Equal(t, "no access drift\n", text.String())
+
+	var out bytes.Buffer
+	require.NoError(t, d.WriteJSON(&out))
+	require.Contains(t, out.String(), `"users_added": []`)
+
+	_, err = Read(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
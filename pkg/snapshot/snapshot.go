@@ -0,0 +1,341 @@
+// Package snapshot takes point-in-time snapshots of the access on a Metabase instance: users,
+// groups, memberships and the permission graphs. Snapshots are normalized so that two snapshots
+// of the same access are byte for byte identical and can be diffed in version control.
+package snapshot
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+)
+
+// Files written by Write.
+const (
+	JSONFile           = "snapshot.json"
+	UsersCSVFile       = "users.csv"
+	MembershipsCSVFile = "memberships.csv"
+	GrantsCSVFile      = "grants.csv"
+)
+
+// Graphs a Grant can come from.
+const (
+	GraphData        = "data"
+	GraphCollection  = "collection"
+	GraphApplication = "application"
+)
+
+const usersPageSize = 100
+
+// Snapshot is the access on a Metabase instance at one point in time. Volatile values such as
+// last logins and graph revisions are left out so snapshots only differ when access does.
+type Snapshot struct {
+	Users       []User       `json:"users"`
+	Groups      []Group      `json:"groups"`
+	Memberships []Membership `json:"memberships"`
+	// Graphs map a group ID to the group's document in the data, collection and, on paid plans,
+	// application permission graphs.
+	PermissionsGraph map[string]map[string]any `json:"permissions_graph"`
+	CollectionGraph  map[string]map[string]any `json:"collection_graph"`
+	ApplicationGraph map[string]map[string]any `json:"application_graph,omitempty"`
+}
+
+type User struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Active    bool   `json:"active"`
+	UserType  string `json:"user_type,omitempty"`
+	SSOSource string `json:"sso_source,omitempty"`
+}
+
+type Group struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Membership struct {
+	UserID         int  `json:"user_id"`
+	GroupID        int  `json:"group_id"`
+	IsGroupManager bool `json:"is_group_manager"`
+}
+
+// Grant is one permission level a group holds in one of the graphs. Object is a path such as
+// database/1/schema/public/table/10, collection/root or application.
+type Grant struct {
+	Graph      string
+	GroupID    int
+	Object     string
+	Permission string
+	Level      string
+}
+
+// Take reads a snapshot of the instance through the Metabase API.
+func Take(ctx context.Context, c client.ClientService) (*Snapshot, error) {
+	s := &Snapshot{}
+
+	for offset := 0; ; offset += usersPageSize {
+		page, _, err := c.ListUsersPage(ctx, client.PageOptions{Limit: usersPageSize, Offset: offset})
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range page.Data {
+			user := User{
+				ID:        u.ID,
+				Email:     u.Email,
+				FirstName: u.FirstName,
+				LastName:  u.LastName,
+				Active:    u.IsActive,
+				UserType:  u.UserType,
+			}
+			if u.SSOSource != nil {
+				user.SSOSource = *u.SSOSource
+			}
+			s.Users = append(s.Users, user)
+		}
+		if len(page.Data) == 0 || offset+len(page.Data) >= page.Total {
+			break
+		}
+	}
+
+	groups, _, err := c.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		s.Groups = append(s.Groups, Group{ID: g.ID, Name: g.Name})
+	}
+
+	memberships, _, err := c.ListMemberships(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, userMemberships := range memberships {
+		for _, m := range userMemberships {
+			s.Memberships = append(s.Memberships, Membership{UserID: m.UserID, GroupID: m.GroupID, IsGroupManager: m.IsGroupManager})
+		}
+	}
+
+	dataGraph, _, err := c.GetPermissionsGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.PermissionsGraph = dataGraph.Groups
+
+	collectionGraph, _, err := c.GetCollectionGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.CollectionGraph = collectionGraph.Groups
+
+	if c.IsPaidPlan() {
+		applicationGraph, _, err := c.GetApplicationGraph(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.ApplicationGraph = applicationGraph.Groups
+	}
+
+	s.normalize()
+	return s, nil
+}
+
+// normalize sorts the lists of the snapshot. Maps need no sorting, as encoding/json writes their
+// keys in order.
+func (s *Snapshot) normalize() {
+	sort.Slice(s.Users, func(i, j int) bool { return s.Users[i].ID < s.Users[j].ID })
+	sort.Slice(s.Groups, func(i, j int) bool { return s.Groups[i].ID < s.Groups[j].ID })
+	sort.Slice(s.Memberships, func(i, j int) bool {
+		a, b := s.Memberships[i], s.Memberships[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.GroupID < b.GroupID
+	})
+	if s.PermissionsGraph == nil {
+		s.PermissionsGraph = make(map[string]map[string]any)
+	}
+	if s.CollectionGraph == nil {
+		s.CollectionGraph = make(map[string]map[string]any)
+	}
+}
+
+// Grants flattens the permission graphs into one row per level a group holds, ordered by graph,
+// group, object and permission.
+func (s *Snapshot) Grants() []Grant {
+	var grants []Grant
+	add := func(graph, groupKey, object, permission, level string) {
+		groupID, err := strconv.Atoi(groupKey)
+		if err != nil {
+			return
+		}
+		grants = append(grants, Grant{Graph: graph, GroupID: groupID, Object: object, Permission: permission, Level: level})
+	}
+
+	for groupKey, databases := range s.PermissionsGraph {
+		for databaseID, perms := range databases {
+			doc, ok := perms.(map[string]any)
+			if !ok {
+				continue
+			}
+			for permission, value := range doc {
+				if nested, ok := value.(map[string]any); ok && (permission == "download" || permission == "data-model") {
+					value = nested["schemas"]
+				}
+				flattenLevels(value, "database/"+databaseID, []string{"schema", "table"}, func(object, level string) {
+					add(GraphData, groupKey, object, permission, level)
+				})
+			}
+		}
+	}
+	for groupKey, collections := range s.CollectionGraph {
+		for collectionID, level := range collections {
+			if level, ok := level.(string); ok {
+				add(GraphCollection, groupKey, "collection/"+collectionID, GraphCollection, level)
+			}
+		}
+	}
+	for groupKey, perms := range s.ApplicationGraph {
+		for permission, level := range perms {
+			if level, ok := level.(string); ok {
+				add(GraphApplication, groupKey, GraphApplication, permission, level)
+			}
+		}
+	}
+
+	sort.Slice(grants, func(i, j int) bool {
+		a, b := grants[i], grants[j]
+		switch {
+		case a.Graph != b.Graph:
+			return a.Graph < b.Graph
+		case a.GroupID != b.GroupID:
+			return a.GroupID < b.GroupID
+		case a.Object != b.Object:
+			return a.Object < b.Object
+		}
+		return a.Permission < b.Permission
+	})
+	return grants
+}
+
+// flattenLevels calls emit for every level in a data permission value, which is a single level for
+// the database or set per schema and then per table. levels names the nesting below object.
+func flattenLevels(value any, object string, levels []string, emit func(object, level string)) {
+	switch v := value.(type) {
+	case string:
+		emit(object, v)
+	case map[string]any:
+		if len(levels) == 0 {
+			return
+		}
+		for key, nested := range v {
+			flattenLevels(nested, object+"/"+levels[0]+"/"+key, levels[1:], emit)
+		}
+	}
+}
+
+// WriteJSON writes the snapshot as indented JSON.
+func (s *Snapshot) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// WriteUsersCSV writes one row per user.
+func (s *Snapshot) WriteUsersCSV(w io.Writer) error {
+	rows := [][]string{{"id", "email", "first_name", "last_name", "active", "user_type", "sso_source"}}
+	for _, u := range s.Users {
+		rows = append(rows, []string{strconv.Itoa(u.ID), u.Email, u.FirstName, u.LastName, strconv.FormatBool(u.Active), u.UserType, u.SSOSource})
+	}
+	return writeCSV(w, rows)
+}
+
+// WriteMembershipsCSV writes one row per membership, with the user's email and the group's name.
+func (s *Snapshot) WriteMembershipsCSV(w io.Writer) error {
+	emails := make(map[int]string, len(s.Users))
+	for _, u := range s.Users {
+		emails[u.ID] = u.Email
+	}
+
+	rows := [][]string{{"user_id", "email", "group_id", "group_name", "is_group_manager"}}
+	for _, m := range s.Memberships {
+		rows = append(rows, []string{strconv.Itoa(m.UserID), emails[m.UserID], strconv.Itoa(m.GroupID), s.groupName(m.GroupID), strconv.FormatBool(m.IsGroupManager)})
+	}
+	return writeCSV(w, rows)
+}
+
+// WriteGrantsCSV writes one row per level a group holds in the permission graphs.
+func (s *Snapshot) WriteGrantsCSV(w io.Writer) error {
+	rows := [][]string{{"graph", "group_id", "group_name", "object", "permission", "level"}}
+	for _, g := range s.Grants() {
+		rows = append(rows, []string{g.Graph, strconv.Itoa(g.GroupID), s.groupName(g.GroupID), g.Object, g.Permission, g.Level})
+	}
+	return writeCSV(w, rows)
+}
+
+func (s *Snapshot) groupName(groupID int) string {
+	for _, g := range s.Groups {
+		if g.ID == groupID {
+			return g.Name
+		}
+	}
+	return ""
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
+
+// Write writes the JSON snapshot and the CSV views of users, memberships and grants to dir,
+// creating it if needed.
+func Write(dir string, s *Snapshot) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{JSONFile, s.WriteJSON},
+		{UsersCSVFile, s.WriteUsersCSV},
+		{MembershipsCSVFile, s.WriteMembershipsCSV},
+		{GrantsCSVFile, s.WriteGrantsCSV},
+	}
+	for _, file := range files {
+		if err := writeFile(filepath.Join(dir, file.name), file.write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/conductorone/baton-metabase/pkg/client"
+	"github.com/conductorone/baton-metabase/pkg/metabasetest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, srv *metabasetest.Server) *client.MetabaseClient {
+	t.Helper()
+	t.Setenv("BATON_HTTP_CACHE_TTL", "0")
+
+	c, err := client.New(context.Background(), srv.URL, srv.APIKey, srv.PaidPlan)
+	require.NoError(t, err)
+	return c
+}
+
+func TestTakeAndWrite(t *testing.T) {
+	ctx := context.Background()
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+	srv.PaidPlan = true
+
+	grace := srv.AddUser("grace@example.com", "Grace", "Hopper")
+	ada := srv.AddUser("ada@example.com", "Ada", "Lovelace")
+	analysts := srv.AddGroup("Analysts")
+	srv.AddMembership(ada.ID, analysts.ID, true)
+	srv.SetPermissionsGraph(analysts.ID, map[string]any{
+		"1": map[string]any{
+			"view-data": map[string]any{"public": map[string]any{"10": "unrestricted"}, "sales": "blocked"},
+			"download":  map[string]any{"schemas": "limited"},
+		},
+	})
+	srv.SetCollectionPermission(analysts.ID, "root", "write")
+	srv.SetApplicationPermission(analysts.ID, "monitoring", "yes")
+
+	s, err := Take(ctx, newTestClient(t, srv))
+	require.NoError(t, err)
+	require.Len(t, s.Users, 2)
+	require.Equal(t, grace.ID, s.Users[0].ID)
+	require.Equal(t, []Membership{
+		{UserID: grace.ID, GroupID: metabasetest.AllUsersGroupID},
+		{UserID: ada.ID, GroupID: metabasetest.AllUsersGroupID},
+		{UserID: ada.ID, GroupID: analysts.ID, IsGroupManager: true},
+	}, s.Memberships)
+
+	dir := t.TempDir()
+	require.NoError(t, Write(filepath.Join(dir, "first"), s))
+
+	// A second snapshot of the same access is identical, whatever happened to revisions in between.
+	srv.SetCollectionPermission(analysts.ID, "root", "write")
+	again, err := Take(ctx, newTestClient(t, srv))
+	require.NoError(t, err)
+	require.NoError(t, Write(filepath.Join(dir, "second"), again))
+
+	for _, name := range []string{JSONFile, UsersCSVFile, MembershipsCSVFile, GrantsCSVFile} {
+		first, err := os.ReadFile(filepath.Join(dir, "first", name))
+		require.NoError(t, err)
+		second, err := os.ReadFile(filepath.Join(dir, "second", name))
+		require.NoError(t, err)
+		require.Equal(t, string(first), string(second), name)
+	}
+
+	grants, err := os.ReadFile(filepath.Join(dir, "first", GrantsCSVFile))
+	require.NoError(t, err)
+	require.Equal(t, `graph,group_id,group_name,object,permission,level
+application,3,Analysts,application,monitoring,yes
+collection,3,Analysts,collection/root,collection,write
+data,3,Analysts,database/1,download,limited
+data,3,Analysts,database/1/schema/public/table/10,view-data,unrestricted
+data,3,Analysts,database/1/schema/sales,view-data,blocked
+`, string(grants))
+
+	memberships, err := os.ReadFile(filepath.Join(dir, "first", MembershipsCSVFile))
+	require.NoError(t, err)
+	require.Contains(t, string(memberships), "2,ada@example.com,3,Analysts,true\n")
+}
+
+func TestWriteJSONWithoutApplicationGraph(t *testing.T) {
+	srv := metabasetest.NewServer()
+	defer srv.Close()
+
+	s, err := Take(context.Background(), newTestClient(t, srv))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteJSON(&buf))
+	require.NotContains(t, buf.String(), "application_graph")
+	require.Contains(t, buf.String(), `"permissions_graph": {}`)
+}